@@ -0,0 +1,409 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"strings"
+)
+
+type Bond struct {
+	Link *netlink.Bond
+	h    *Handle
+}
+
+// BondOptions holds the bond attributes. Zero values are the kernel
+// defaults.
+type BondOptions struct {
+	Mode           string // balance-rr, active-backup, balance-xor, broadcast, 802.3ad, balance-tlb or balance-alb
+	Miimon         int    // MII link monitoring interval in milliseconds
+	LacpRate       string // slow or fast (802.3ad only)
+	XmitHashPolicy string // layer2, layer2+3, layer3+4, encap2+3, encap3+4 or vlan+srcmac
+	MinLinks       int    // minimum number of the links to be up (802.3ad only)
+}
+
+// LacpState is the LACP actor/partner port state (802.3ad)
+type LacpState uint8
+
+const (
+	LacpActivity        LacpState = 1 << 0 // active LACP
+	LacpTimeout         LacpState = 1 << 1 // short timeout (fast)
+	LacpAggregation     LacpState = 1 << 2 // aggregatable
+	LacpSynchronization LacpState = 1 << 3 // in sync
+	LacpCollecting      LacpState = 1 << 4
+	LacpDistributing    LacpState = 1 << 5
+	LacpDefaulted       LacpState = 1 << 6 // using the default partner info
+	LacpExpired         LacpState = 1 << 7
+)
+
+func (s LacpState) String() string {
+	names := []string{"activity", "timeout", "aggregating", "in_sync",
+		"collecting", "distributing", "defaulted", "expired"}
+	var flags []string
+	for i, name := range names {
+		if s&(1<<uint(i)) != 0 {
+			flags = append(flags, name)
+		}
+	}
+	return strings.Join(flags, ",")
+}
+
+// BondSlave is the state of a member of a bond
+type BondSlave struct {
+	Name             string
+	State            string    // active or backup
+	MiiStatus        string    // up, down, ...
+	LinkFailureCount uint32    // number of link failures
+	AggregatorId     uint16    // 802.3ad aggregator ID
+	ActorState       LacpState // 802.3ad actor port state
+	PartnerState     LacpState // 802.3ad partner port state
+}
+
+// newBond returns netlink.Bond built from `name' and `opts'
+func newBond(name string, opts *BondOptions) (*netlink.Bond, error) {
+	bond := netlink.NewLinkBond(netlink.LinkAttrs{Name: name})
+	if opts == nil {
+		return bond, nil
+	}
+	if opts.Mode != "" {
+		mode, ok := netlink.StringToBondModeMap[opts.Mode]
+		if !ok {
+			return nil, fmt.Errorf("unknown mode: %s", opts.Mode)
+		}
+		bond.Mode = mode
+	}
+	if opts.LacpRate != "" {
+		rate, ok := netlink.StringToBondLacpRateMap[opts.LacpRate]
+		if !ok {
+			return nil, fmt.Errorf("unknown lacp_rate: %s", opts.LacpRate)
+		}
+		bond.LacpRate = rate
+	}
+	if opts.XmitHashPolicy != "" {
+		policy, ok := netlink.StringToBondXmitHashPolicyMap[opts.XmitHashPolicy]
+		if !ok {
+			return nil, fmt.Errorf("unknown xmit_hash_policy: %s",
+				opts.XmitHashPolicy)
+		}
+		bond.XmitHashPolicy = policy
+	}
+	if opts.Miimon != 0 {
+		bond.Miimon = opts.Miimon
+	}
+	if opts.MinLinks != 0 {
+		bond.MinLinks = opts.MinLinks
+	}
+	return bond, nil
+}
+
+// BondAdd adds a bond interface whose name is `name'
+// in: name Name of the bond to be added
+//     opts Pointer to the bond attributes. nil for the defaults
+//     up Bring up `name' if true
+// return: 1. Pointer to Bond if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func BondAdd(name string, opts *BondOptions, up bool) (*Bond, error) {
+	return pkgHandle.BondAdd(name, opts, up)
+}
+
+// BondAdd adds a bond interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) BondAdd(name string, opts *BondOptions,
+	up bool) (*Bond, error) {
+	banner := fmt.Sprintf("BondAdd(%s): ", name)
+
+	l, err := newBond(name, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if err := h.nlh.LinkAdd(l); err != nil {
+		return nil, fmt.Errorf("%sLinkAdd(): %v", banner, err)
+	}
+	bond, err := h.BondGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if up {
+		return bond, bond.IfUp()
+	}
+	return bond, nil
+}
+
+// BondDelete deletes a bond whose name is `name'
+// in: name Name of the bond to be deleted
+// return: nil if success
+//         non-nil otherwise
+func BondDelete(name string) error {
+	return pkgHandle.BondDelete(name)
+}
+
+// BondDelete deletes a bond whose name is `name' from the network
+// namespace of `h'
+func (h *Handle) BondDelete(name string) error {
+	bond, err := h.BondGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(bond.Link); err != nil {
+		return fmt.Errorf("BondDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// BondGetByName returns a pointer to Bond if bond
+// whose name is `name' exists.
+// in: name Name of the bond to be examined
+// return: 1. Pointer to Bond if bond whose name is `name' exists
+//            nil otherwise
+//         2. nil if bond whose name is `name' exists
+//            non-nil otherwise
+func BondGetByName(name string) (*Bond, error) {
+	return pkgHandle.BondGetByName(name)
+}
+
+// BondGetByName returns a pointer to Bond if bond
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) BondGetByName(name string) (*Bond, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		switch l := l.(type) {
+		case *netlink.Bond:
+			return &Bond{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("BondGetByName(%s): not a bond", name)
+		}
+	} else {
+		return nil, fmt.Errorf("BondGetByName(%s): %v", name, err)
+	}
+}
+
+// BondGetByIndex returns a pointer to Bond if bond
+// whose ifindex is `i' exists
+// in: i Ifindex of the bond to be examined
+// return: 1. Pointer to Bond if bond whose ifindex is `i' exists
+//            nil otherwise
+//         2. nil if bond whose ifindex is `i' exists
+//            non-nil otherwise
+func BondGetByIndex(i int) (*Bond, error) {
+	return pkgHandle.BondGetByIndex(i)
+}
+
+// BondGetByIndex returns a pointer to Bond if bond
+// whose ifindex is `i' exists in the network namespace of `h'
+func (h *Handle) BondGetByIndex(i int) (*Bond, error) {
+	if l, err := h.nlh.LinkByIndex(i); err == nil {
+		switch l := l.(type) {
+		case *netlink.Bond:
+			return &Bond{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("BondGetByIndex(%d): not a bond", i)
+		}
+	} else {
+		return nil, fmt.Errorf("BondGetByIndex(%d): %v", i, err)
+	}
+}
+
+// BondList returns a slice of Bond
+// return: 1. Slice of Bond if success
+//         2. nil if success
+//            non-nil otherwise
+func BondList() ([]Bond, error) {
+	return pkgHandle.BondList()
+}
+
+// BondList returns a slice of Bond in the network namespace of `h'
+func (h *Handle) BondList() ([]Bond, error) {
+	var bonds []Bond
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("BondList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Bond); ok {
+			bonds = append(bonds, Bond{Link: l, h: h})
+		}
+	}
+	return bonds, nil
+}
+
+// BondIfExists returns true if bond `name' exists
+// return: 1. true if bond `name' exists
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func BondIfExists(name string) (bool, error) {
+	return pkgHandle.ifExists(name, &netlink.Bond{})
+}
+
+// BondIfExists returns true if bond `name' exists in the
+// network namespace of `h'
+func (h *Handle) BondIfExists(name string) (bool, error) {
+	return h.ifExists(name, &netlink.Bond{})
+}
+
+// Name returns the name of this bond
+func (bond *Bond) Name() string {
+	return bond.Link.Attrs().Name
+}
+
+// IfUp brings up this bond interface
+func (bond *Bond) IfUp() error {
+	return handleOf(bond.h).nlh.LinkSetUp(bond.Link)
+}
+
+// IfDown brings down this bond interface
+func (bond *Bond) IfDown() error {
+	return handleOf(bond.h).nlh.LinkSetDown(bond.Link)
+}
+
+// refresh re-reads the attributes of this bond
+func (bond *Bond) refresh() error {
+	l, err := handleOf(bond.h).nlh.LinkByIndex(bond.Link.Attrs().Index)
+	if err != nil {
+		return err
+	}
+	if l, ok := l.(*netlink.Bond); ok {
+		bond.Link = l
+		return nil
+	}
+	return fmt.Errorf("%s: not a bond", bond.Name())
+}
+
+// Mode returns the bonding mode of this bond (e.g. active-backup)
+func (bond *Bond) Mode() string {
+	return bond.Link.Mode.String()
+}
+
+// AddSlave enslaves interface `ifName' to this bond.
+// `ifName' is brought down first as the kernel requires.
+// in: ifName Name of the interface to be enslaved
+// return: nil if success
+//         non-nil otherwise
+func (bond *Bond) AddSlave(ifName string) error {
+	h := handleOf(bond.h)
+	banner := fmt.Sprintf("AddSlave(%s, %s): ", bond.Name(), ifName)
+
+	l, err := h.nlh.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("%sLinkByName(): %v", banner, err)
+	}
+	if err := h.nlh.LinkSetDown(l); err != nil {
+		return fmt.Errorf("%sLinkSetDown(): %v", banner, err)
+	}
+	if err := h.nlh.LinkSetMaster(l, bond.Link); err != nil {
+		return fmt.Errorf("%sLinkSetMaster(): %v", banner, err)
+	}
+	return nil
+}
+
+// DeleteSlave releases interface `ifName' from this bond
+// in: ifName Name of the interface to be released
+// return: nil if success
+//         non-nil otherwise
+func (bond *Bond) DeleteSlave(ifName string) error {
+	h := handleOf(bond.h)
+	banner := fmt.Sprintf("DeleteSlave(%s, %s): ", bond.Name(), ifName)
+
+	l, err := h.nlh.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("%sLinkByName(): %v", banner, err)
+	}
+	if l.Attrs().MasterIndex != bond.Link.Attrs().Index {
+		return fmt.Errorf("%snot a slave", banner)
+	}
+	if err := h.nlh.LinkSetNoMaster(l); err != nil {
+		return fmt.Errorf("%sLinkSetNoMaster(): %v", banner, err)
+	}
+	return nil
+}
+
+// Slaves returns the members of this bond and their states
+// return: 1. Slice of BondSlave if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (bond *Bond) Slaves() ([]BondSlave, error) {
+	var slaves []BondSlave
+
+	ll, err := handleOf(bond.h).nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("Slaves(%s): LinkList(): %v", bond.Name(), err)
+	}
+	for _, l := range ll {
+		if l.Attrs().MasterIndex != bond.Link.Attrs().Index {
+			continue
+		}
+		s := BondSlave{Name: l.Attrs().Name}
+		if bs, ok := l.Attrs().Slave.(*netlink.BondSlave); ok {
+			s.State = strings.ToLower(bs.State.String())
+			s.MiiStatus = strings.ToLower(bs.MiiStatus.String())
+			s.LinkFailureCount = bs.LinkFailureCount
+			s.AggregatorId = bs.AggregatorId
+			s.ActorState = LacpState(bs.AdActorOperPortState)
+			s.PartnerState = LacpState(bs.AdPartnerOperPortState)
+		}
+		slaves = append(slaves, s)
+	}
+	return slaves, nil
+}
+
+// ActiveSlave returns the name of the active slave of this bond
+// (active-backup, balance-tlb and balance-alb modes)
+// return: 1. Name of the active slave. "" if none
+//         2. nil if success
+//            non-nil otherwise
+func (bond *Bond) ActiveSlave() (string, error) {
+	if err := bond.refresh(); err != nil {
+		return "", fmt.Errorf("ActiveSlave(%s): %v", bond.Name(), err)
+	}
+	if bond.Link.ActiveSlave <= 0 {
+		return "", nil
+	}
+	name, err := handleOf(bond.h).IfName(bond.Link.ActiveSlave)
+	if err != nil {
+		return "", fmt.Errorf("ActiveSlave(%s): %v", bond.Name(), err)
+	}
+	return name, nil
+}
+
+// SetActiveSlave makes slave `ifName' the active slave of this bond
+// (active-backup, balance-tlb and balance-alb modes)
+// in: ifName Name of the slave
+// return: nil if success
+//         non-nil otherwise
+func (bond *Bond) SetActiveSlave(ifName string) error {
+	h := handleOf(bond.h)
+	banner := fmt.Sprintf("SetActiveSlave(%s, %s): ", bond.Name(), ifName)
+
+	index, err := h.IfIndex(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	req := newLinkRequest(0, bond.Link.Attrs().Index, "")
+	linkInfo, data := newLinkInfo("bond")
+	data.AddRtAttr(nl.IFLA_BOND_ACTIVE_SLAVE, nl.Uint32Attr(uint32(index)))
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	return nil
+}
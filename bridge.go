@@ -19,80 +19,160 @@ package iproute
 import (
 	"fmt"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"golang.org/x/sys/unix"
 	"syscall"
-	"unsafe"
-)
-
-const (
-	BRCTL_GET_VERSION = iota
-	BRCTL_GET_BRIDGES
-	BRCTL_ADD_BRIDGE
-	BRCTL_DEL_BRIDGE
 )
 
 type Bridge struct {
 	Link *netlink.Bridge
+	h    *Handle
 }
 
-func getBridgeSock() (int, error) {
-	return syscall.Socket(unix.AF_LOCAL, unix.SOCK_STREAM, 0)
+// BridgeOptions holds the bridge attributes. Nil fields are left
+// unchanged (kernel defaults at creation.) The time values are in
+// centiseconds (1/100 sec) as in ip-link(8).
+type BridgeOptions struct {
+	Stp               *bool        // STP on (true) or off (false)
+	ForwardDelay      *uint32      // forward_delay
+	HelloTime         *uint32      // hello_time
+	MaxAge            *uint32      // max_age
+	AgeingTime        *uint32      // ageing_time
+	Priority          *uint16      // priority
+	VlanFiltering     *bool        // vlan_filtering
+	MulticastSnooping *bool        // mcast_snooping
+	MulticastQuerier  *bool        // mcast_querier
+	MulticastRouter   *McastRouter // mcast_router
+	GroupFwdMask      *uint16      // group_fwd_mask
 }
 
-// bridgeModify adds or deletes a bridge
-// in: name Name of the bridge to be added or deleted
-//     op Add (true) to add a bridge whose name is `name'
-//        Delete (false) to delete a bridge whose name is `name'
-//     up Up (true) to bring up the bridge after addition
-// return: 1. Pointer to bridge if it is successfully added
-//            nil otherwise
-//         2. nil if success
-//            non-nil otherwise
-func bridgeModify(name string, op bool, up bool) (*Bridge, error) {
-	banner := fmt.Sprintf("BridgeAdd(%s): ", name)
-	var arg [3]uint64
-	var brName [unix.IFNAMSIZ]byte
-
-	s, err := getBridgeSock()
-	if err != nil {
-		fmt.Errorf("%ssocket(): %v\n", banner, err)
+// addBridgeOptions adds the IFLA_BR_* attributes in `opts' to `data'
+func addBridgeOptions(data *nl.RtAttr, opts *BridgeOptions) {
+	if opts == nil {
+		return
+	}
+	if opts.Stp != nil {
+		var state uint32
+		if *opts.Stp {
+			state = 1
+		}
+		data.AddRtAttr(nl.IFLA_BR_STP_STATE, nl.Uint32Attr(state))
+	}
+	if opts.ForwardDelay != nil {
+		data.AddRtAttr(nl.IFLA_BR_FORWARD_DELAY,
+			nl.Uint32Attr(*opts.ForwardDelay))
+	}
+	if opts.HelloTime != nil {
+		data.AddRtAttr(nl.IFLA_BR_HELLO_TIME, nl.Uint32Attr(*opts.HelloTime))
+	}
+	if opts.MaxAge != nil {
+		data.AddRtAttr(nl.IFLA_BR_MAX_AGE, nl.Uint32Attr(*opts.MaxAge))
+	}
+	if opts.AgeingTime != nil {
+		data.AddRtAttr(nl.IFLA_BR_AGEING_TIME, nl.Uint32Attr(*opts.AgeingTime))
 	}
-	defer syscall.Close(s)
+	if opts.Priority != nil {
+		data.AddRtAttr(nl.IFLA_BR_PRIORITY, nl.Uint16Attr(*opts.Priority))
+	}
+	if opts.VlanFiltering != nil {
+		data.AddRtAttr(nl.IFLA_BR_VLAN_FILTERING, boolAttr(*opts.VlanFiltering))
+	}
+	if opts.MulticastSnooping != nil {
+		data.AddRtAttr(nl.IFLA_BR_MCAST_SNOOPING,
+			boolAttr(*opts.MulticastSnooping))
+	}
+	if opts.MulticastQuerier != nil {
+		data.AddRtAttr(nl.IFLA_BR_MCAST_QUERIER,
+			boolAttr(*opts.MulticastQuerier))
+	}
+	if opts.MulticastRouter != nil {
+		data.AddRtAttr(nl.IFLA_BR_MCAST_ROUTER,
+			nl.Uint8Attr(uint8(*opts.MulticastRouter)))
+	}
+	if opts.GroupFwdMask != nil {
+		data.AddRtAttr(nl.IFLA_BR_GROUP_FWD_MASK,
+			nl.Uint16Attr(*opts.GroupFwdMask))
+	}
+}
 
-	copy(brName[:unix.IFNAMSIZ-1], name)
-	if op == Add {
-		arg[0] = BRCTL_ADD_BRIDGE
-	} else {
-		arg[0] = BRCTL_DEL_BRIDGE
-	}
-	arg[1] = uint64(uintptr(unsafe.Pointer(&brName)))
-	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(s),
-		unix.SIOCSIFBR, uintptr(unsafe.Pointer(&arg)))
-	if errno == 0 {
-		if op == Add {
-			if br, err := BridgeGetByName(name); err == nil {
-				if up {
-					return br, br.IfUp()
-				}
-			} else {
-				return nil, err
-			}
-		} else {
-			return nil, nil
+// parseBridgeOptions returns BridgeOptions built from the
+// IFLA_BR_* attributes in `data'
+func parseBridgeOptions(data []syscall.NetlinkRouteAttr) *BridgeOptions {
+	native := nl.NativeEndian()
+	opts := &BridgeOptions{}
+	for _, a := range data {
+		switch a.Attr.Type {
+		case nl.IFLA_BR_STP_STATE:
+			v := native.Uint32(a.Value[0:4]) != 0
+			opts.Stp = &v
+		case nl.IFLA_BR_FORWARD_DELAY:
+			v := native.Uint32(a.Value[0:4])
+			opts.ForwardDelay = &v
+		case nl.IFLA_BR_HELLO_TIME:
+			v := native.Uint32(a.Value[0:4])
+			opts.HelloTime = &v
+		case nl.IFLA_BR_MAX_AGE:
+			v := native.Uint32(a.Value[0:4])
+			opts.MaxAge = &v
+		case nl.IFLA_BR_AGEING_TIME:
+			v := native.Uint32(a.Value[0:4])
+			opts.AgeingTime = &v
+		case nl.IFLA_BR_PRIORITY:
+			v := native.Uint16(a.Value[0:2])
+			opts.Priority = &v
+		case nl.IFLA_BR_VLAN_FILTERING:
+			v := a.Value[0] != 0
+			opts.VlanFiltering = &v
+		case nl.IFLA_BR_MCAST_SNOOPING:
+			v := a.Value[0] != 0
+			opts.MulticastSnooping = &v
+		case nl.IFLA_BR_MCAST_QUERIER:
+			v := a.Value[0] != 0
+			opts.MulticastQuerier = &v
+		case nl.IFLA_BR_MCAST_ROUTER:
+			v := McastRouter(a.Value[0])
+			opts.MulticastRouter = &v
+		case nl.IFLA_BR_GROUP_FWD_MASK:
+			v := native.Uint16(a.Value[0:2])
+			opts.GroupFwdMask = &v
 		}
 	}
-	return nil, fmt.Errorf("%s%v\n", banner, errno)
+	return opts
 }
 
 // BridgeAdd adds a bridge whose name is `name'
 // in: name Name of the bridge to be added
+//     opts Pointer to the bridge attributes. nil for kernel defaults
 //     up Up (true) to bring up the bridge after addition
 // return: 1. Pointer to bridge if it is successfully added
 //            nil otherwise
 //         2. nil if success
 //            non-nil otherwise
-func BridgeAdd(name string, up bool) (*Bridge, error) {
-	return bridgeModify(name, Add, up)
+func BridgeAdd(name string, opts *BridgeOptions, up bool) (*Bridge, error) {
+	return pkgHandle.BridgeAdd(name, opts, up)
+}
+
+// BridgeAdd adds a bridge whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) BridgeAdd(name string, opts *BridgeOptions,
+	up bool) (*Bridge, error) {
+	banner := fmt.Sprintf("BridgeAdd(%s): ", name)
+
+	req := newLinkRequest(unix.NLM_F_CREATE|unix.NLM_F_EXCL, 0, name)
+	linkInfo, data := newLinkInfo("bridge")
+	addBridgeOptions(data, opts)
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return nil, fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	br, err := h.BridgeGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if up {
+		return br, br.IfUp()
+	}
+	return br, nil
 }
 
 // BridgeDelete deletes a bridge whose name is `name'
@@ -100,8 +180,14 @@ func BridgeAdd(name string, up bool) (*Bridge, error) {
 // return: nil if success
 //         non-nil otherwise
 func BridgeDelete(name string) error {
+	return pkgHandle.BridgeDelete(name)
+}
+
+// BridgeDelete deletes a bridge whose name is `name' from the
+// network namespace of `h'
+func (h *Handle) BridgeDelete(name string) error {
 	banner := fmt.Sprintf("BridgeDelete(%s): ", name)
-	br, err := BridgeGetByName(name)
+	br, err := h.BridgeGetByName(name)
 	if err != nil {
 		return fmt.Errorf("%sBridgeGetByName(): %v", banner, err)
 	}
@@ -109,8 +195,10 @@ func BridgeDelete(name string) error {
 	if err != nil {
 		return fmt.Errorf("%sLinkSetDown(): %v", banner, err)
 	}
-	_, err = bridgeModify(name, Del, Down)
-	return err
+	if err := h.nlh.LinkDel(br.Link); err != nil {
+		return fmt.Errorf("%sLinkDel(): %v", banner, err)
+	}
+	return nil
 }
 
 // BridgeGetByName returns a pointer to Bridge if bridge
@@ -121,10 +209,16 @@ func BridgeDelete(name string) error {
 //         2. nil if bridge whose name is `name' exists
 //            non-nil otherwise
 func BridgeGetByName(name string) (*Bridge, error) {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.BridgeGetByName(name)
+}
+
+// BridgeGetByName returns a pointer to Bridge if bridge
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) BridgeGetByName(name string) (*Bridge, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		switch l := l.(type) {
 		case *netlink.Bridge:
-			return &Bridge{Link: l}, nil
+			return &Bridge{Link: l, h: h}, nil
 		default:
 			return nil, fmt.Errorf("BridgeGetByName(%s): not a bridge", name)
 		}
@@ -141,10 +235,16 @@ func BridgeGetByName(name string) (*Bridge, error) {
 //         2. nil if bridge whose ifindex is `i' exists
 //            non-nil otherwise
 func BridgeGetByIndex(i int) (*Bridge, error) {
-	if l, err := netlink.LinkByIndex(i); err == nil {
+	return pkgHandle.BridgeGetByIndex(i)
+}
+
+// BridgeGetByIndex returns a pointer to Bridge if bridge
+// whose ifindex is `i' exists in the network namespace of `h'
+func (h *Handle) BridgeGetByIndex(i int) (*Bridge, error) {
+	if l, err := h.nlh.LinkByIndex(i); err == nil {
 		switch l := l.(type) {
 		case *netlink.Bridge:
-			return &Bridge{Link: l}, nil
+			return &Bridge{Link: l, h: h}, nil
 		default:
 			return nil, fmt.Errorf("BridgeGetByIndex(%d): not a bridge", i)
 		}
@@ -158,16 +258,21 @@ func BridgeGetByIndex(i int) (*Bridge, error) {
 //         2. nil if bridge whose ifindex is `i' exists
 //            non-nil otherwise
 func BridgeList() ([]Bridge, error) {
+	return pkgHandle.BridgeList()
+}
+
+// BridgeList returns a slice of Bridge in the network namespace of `h'
+func (h *Handle) BridgeList() ([]Bridge, error) {
 	banner := "BridgeList(): "
 	var brs []Bridge
 
-	ll, err := netlink.LinkList()
+	ll, err := h.nlh.LinkList()
 	if err != nil {
 		return nil, fmt.Errorf("%sLinkList(): %v", banner, err)
 	}
 	for _, l := range ll {
 		if l.Type() == "bridge" {
-			brs = append(brs, Bridge{Link: l.(*netlink.Bridge)})
+			brs = append(brs, Bridge{Link: l.(*netlink.Bridge), h: h})
 		}
 	}
 	return brs, nil
@@ -179,20 +284,31 @@ func BridgeList() ([]Bridge, error) {
 //         2. nil if bridge whose name is `name' exists
 //            non-nil otherwise
 func BridgeIfExists(name string) (bool, error) {
-	return ifExists(name, &netlink.Bridge{})
+	return pkgHandle.ifExists(name, &netlink.Bridge{})
+}
+
+// BridgeIfExists returns true if bridge `name' exists in the
+// network namespace of `h'
+func (h *Handle) BridgeIfExists(name string) (bool, error) {
+	return h.ifExists(name, &netlink.Bridge{})
 }
 
 // BridgeBindIf add interface `ifName' to bridge `brName'
 // return: nil if bridge whose name is `name' exists
 //         non-nil otherwise
 func BridgeBindIf(brName, ifName string) error {
+	return pkgHandle.BridgeBindIf(brName, ifName)
+}
+
+// BridgeBindIf add interface `ifName' to bridge `brName'
+// in the network namespace of `h'
+func (h *Handle) BridgeBindIf(brName, ifName string) error {
 	banner := fmt.Sprintf("BridgeBindIf(%s, %s): ", brName, ifName)
-	if br, err := BridgeGetByName(brName); err == nil {
+	if br, err := h.BridgeGetByName(brName); err == nil {
 		return br.BindIf(ifName)
 	} else {
 		return fmt.Errorf("%sBridgeGetByName(): %v", banner, err)
 	}
-	return nil
 }
 
 // Name returns the name of this bridge
@@ -202,25 +318,65 @@ func (br *Bridge) Name() string {
 
 // Ifup brings up this bridge interface
 func (br *Bridge) IfUp() error {
-	return netlink.LinkSetUp(br.Link)
+	return handleOf(br.h).nlh.LinkSetUp(br.Link)
 }
 
 // Ifup brings down this bridge interface
 // return: nil if the bridge whose name is `name' exists
 //         non-nil otherwise
 func (br *Bridge) IfDown() error {
-	return netlink.LinkSetDown(br.Link)
+	return handleOf(br.h).nlh.LinkSetDown(br.Link)
 }
 
 // BindIf adds interface `ifName' to this bridge
 // return: nil if success
 //         non-nil otherwise
 func (br *Bridge) BindIf(ifName string) error {
+	h := handleOf(br.h)
 	banner := fmt.Sprintf("BindIf(%s, %s): ", br.Name(), ifName)
-	if l, err := netlink.LinkByName(ifName); err == nil {
-		return netlink.LinkSetMaster(l, br.Link)
+	if l, err := h.nlh.LinkByName(ifName); err == nil {
+		return h.nlh.LinkSetMaster(l, br.Link)
 	} else {
 		return fmt.Errorf("%sLinkByName(): %v", banner, err)
 	}
+}
+
+// Options returns the current attributes of this bridge
+// return: 1. Pointer to BridgeOptions if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) Options() (*BridgeOptions, error) {
+	data, err := handleOf(br.h).linkInfoData(br.Link.Attrs().Index, false)
+	if err != nil {
+		return nil, fmt.Errorf("Options(%s): %v", br.Name(), err)
+	}
+	return parseBridgeOptions(data), nil
+}
+
+// SetOptions changes the attributes of this bridge. The attributes
+// whose values are nil in `opts' are not changed.
+// in: opts Pointer to the bridge attributes to be changed
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) SetOptions(opts *BridgeOptions) error {
+	h := handleOf(br.h)
+	banner := fmt.Sprintf("SetOptions(%s): ", br.Name())
+
+	req := newLinkRequest(0, br.Link.Attrs().Index, "")
+	linkInfo, data := newLinkInfo("bridge")
+	addBridgeOptions(data, opts)
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	//
+	// refresh the attributes in br.Link
+	//
+	if l, err := h.nlh.LinkByIndex(br.Link.Attrs().Index); err == nil {
+		if l, ok := l.(*netlink.Bridge); ok {
+			br.Link = l
+		}
+	}
 	return nil
 }
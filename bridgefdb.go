@@ -0,0 +1,258 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"net"
+	"time"
+)
+
+const (
+	userHz = 100 // USER_HZ: unit of the ages in NDA_CACHEINFO
+)
+
+// FdbEntry is an entry of the forwarding database of a bridge
+// (or of a VXLAN port of the bridge)
+type FdbEntry struct {
+	Mac       net.HardwareAddr
+	Vlan      int           // VLAN ID. 0 if none
+	Port      string        // Name of the bridge port (or the bridge)
+	Flags     int           // netlink.NTF_*
+	Static    bool          // true if added statically (not learned)
+	Permanent bool          // true if it is a local (permanent) entry
+	Age       time.Duration // time since the entry was last updated
+	Dst       net.IP        // remote VTEP (VXLAN port only)
+	Vni       int           // VNI (VXLAN port only). 0 if default
+}
+
+// fdbEntry returns FdbEntry converted from neighbor entry `n'
+func fdbEntry(n *netlink.Neigh, port string) FdbEntry {
+	return FdbEntry{
+		Mac:       n.HardwareAddr,
+		Vlan:      n.Vlan,
+		Port:      port,
+		Flags:     n.Flags,
+		Static:    n.State&(netlink.NUD_NOARP|netlink.NUD_PERMANENT) != 0,
+		Permanent: n.State&netlink.NUD_PERMANENT != 0,
+		Age:       time.Duration(n.Updated) * time.Second / userHz,
+		Dst:       n.IP,
+		Vni:       n.VNI,
+	}
+}
+
+// ports returns the map of ifindex to name of the ports of this bridge
+// and this bridge itself
+func (br *Bridge) ports() (map[int]string, error) {
+	ll, err := handleOf(br.h).nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("LinkList(): %v", err)
+	}
+	index := br.Link.Attrs().Index
+	ports := make(map[int]string)
+	for _, l := range ll {
+		if l.Attrs().Index == index || l.Attrs().MasterIndex == index {
+			ports[l.Attrs().Index] = l.Attrs().Name
+		}
+	}
+	return ports, nil
+}
+
+// FdbList returns the forwarding database of this bridge and its ports
+// (`bridge fdb show br <bridge>')
+// return: 1. Slice of FdbEntry if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) FdbList() ([]FdbEntry, error) {
+	banner := fmt.Sprintf("FdbList(%s): ", br.Name())
+
+	ports, err := br.ports()
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	nn, err := handleOf(br.h).nlh.NeighList(0, unix.AF_BRIDGE)
+	if err != nil {
+		return nil, fmt.Errorf("%sNeighList(): %v", banner, err)
+	}
+	var fdb []FdbEntry
+	for i := range nn {
+		if port, ok := ports[nn[i].LinkIndex]; ok {
+			fdb = append(fdb, fdbEntry(&nn[i], port))
+		}
+	}
+	return fdb, nil
+}
+
+// FdbAdd adds a static entry of `mac' on port `ifName' to this bridge
+// (`bridge fdb add <mac> dev <ifName> vlan <vlan> master static')
+// in: ifName Name of the bridge port
+//     mac MAC address
+//     vlan VLAN ID. 0 for none
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) FdbAdd(ifName string, mac net.HardwareAddr, vlan int) error {
+	return br.fdbModify(Add, ifName, mac, vlan)
+}
+
+// FdbDelete deletes the entry of `mac' on port `ifName' from this bridge
+// (`bridge fdb del <mac> dev <ifName> vlan <vlan> master')
+// in: ifName Name of the bridge port
+//     mac MAC address
+//     vlan VLAN ID. 0 for none
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) FdbDelete(ifName string, mac net.HardwareAddr, vlan int) error {
+	return br.fdbModify(Del, ifName, mac, vlan)
+}
+
+func (br *Bridge) fdbModify(add bool, ifName string,
+	mac net.HardwareAddr, vlan int) error {
+	h := handleOf(br.h)
+	banner := fmt.Sprintf("FdbDelete(%s, %s, %s): ", br.Name(), ifName, mac)
+	if add {
+		banner = fmt.Sprintf("FdbAdd(%s, %s, %s): ", br.Name(), ifName, mac)
+	}
+	l, self, err := br.port(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	n := &netlink.Neigh{
+		LinkIndex:    l.Attrs().Index,
+		Family:       unix.AF_BRIDGE,
+		Flags:        netlink.NTF_MASTER,
+		State:        netlink.NUD_NOARP,
+		HardwareAddr: mac,
+		Vlan:         vlan,
+	}
+	if self {
+		n.Flags = netlink.NTF_SELF
+	}
+	if add {
+		err = h.nlh.NeighAdd(n)
+	} else {
+		err = h.nlh.NeighDel(n)
+	}
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+// FdbFlush deletes the learned and static entries (not the permanent
+// ones) from this bridge
+// in: ifName Name of the bridge port. "" for all the ports
+//     vlan VLAN ID. 0 for all the VLANs
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) FdbFlush(ifName string, vlan int) error {
+	h := handleOf(br.h)
+	banner := fmt.Sprintf("FdbFlush(%s, %s, %d): ", br.Name(), ifName, vlan)
+
+	index := 0
+	if ifName != "" {
+		l, _, err := br.port(ifName)
+		if err != nil {
+			return fmt.Errorf("%s%v", banner, err)
+		}
+		index = l.Attrs().Index
+	}
+	nn, err := h.nlh.NeighList(index, unix.AF_BRIDGE)
+	if err != nil {
+		return fmt.Errorf("%sNeighList(): %v", banner, err)
+	}
+	for _, n := range nn {
+		if n.MasterIndex != br.Link.Attrs().Index ||
+			n.State&netlink.NUD_PERMANENT != 0 ||
+			(vlan != 0 && n.Vlan != vlan) {
+			continue
+		}
+		n.Flags = netlink.NTF_MASTER
+		n.IP = nil
+		n.MasterIndex = 0
+		if err := h.nlh.NeighDel(&n); err != nil && !IsNotFound(err) {
+			return fmt.Errorf("%s%s: %v", banner, n.HardwareAddr, err)
+		}
+	}
+	return nil
+}
+
+// FdbAddRemote adds remote VTEP `dst' of `mac' to VXLAN port `ifName'
+// of this bridge. Multiple VTEPs can be added to the same MAC address
+// (e.g. 00:00:00:00:00:00 for BUM traffic.)
+// (`bridge fdb append <mac> dev <ifName> dst <dst> vni <vni> self permanent')
+// in: ifName Name of the VXLAN port
+//     mac MAC address
+//     dst IP address of the remote VTEP
+//     vni VNI. 0 for the default VNI of `ifName'
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) FdbAddRemote(ifName string, mac net.HardwareAddr,
+	dst net.IP, vni int) error {
+	return br.fdbRemoteModify(Add, ifName, mac, dst, vni)
+}
+
+// FdbDeleteRemote deletes remote VTEP `dst' of `mac' from VXLAN port
+// `ifName' of this bridge
+// in: ifName Name of the VXLAN port
+//     mac MAC address
+//     dst IP address of the remote VTEP
+//     vni VNI. 0 for the default VNI of `ifName'
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) FdbDeleteRemote(ifName string, mac net.HardwareAddr,
+	dst net.IP, vni int) error {
+	return br.fdbRemoteModify(Del, ifName, mac, dst, vni)
+}
+
+func (br *Bridge) fdbRemoteModify(add bool, ifName string,
+	mac net.HardwareAddr, dst net.IP, vni int) error {
+	h := handleOf(br.h)
+	banner := fmt.Sprintf("FdbDeleteRemote(%s, %s, %s, %s): ",
+		br.Name(), ifName, mac, dst)
+	if add {
+		banner = fmt.Sprintf("FdbAddRemote(%s, %s, %s, %s): ",
+			br.Name(), ifName, mac, dst)
+	}
+	l, _, err := br.port(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	if l.Type() != "vxlan" {
+		return fmt.Errorf("%snot a VXLAN port", banner)
+	}
+	n := &netlink.Neigh{
+		LinkIndex:    l.Attrs().Index,
+		Family:       unix.AF_BRIDGE,
+		Flags:        netlink.NTF_SELF,
+		State:        netlink.NUD_NOARP | netlink.NUD_PERMANENT,
+		IP:           dst,
+		HardwareAddr: mac,
+		VNI:          vni,
+	}
+	if add {
+		err = h.nlh.NeighAppend(n)
+	} else {
+		err = h.nlh.NeighDel(n)
+	}
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"net"
+	"time"
+)
+
+// McastRouter is the multicast router mode of a bridge or
+// a bridge port (MDB_RTR_TYPE_*)
+type McastRouter uint8
+
+const (
+	McastRouterDisabled  McastRouter = 0 // never a router port
+	McastRouterTempQuery McastRouter = 1 // learned from the queries
+	McastRouterPerm      McastRouter = 2 // always a router port
+	McastRouterTemp      McastRouter = 3 // port only: temporary
+)
+
+//
+// linux/if_bridge.h
+//
+const (
+	mdbaMdb            = 1 // MDBA_MDB
+	mdbaRouter         = 2 // MDBA_ROUTER
+	mdbaMdbEntry       = 1 // MDBA_MDB_ENTRY
+	mdbaMdbEntryInfo   = 1 // MDBA_MDB_ENTRY_INFO
+	mdbaMdbEattrTimer  = 1 // MDBA_MDB_EATTR_TIMER
+	mdbaMdbEattrSource = 4 // MDBA_MDB_EATTR_SOURCE
+	mdbaRouterPort     = 1 // MDBA_ROUTER_PORT
+	mdbaSetEntry       = 1 // MDBA_SET_ENTRY
+	mdbaSetEntryAttrs  = 2 // MDBA_SET_ENTRY_ATTRS
+	mdbeAttrSource     = 1 // MDBE_ATTR_SOURCE
+	mdbTemporary       = 0 // MDB_TEMPORARY
+	mdbPermanent       = 1 // MDB_PERMANENT
+	sizeofBrPortMsg    = 8 // sizeof(struct br_port_msg)
+	sizeofBrMdbEntry   = 28
+)
+
+// MdbEntry is an entry of the multicast database of a bridge
+type MdbEntry struct {
+	Group     net.IP        // multicast group address
+	Port      string        // Name of the bridge port (or the bridge)
+	Vlan      uint16        // VLAN ID. 0 if none
+	Permanent bool          // true if permanent, false if temporary
+	Source    net.IP        // source address (SSM). nil if (*, G)
+	Flags     uint8         // MDB_FLAGS_*
+	Timer     time.Duration // time until the entry expires
+}
+
+// brPortMsg returns struct br_port_msg for bridge `ifindex'
+func brPortMsg(ifindex int) []byte {
+	b := make([]byte, sizeofBrPortMsg)
+	b[0] = unix.AF_BRIDGE
+	nl.NativeEndian().PutUint32(b[4:8], uint32(ifindex))
+	return b
+}
+
+// brMdbEntry returns struct br_mdb_entry
+func brMdbEntry(ifindex int, state uint8, vid uint16, group net.IP) []byte {
+	native := nl.NativeEndian()
+	b := make([]byte, sizeofBrMdbEntry)
+	native.PutUint32(b[0:4], uint32(ifindex))
+	b[4] = state
+	native.PutUint16(b[6:8], vid)
+	if ip4 := group.To4(); ip4 != nil {
+		copy(b[8:12], ip4)
+		binary.BigEndian.PutUint16(b[24:26], unix.ETH_P_IP)
+	} else {
+		copy(b[8:24], group.To16())
+		binary.BigEndian.PutUint16(b[24:26], unix.ETH_P_IPV6)
+	}
+	return b
+}
+
+// parseMdbEntryInfo parses MDBA_MDB_ENTRY_INFO
+// return: 1. MdbEntry (Port is not set)
+//         2. ifindex of the port
+func parseMdbEntryInfo(b []byte) (MdbEntry, int) {
+	native := nl.NativeEndian()
+	var e MdbEntry
+
+	if len(b) < sizeofBrMdbEntry {
+		return e, 0
+	}
+	ifindex := int(native.Uint32(b[0:4]))
+	e.Permanent = b[4] == mdbPermanent
+	e.Flags = b[5]
+	e.Vlan = native.Uint16(b[6:8])
+	switch binary.BigEndian.Uint16(b[24:26]) {
+	case unix.ETH_P_IP:
+		e.Group = net.IP(append([]byte{}, b[8:12]...))
+	case unix.ETH_P_IPV6:
+		e.Group = net.IP(append([]byte{}, b[8:24]...))
+	}
+	attrs, err := nl.ParseRouteAttr(b[sizeofBrMdbEntry:])
+	if err != nil {
+		return e, ifindex
+	}
+	for _, a := range attrs {
+		switch a.Attr.Type & nl.NLA_TYPE_MASK {
+		case mdbaMdbEattrTimer:
+			e.Timer = time.Duration(native.Uint32(a.Value[0:4])) *
+				time.Second / userHz
+		case mdbaMdbEattrSource:
+			e.Source = net.IP(append([]byte{}, a.Value...))
+		}
+	}
+	return e, ifindex
+}
+
+// mdbDump dumps the multicast database of this bridge
+// return: 1. Slice of MDBA_MDB_ENTRY_INFO
+//         2. Slice of ifindex of the router ports
+//         3. nil if success
+//            non-nil otherwise
+func (br *Bridge) mdbDump() ([][]byte, []int, error) {
+	var (
+		infos   [][]byte
+		routers []int
+	)
+	req := nl.NewNetlinkRequest(unix.RTM_GETMDB, unix.NLM_F_DUMP)
+	req.AddData(rawData(brPortMsg(0)))
+	//
+	// the kernel replies the dump with RTM_GETMDB (not RTM_NEWMDB)
+	//
+	msgs, err := handleOf(br.h).execute(req, unix.NETLINK_ROUTE, unix.RTM_GETMDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	index := br.Link.Attrs().Index
+	for _, m := range msgs {
+		if len(m) < sizeofBrPortMsg ||
+			int(nl.NativeEndian().Uint32(m[4:8])) != index {
+			continue
+		}
+		attrs, err := nl.ParseRouteAttr(m[sizeofBrPortMsg:])
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range attrs {
+			nested, err := nl.ParseRouteAttr(a.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch a.Attr.Type & nl.NLA_TYPE_MASK {
+			case mdbaMdb:
+				for _, ent := range nested {
+					if ent.Attr.Type&nl.NLA_TYPE_MASK != mdbaMdbEntry {
+						continue
+					}
+					ii, err := nl.ParseRouteAttr(ent.Value)
+					if err != nil {
+						return nil, nil, err
+					}
+					for _, i := range ii {
+						if i.Attr.Type&nl.NLA_TYPE_MASK == mdbaMdbEntryInfo {
+							infos = append(infos, i.Value)
+						}
+					}
+				}
+			case mdbaRouter:
+				for _, r := range nested {
+					if r.Attr.Type&nl.NLA_TYPE_MASK == mdbaRouterPort {
+						routers = append(routers,
+							int(nl.NativeEndian().Uint32(r.Value[0:4])))
+					}
+				}
+			}
+		}
+	}
+	return infos, routers, nil
+}
+
+// MdbList returns the multicast database of this bridge
+// (`bridge mdb show dev <bridge>')
+// return: 1. Slice of MdbEntry if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) MdbList() ([]MdbEntry, error) {
+	banner := fmt.Sprintf("MdbList(%s): ", br.Name())
+
+	ports, err := br.ports()
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	infos, _, err := br.mdbDump()
+	if err != nil {
+		return nil, fmt.Errorf("%sRTM_GETMDB: %v", banner, err)
+	}
+	var mdb []MdbEntry
+	for _, info := range infos {
+		e, ifindex := parseMdbEntryInfo(info)
+		e.Port = ports[ifindex]
+		mdb = append(mdb, e)
+	}
+	return mdb, nil
+}
+
+// MdbRouterPorts returns the names of the multicast router ports
+// of this bridge
+// return: 1. Slice of the port names if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) MdbRouterPorts() ([]string, error) {
+	banner := fmt.Sprintf("MdbRouterPorts(%s): ", br.Name())
+
+	ports, err := br.ports()
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	_, routers, err := br.mdbDump()
+	if err != nil {
+		return nil, fmt.Errorf("%sRTM_GETMDB: %v", banner, err)
+	}
+	var names []string
+	for _, i := range routers {
+		names = append(names, ports[i])
+	}
+	return names, nil
+}
+
+// MdbAdd adds group `group' on port `ifName' to the multicast database
+// of this bridge
+// (`bridge mdb add dev <bridge> port <ifName> grp <group>
+//  [src <source>] [permanent] [vid <vlan>]')
+// in: ifName Name of the bridge port
+//     group Multicast group address
+//     vlan VLAN ID. 0 for none
+//     permanent true for a permanent entry, false for a temporary one
+//     source Source address (SSM). nil for (*, G)
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) MdbAdd(ifName string, group net.IP, vlan uint16,
+	permanent bool, source net.IP) error {
+	state := uint8(mdbTemporary)
+	if permanent {
+		state = mdbPermanent
+	}
+	banner := fmt.Sprintf("MdbAdd(%s, %s, %s): ", br.Name(), ifName, group)
+	err := br.mdbModify(unix.RTM_NEWMDB, unix.NLM_F_CREATE|unix.NLM_F_EXCL,
+		ifName, group, vlan, state, source)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+// MdbDelete deletes group `group' on port `ifName' from the multicast
+// database of this bridge
+// in: ifName Name of the bridge port
+//     group Multicast group address
+//     vlan VLAN ID. 0 for none
+//     source Source address (SSM). nil for (*, G)
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) MdbDelete(ifName string, group net.IP, vlan uint16,
+	source net.IP) error {
+	banner := fmt.Sprintf("MdbDelete(%s, %s, %s): ", br.Name(), ifName, group)
+	err := br.mdbModify(unix.RTM_DELMDB, 0, ifName, group, vlan,
+		mdbTemporary, source)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+func (br *Bridge) mdbModify(cmd, flags int, ifName string, group net.IP,
+	vlan uint16, state uint8, source net.IP) error {
+	l, _, err := br.port(ifName)
+	if err != nil {
+		return err
+	}
+	req := nl.NewNetlinkRequest(cmd, flags|unix.NLM_F_ACK)
+	req.AddData(rawData(brPortMsg(br.Link.Attrs().Index)))
+	req.AddData(nl.NewRtAttr(mdbaSetEntry,
+		brMdbEntry(l.Attrs().Index, state, vlan, group)))
+	if source != nil {
+		src := source.To4()
+		if src == nil {
+			src = source.To16()
+		}
+		attrs := nl.NewRtAttr(mdbaSetEntryAttrs|unix.NLA_F_NESTED, nil)
+		attrs.AddRtAttr(mdbeAttrSource, src)
+		req.AddData(attrs)
+	}
+	_, err = handleOf(br.h).execute(req, unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+// MulticastSnooping returns true if IGMP/MLD snooping is enabled on
+// this bridge
+// return: 1. true if snooping is enabled
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) MulticastSnooping() (bool, error) {
+	opts, err := br.Options()
+	if err != nil {
+		return false, err
+	}
+	return opts.MulticastSnooping != nil && *opts.MulticastSnooping, nil
+}
+
+// SetMulticastSnooping enables (on == true) or disables (on == false)
+// IGMP/MLD snooping on this bridge
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) SetMulticastSnooping(on bool) error {
+	return br.SetOptions(&BridgeOptions{MulticastSnooping: &on})
+}
+
+// MulticastQuerier returns true if this bridge acts as the IGMP/MLD
+// querier
+// return: 1. true if the querier is enabled
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) MulticastQuerier() (bool, error) {
+	opts, err := br.Options()
+	if err != nil {
+		return false, err
+	}
+	return opts.MulticastQuerier != nil && *opts.MulticastQuerier, nil
+}
+
+// SetMulticastQuerier enables (on == true) or disables (on == false)
+// the IGMP/MLD querier of this bridge
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) SetMulticastQuerier(on bool) error {
+	return br.SetOptions(&BridgeOptions{MulticastQuerier: &on})
+}
+
+// MulticastRouter returns the multicast router mode of this bridge
+// return: 1. Multicast router mode
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) MulticastRouter() (McastRouter, error) {
+	opts, err := br.Options()
+	if err != nil {
+		return McastRouterDisabled, err
+	}
+	if opts.MulticastRouter == nil {
+		return McastRouterDisabled,
+			fmt.Errorf("MulticastRouter(%s): no IFLA_BR_MCAST_ROUTER", br.Name())
+	}
+	return *opts.MulticastRouter, nil
+}
+
+// SetMulticastRouter sets the multicast router mode of this bridge
+// in: mode McastRouterDisabled, McastRouterTempQuery or McastRouterPerm
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) SetMulticastRouter(mode McastRouter) error {
+	return br.SetOptions(&BridgeOptions{MulticastRouter: &mode})
+}
+
+// MulticastRouter returns the multicast router mode of this bridge port
+// return: 1. Multicast router mode
+//         2. nil if success
+//            non-nil otherwise
+func (p *BridgePort) MulticastRouter() (McastRouter, error) {
+	opts, err := p.Options()
+	if err != nil {
+		return McastRouterDisabled, err
+	}
+	if opts.MulticastRouter == nil {
+		return McastRouterDisabled, fmt.Errorf(
+			"MulticastRouter(%s): no IFLA_BRPORT_MULTICAST_ROUTER", p.Name())
+	}
+	return *opts.MulticastRouter, nil
+}
+
+// SetMulticastRouter sets the multicast router mode of this bridge port
+// in: mode McastRouterDisabled, McastRouterTempQuery, McastRouterPerm
+//          or McastRouterTemp
+// return: nil if success
+//         non-nil otherwise
+func (p *BridgePort) SetMulticastRouter(mode McastRouter) error {
+	return p.SetOptions(&BridgePortOptions{MulticastRouter: &mode})
+}
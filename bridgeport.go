@@ -0,0 +1,282 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+// StpState is the STP state of a bridge port (BR_STATE_*)
+type StpState uint8
+
+const (
+	StpDisabled   StpState = 0
+	StpListening  StpState = 1
+	StpLearning   StpState = 2
+	StpForwarding StpState = 3
+	StpBlocking   StpState = 4
+)
+
+func (s StpState) String() string {
+	switch s {
+	case StpDisabled:
+		return "disabled"
+	case StpListening:
+		return "listening"
+	case StpLearning:
+		return "learning"
+	case StpForwarding:
+		return "forwarding"
+	case StpBlocking:
+		return "blocking"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(s))
+	}
+}
+
+// BridgePort is an interface bound to a bridge
+type BridgePort struct {
+	Link netlink.Link
+	h    *Handle
+}
+
+// BridgePortOptions holds the bridge port attributes. Nil fields are
+// left unchanged.
+type BridgePortOptions struct {
+	Cost            *uint32      // path cost
+	Priority        *uint16      // port priority
+	Learning        *bool        // learn the source MAC addresses
+	UnicastFlood    *bool        // flood unknown unicast
+	MulticastFlood  *bool        // flood unknown multicast
+	BroadcastFlood  *bool        // flood broadcast
+	Hairpin         *bool        // send back the frames to the receiving port
+	Isolated        *bool        // do not forward to the other isolated ports
+	Guard           *bool        // BPDU guard
+	RootBlock       *bool        // do not become the root port
+	FastLeave       *bool        // leave the group on IGMP/MLD leave at once
+	NeighSuppress   *bool        // ARP/ND suppression
+	MulticastRouter *McastRouter // multicast router port mode
+}
+
+// addBridgePortOptions adds the IFLA_BRPORT_* attributes in `opts'
+// to `data'
+func addBridgePortOptions(data *nl.RtAttr, opts *BridgePortOptions) {
+	if opts == nil {
+		return
+	}
+	if opts.Cost != nil {
+		data.AddRtAttr(nl.IFLA_BRPORT_COST, nl.Uint32Attr(*opts.Cost))
+	}
+	if opts.Priority != nil {
+		data.AddRtAttr(nl.IFLA_BRPORT_PRIORITY, nl.Uint16Attr(*opts.Priority))
+	}
+	if opts.MulticastRouter != nil {
+		data.AddRtAttr(nl.IFLA_BRPORT_MULTICAST_ROUTER,
+			nl.Uint8Attr(uint8(*opts.MulticastRouter)))
+	}
+	flags := []struct {
+		t uint16
+		v *bool
+	}{
+		{nl.IFLA_BRPORT_LEARNING, opts.Learning},
+		{nl.IFLA_BRPORT_UNICAST_FLOOD, opts.UnicastFlood},
+		{nl.IFLA_BRPORT_MCAST_FLOOD, opts.MulticastFlood},
+		{nl.IFLA_BRPORT_BCAST_FLOOD, opts.BroadcastFlood},
+		{nl.IFLA_BRPORT_MODE, opts.Hairpin},
+		{nl.IFLA_BRPORT_ISOLATED, opts.Isolated},
+		{nl.IFLA_BRPORT_GUARD, opts.Guard},
+		{nl.IFLA_BRPORT_PROTECT, opts.RootBlock},
+		{nl.IFLA_BRPORT_FAST_LEAVE, opts.FastLeave},
+		{nl.IFLA_BRPORT_NEIGH_SUPPRESS, opts.NeighSuppress},
+	}
+	for _, f := range flags {
+		if f.v != nil {
+			data.AddRtAttr(int(f.t), boolAttr(*f.v))
+		}
+	}
+}
+
+// parseBridgePortOptions returns BridgePortOptions built from the
+// IFLA_BRPORT_* attributes in `data'
+func parseBridgePortOptions(data []syscall.NetlinkRouteAttr) *BridgePortOptions {
+	native := nl.NativeEndian()
+	opts := &BridgePortOptions{}
+	for _, a := range data {
+		var p **bool
+		switch a.Attr.Type {
+		case nl.IFLA_BRPORT_COST:
+			v := native.Uint32(a.Value[0:4])
+			opts.Cost = &v
+		case nl.IFLA_BRPORT_PRIORITY:
+			v := native.Uint16(a.Value[0:2])
+			opts.Priority = &v
+		case nl.IFLA_BRPORT_MULTICAST_ROUTER:
+			v := McastRouter(a.Value[0])
+			opts.MulticastRouter = &v
+		case nl.IFLA_BRPORT_LEARNING:
+			p = &opts.Learning
+		case nl.IFLA_BRPORT_UNICAST_FLOOD:
+			p = &opts.UnicastFlood
+		case nl.IFLA_BRPORT_MCAST_FLOOD:
+			p = &opts.MulticastFlood
+		case nl.IFLA_BRPORT_BCAST_FLOOD:
+			p = &opts.BroadcastFlood
+		case nl.IFLA_BRPORT_MODE:
+			p = &opts.Hairpin
+		case nl.IFLA_BRPORT_ISOLATED:
+			p = &opts.Isolated
+		case nl.IFLA_BRPORT_GUARD:
+			p = &opts.Guard
+		case nl.IFLA_BRPORT_PROTECT:
+			p = &opts.RootBlock
+		case nl.IFLA_BRPORT_FAST_LEAVE:
+			p = &opts.FastLeave
+		case nl.IFLA_BRPORT_NEIGH_SUPPRESS:
+			p = &opts.NeighSuppress
+		}
+		if p != nil {
+			v := a.Value[0] != 0
+			*p = &v
+		}
+	}
+	return opts
+}
+
+// BridgePortGetByName returns a pointer to BridgePort if interface
+// `name' is bound to a bridge
+// in: name Name of the interface
+// return: 1. Pointer to BridgePort if `name' is bound to a bridge
+//            nil otherwise
+//         2. nil if `name' is bound to a bridge
+//            non-nil otherwise
+func BridgePortGetByName(name string) (*BridgePort, error) {
+	return pkgHandle.BridgePortGetByName(name)
+}
+
+// BridgePortGetByName returns a pointer to BridgePort if interface
+// `name' is bound to a bridge in the network namespace of `h'
+func (h *Handle) BridgePortGetByName(name string) (*BridgePort, error) {
+	banner := fmt.Sprintf("BridgePortGetByName(%s): ", name)
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if l.Attrs().MasterIndex == 0 {
+		return nil, fmt.Errorf("%snot bound to a bridge", banner)
+	}
+	if _, err := h.BridgeGetByIndex(l.Attrs().MasterIndex); err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	return &BridgePort{Link: l, h: h}, nil
+}
+
+// BindPort adds interface `ifName' to this bridge and returns it
+// as BridgePort
+// in: ifName Name of the interface to be added
+// return: 1. Pointer to BridgePort if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) BindPort(ifName string) (*BridgePort, error) {
+	if err := br.BindIf(ifName); err != nil {
+		return nil, err
+	}
+	return handleOf(br.h).BridgePortGetByName(ifName)
+}
+
+// Ports returns the interfaces bound to this bridge
+// return: 1. Slice of BridgePort if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) Ports() ([]BridgePort, error) {
+	h := handleOf(br.h)
+	var ports []BridgePort
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("Ports(%s): LinkList(): %v", br.Name(), err)
+	}
+	for _, l := range ll {
+		if l.Attrs().MasterIndex == br.Link.Attrs().Index {
+			ports = append(ports, BridgePort{Link: l, h: h})
+		}
+	}
+	return ports, nil
+}
+
+// Name returns the name of this bridge port
+func (p *BridgePort) Name() string {
+	return p.Link.Attrs().Name
+}
+
+// Bridge returns the bridge this port is bound to
+// return: 1. Pointer to Bridge if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (p *BridgePort) Bridge() (*Bridge, error) {
+	return handleOf(p.h).BridgeGetByIndex(p.Link.Attrs().MasterIndex)
+}
+
+// Options returns the current attributes of this bridge port
+// return: 1. Pointer to BridgePortOptions if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (p *BridgePort) Options() (*BridgePortOptions, error) {
+	data, err := handleOf(p.h).linkInfoData(p.Link.Attrs().Index, true)
+	if err != nil {
+		return nil, fmt.Errorf("Options(%s): %v", p.Name(), err)
+	}
+	return parseBridgePortOptions(data), nil
+}
+
+// SetOptions changes the attributes of this bridge port. The attributes
+// whose values are nil in `opts' are not changed.
+// in: opts Pointer to the bridge port attributes to be changed
+// return: nil if success
+//         non-nil otherwise
+func (p *BridgePort) SetOptions(opts *BridgePortOptions) error {
+	req := newLinkRequest(0, p.Link.Attrs().Index, "")
+	linkInfo, data := newSlaveLinkInfo("bridge")
+	addBridgePortOptions(data, opts)
+	req.AddData(linkInfo)
+	if _, err := handleOf(p.h).execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return fmt.Errorf("SetOptions(%s): RTM_NEWLINK: %v", p.Name(), err)
+	}
+	return nil
+}
+
+// StpState returns the current STP state of this bridge port
+// return: 1. STP state
+//         2. nil if success
+//            non-nil otherwise
+func (p *BridgePort) StpState() (StpState, error) {
+	data, err := handleOf(p.h).linkInfoData(p.Link.Attrs().Index, true)
+	if err != nil {
+		return StpDisabled, fmt.Errorf("StpState(%s): %v", p.Name(), err)
+	}
+	if a := attrByType(data, nl.IFLA_BRPORT_STATE); a != nil {
+		return StpState(a.Value[0]), nil
+	}
+	return StpDisabled, fmt.Errorf("StpState(%s): no IFLA_BRPORT_STATE", p.Name())
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"sort"
+)
+
+// BridgeVlan is an entry of the VLAN table of a bridge port
+// (or the bridge itself)
+type BridgeVlan struct {
+	Vid      uint16 // VLAN ID
+	Pvid     bool   // true if Vid is the PVID (ingress untagged frames)
+	Untagged bool   // true if egress frames are untagged
+}
+
+// BridgeVlanList returns the VLAN tables of all the bridges and
+// bridge ports (`bridge vlan show')
+// return: 1. Map of interface name to its VLAN table if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func BridgeVlanList() (map[string][]BridgeVlan, error) {
+	return pkgHandle.BridgeVlanList()
+}
+
+// BridgeVlanList returns the VLAN tables of all the bridges and
+// bridge ports in the network namespace of `h'
+func (h *Handle) BridgeVlanList() (map[string][]BridgeVlan, error) {
+	return h.bridgeVlanList(func(l netlink.Link) bool { return true })
+}
+
+// bridgeVlanList returns the VLAN tables of the interfaces for which
+// `match' returns true
+func (h *Handle) bridgeVlanList(
+	match func(l netlink.Link) bool) (map[string][]BridgeVlan, error) {
+	banner := "BridgeVlanList(): "
+
+	vlans, err := h.nlh.BridgeVlanList()
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	ret := make(map[string][]BridgeVlan)
+	for index, infos := range vlans {
+		l, err := h.nlh.LinkByIndex(int(index))
+		if err != nil {
+			if IsNotFound(err) {
+				continue // deleted after the dump
+			}
+			return nil, fmt.Errorf("%sLinkByIndex(%d): %v", banner, index, err)
+		}
+		if !match(l) {
+			continue
+		}
+		var tbl []BridgeVlan
+		for _, info := range infos {
+			tbl = append(tbl, BridgeVlan{
+				Vid:      info.Vid,
+				Pvid:     info.PortVID(),
+				Untagged: info.EngressUntag(),
+			})
+		}
+		sort.Slice(tbl, func(i, j int) bool { return tbl[i].Vid < tbl[j].Vid })
+		ret[l.Attrs().Name] = tbl
+	}
+	return ret, nil
+}
+
+// BridgeVlanAdd adds VLAN `vid' to port `ifName' of bridge `brName'
+// in: brName Name of the bridge
+//     ifName Name of the bridge port or the bridge itself
+//     vid VLAN ID
+//     pvid true to make `vid' the PVID of `ifName'
+//     untagged true to send the frames of `vid' untagged
+// return: nil if success
+//         non-nil otherwise
+func BridgeVlanAdd(brName, ifName string, vid uint16, pvid, untagged bool) error {
+	return pkgHandle.BridgeVlanAdd(brName, ifName, vid, pvid, untagged)
+}
+
+// BridgeVlanAdd adds VLAN `vid' to port `ifName' of bridge `brName'
+// in the network namespace of `h'
+func (h *Handle) BridgeVlanAdd(brName, ifName string, vid uint16,
+	pvid, untagged bool) error {
+	banner := fmt.Sprintf("BridgeVlanAdd(%s, %s): ", brName, ifName)
+	if br, err := h.BridgeGetByName(brName); err == nil {
+		return br.VlanAdd(ifName, vid, pvid, untagged)
+	} else {
+		return fmt.Errorf("%sBridgeGetByName(): %v", banner, err)
+	}
+}
+
+// BridgeVlanDelete deletes VLAN `vid' from port `ifName' of
+// bridge `brName'
+// in: brName Name of the bridge
+//     ifName Name of the bridge port or the bridge itself
+//     vid VLAN ID
+// return: nil if success
+//         non-nil otherwise
+func BridgeVlanDelete(brName, ifName string, vid uint16) error {
+	return pkgHandle.BridgeVlanDelete(brName, ifName, vid)
+}
+
+// BridgeVlanDelete deletes VLAN `vid' from port `ifName' of
+// bridge `brName' in the network namespace of `h'
+func (h *Handle) BridgeVlanDelete(brName, ifName string, vid uint16) error {
+	banner := fmt.Sprintf("BridgeVlanDelete(%s, %s): ", brName, ifName)
+	if br, err := h.BridgeGetByName(brName); err == nil {
+		return br.VlanDelete(ifName, vid)
+	} else {
+		return fmt.Errorf("%sBridgeGetByName(): %v", banner, err)
+	}
+}
+
+// port returns the link of `ifName' if it is a port of this bridge
+// or this bridge itself
+// return: 1. Link of `ifName' if success
+//            nil otherwise
+//         2. true if `ifName' is this bridge
+//            false otherwise
+//         3. nil if success
+//            non-nil otherwise
+func (br *Bridge) port(ifName string) (netlink.Link, bool, error) {
+	if ifName == br.Name() {
+		return br.Link, true, nil
+	}
+	l, err := handleOf(br.h).nlh.LinkByName(ifName)
+	if err != nil {
+		return nil, false, fmt.Errorf("LinkByName(): %v", err)
+	}
+	if l.Attrs().MasterIndex != br.Link.Attrs().Index {
+		return nil, false, fmt.Errorf("not a port of %s", br.Name())
+	}
+	return l, false, nil
+}
+
+// VlanAdd adds VLAN `vid' to port `ifName' of this bridge
+// (`bridge vlan add dev ifName vid vid [pvid] [untagged]')
+// in: ifName Name of the bridge port or this bridge itself
+//     vid VLAN ID
+//     pvid true to make `vid' the PVID of `ifName'
+//     untagged true to send the frames of `vid' untagged
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) VlanAdd(ifName string, vid uint16, pvid, untagged bool) error {
+	banner := fmt.Sprintf("VlanAdd(%s, %s, %d): ", br.Name(), ifName, vid)
+	l, self, err := br.port(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	err = handleOf(br.h).nlh.BridgeVlanAdd(l, vid, pvid, untagged, self, false)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+// VlanAddRange adds VLANs from `vid' to `vidEnd' to port `ifName'
+// of this bridge (`bridge vlan add dev ifName vid vid-vidEnd')
+// in: ifName Name of the bridge port or this bridge itself
+//     vid First VLAN ID of the range
+//     vidEnd Last VLAN ID of the range
+//     untagged true to send the frames of the VLANs untagged
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) VlanAddRange(ifName string, vid, vidEnd uint16,
+	untagged bool) error {
+	banner := fmt.Sprintf("VlanAddRange(%s, %s, %d-%d): ",
+		br.Name(), ifName, vid, vidEnd)
+	l, self, err := br.port(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	err = handleOf(br.h).nlh.BridgeVlanAddRange(l, vid, vidEnd,
+		false, untagged, self, false)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+// VlanDelete deletes VLAN `vid' from port `ifName' of this bridge
+// (`bridge vlan del dev ifName vid vid')
+// in: ifName Name of the bridge port or this bridge itself
+//     vid VLAN ID
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) VlanDelete(ifName string, vid uint16) error {
+	banner := fmt.Sprintf("VlanDelete(%s, %s, %d): ", br.Name(), ifName, vid)
+	l, self, err := br.port(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	err = handleOf(br.h).nlh.BridgeVlanDel(l, vid, false, false, self, false)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+// VlanDeleteRange deletes VLANs from `vid' to `vidEnd' from port
+// `ifName' of this bridge (`bridge vlan del dev ifName vid vid-vidEnd')
+// in: ifName Name of the bridge port or this bridge itself
+//     vid First VLAN ID of the range
+//     vidEnd Last VLAN ID of the range
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) VlanDeleteRange(ifName string, vid, vidEnd uint16) error {
+	banner := fmt.Sprintf("VlanDeleteRange(%s, %s, %d-%d): ",
+		br.Name(), ifName, vid, vidEnd)
+	l, self, err := br.port(ifName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	err = handleOf(br.h).nlh.BridgeVlanDelRange(l, vid, vidEnd,
+		false, false, self, false)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	return nil
+}
+
+// VlanList returns the VLAN tables of this bridge and its ports
+// return: 1. Map of interface name to its VLAN table if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) VlanList() (map[string][]BridgeVlan, error) {
+	index := br.Link.Attrs().Index
+	return handleOf(br.h).bridgeVlanList(func(l netlink.Link) bool {
+		return l.Attrs().Index == index || l.Attrs().MasterIndex == index
+	})
+}
+
+// VlanFiltering returns true if VLAN filtering is enabled on this bridge
+// return: 1. true if VLAN filtering is enabled
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (br *Bridge) VlanFiltering() (bool, error) {
+	opts, err := br.Options()
+	if err != nil {
+		return false, err
+	}
+	return opts.VlanFiltering != nil && *opts.VlanFiltering, nil
+}
+
+// SetVlanFiltering enables (on == true) or disables (on == false)
+// VLAN filtering on this bridge
+// return: nil if success
+//         non-nil otherwise
+func (br *Bridge) SetVlanFiltering(on bool) error {
+	return br.SetOptions(&BridgeOptions{VlanFiltering: &on})
+}
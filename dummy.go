@@ -0,0 +1,397 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+)
+
+//
+// Interfaces without attributes: dummy, IFB, and nlmon
+//
+
+type Dummy struct {
+	Link *netlink.Dummy
+	h    *Handle
+}
+
+type Ifb struct {
+	Link *netlink.Ifb
+	h    *Handle
+}
+
+// Nlmon is a netlink monitor interface. The netlink package has no
+// type for nlmon.
+type Nlmon struct {
+	Link *netlink.GenericLink
+	h    *Handle
+}
+
+// linkAddUp adds link `l' and brings it up if `up' is true
+func (h *Handle) linkAddUp(l netlink.Link, up bool) error {
+	if err := h.nlh.LinkAdd(l); err != nil {
+		return fmt.Errorf("LinkAdd(): %v", err)
+	}
+	if up {
+		if err := h.nlh.LinkSetUp(l); err != nil {
+			return fmt.Errorf("LinkSetUp(): %v", err)
+		}
+	}
+	return nil
+}
+
+// DummyAdd adds a dummy interface whose name is `name'
+// (`ip link add <name> type dummy')
+// in: name Name of the dummy interface
+//     up Bring up `name' if true
+// return: 1. Pointer to Dummy if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func DummyAdd(name string, up bool) (*Dummy, error) {
+	return pkgHandle.DummyAdd(name, up)
+}
+
+// DummyAdd adds a dummy interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) DummyAdd(name string, up bool) (*Dummy, error) {
+	l := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name}}
+	if err := h.linkAddUp(l, up); err != nil {
+		return nil, fmt.Errorf("DummyAdd(%s): %v", name, err)
+	}
+	return h.DummyGetByName(name)
+}
+
+// DummyDelete deletes a dummy interface whose name is `name'
+// in: name Name of the dummy interface
+// return: nil if success
+//         non-nil otherwise
+func DummyDelete(name string) error {
+	return pkgHandle.DummyDelete(name)
+}
+
+// DummyDelete deletes a dummy interface whose name is `name' from the
+// network namespace of `h'
+func (h *Handle) DummyDelete(name string) error {
+	dummy, err := h.DummyGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(dummy.Link); err != nil {
+		return fmt.Errorf("DummyDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// DummyGetByName returns a pointer to Dummy if dummy interface whose name is
+// `name' exists
+// in: name Name of the dummy interface
+// return: 1. Pointer to Dummy if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func DummyGetByName(name string) (*Dummy, error) {
+	return pkgHandle.DummyGetByName(name)
+}
+
+// DummyGetByName returns a pointer to Dummy if dummy interface whose name is
+// `name' exists in the network namespace of `h'
+func (h *Handle) DummyGetByName(name string) (*Dummy, error) {
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("DummyGetByName(%s): %v", name, err)
+	}
+	switch l := l.(type) {
+	case *netlink.Dummy:
+		return &Dummy{Link: l, h: h}, nil
+	}
+	return nil, fmt.Errorf("DummyGetByName(%s): not dummy", name)
+}
+
+// DummyList returns a slice of Dummy
+// return: 1. Slice of Dummy if success
+//         2. nil if success
+//            non-nil otherwise
+func DummyList() ([]Dummy, error) {
+	return pkgHandle.DummyList()
+}
+
+// DummyList returns a slice of Dummy in the network namespace of `h'
+func (h *Handle) DummyList() ([]Dummy, error) {
+	var dummies []Dummy
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("DummyList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Dummy); ok {
+			dummies = append(dummies, Dummy{Link: l, h: h})
+		}
+	}
+	return dummies, nil
+}
+
+// Name returns the name of this dummy interface
+func (dummy *Dummy) Name() string {
+	return dummy.Link.Attrs().Name
+}
+
+// Index returns the ifindex of this dummy interface
+func (dummy *Dummy) Index() int {
+	return dummy.Link.Attrs().Index
+}
+
+// IfUp brings up this dummy interface
+func (dummy *Dummy) IfUp() error {
+	return handleOf(dummy.h).nlh.LinkSetUp(dummy.Link)
+}
+
+// IfDown brings down this dummy interface
+func (dummy *Dummy) IfDown() error {
+	return handleOf(dummy.h).nlh.LinkSetDown(dummy.Link)
+}
+
+// IfbAdd adds an IFB interface whose name is `name'
+// (`ip link add <name> type ifb')
+// in: name Name of the IFB interface
+//     up Bring up `name' if true
+// return: 1. Pointer to Ifb if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func IfbAdd(name string, up bool) (*Ifb, error) {
+	return pkgHandle.IfbAdd(name, up)
+}
+
+// IfbAdd adds an IFB interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) IfbAdd(name string, up bool) (*Ifb, error) {
+	l := &netlink.Ifb{LinkAttrs: netlink.LinkAttrs{Name: name}}
+	if err := h.linkAddUp(l, up); err != nil {
+		return nil, fmt.Errorf("IfbAdd(%s): %v", name, err)
+	}
+	return h.IfbGetByName(name)
+}
+
+// IfbDelete deletes an IFB interface whose name is `name'
+// in: name Name of the IFB interface
+// return: nil if success
+//         non-nil otherwise
+func IfbDelete(name string) error {
+	return pkgHandle.IfbDelete(name)
+}
+
+// IfbDelete deletes an IFB interface whose name is `name' from the
+// network namespace of `h'
+func (h *Handle) IfbDelete(name string) error {
+	ifb, err := h.IfbGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(ifb.Link); err != nil {
+		return fmt.Errorf("IfbDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// IfbGetByName returns a pointer to Ifb if IFB interface whose name is
+// `name' exists
+// in: name Name of the IFB interface
+// return: 1. Pointer to Ifb if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func IfbGetByName(name string) (*Ifb, error) {
+	return pkgHandle.IfbGetByName(name)
+}
+
+// IfbGetByName returns a pointer to Ifb if IFB interface whose name is
+// `name' exists in the network namespace of `h'
+func (h *Handle) IfbGetByName(name string) (*Ifb, error) {
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("IfbGetByName(%s): %v", name, err)
+	}
+	switch l := l.(type) {
+	case *netlink.Ifb:
+		return &Ifb{Link: l, h: h}, nil
+	}
+	return nil, fmt.Errorf("IfbGetByName(%s): not IFB", name)
+}
+
+// IfbList returns a slice of Ifb
+// return: 1. Slice of Ifb if success
+//         2. nil if success
+//            non-nil otherwise
+func IfbList() ([]Ifb, error) {
+	return pkgHandle.IfbList()
+}
+
+// IfbList returns a slice of Ifb in the network namespace of `h'
+func (h *Handle) IfbList() ([]Ifb, error) {
+	var ifbs []Ifb
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("IfbList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Ifb); ok {
+			ifbs = append(ifbs, Ifb{Link: l, h: h})
+		}
+	}
+	return ifbs, nil
+}
+
+// Name returns the name of this IFB interface
+func (ifb *Ifb) Name() string {
+	return ifb.Link.Attrs().Name
+}
+
+// Index returns the ifindex of this IFB interface
+func (ifb *Ifb) Index() int {
+	return ifb.Link.Attrs().Index
+}
+
+// IfUp brings up this IFB interface
+func (ifb *Ifb) IfUp() error {
+	return handleOf(ifb.h).nlh.LinkSetUp(ifb.Link)
+}
+
+// IfDown brings down this IFB interface
+func (ifb *Ifb) IfDown() error {
+	return handleOf(ifb.h).nlh.LinkSetDown(ifb.Link)
+}
+
+// NlmonAdd adds a nlmon interface whose name is `name'
+// (`ip link add <name> type nlmon')
+// in: name Name of the nlmon interface
+//     up Bring up `name' if true
+// return: 1. Pointer to Nlmon if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NlmonAdd(name string, up bool) (*Nlmon, error) {
+	return pkgHandle.NlmonAdd(name, up)
+}
+
+// NlmonAdd adds a nlmon interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) NlmonAdd(name string, up bool) (*Nlmon, error) {
+	l := &netlink.GenericLink{
+		LinkAttrs: netlink.LinkAttrs{Name: name},
+		LinkType:  "nlmon",
+	}
+	if err := h.linkAddUp(l, up); err != nil {
+		return nil, fmt.Errorf("NlmonAdd(%s): %v", name, err)
+	}
+	return h.NlmonGetByName(name)
+}
+
+// NlmonDelete deletes a nlmon interface whose name is `name'
+// in: name Name of the nlmon interface
+// return: nil if success
+//         non-nil otherwise
+func NlmonDelete(name string) error {
+	return pkgHandle.NlmonDelete(name)
+}
+
+// NlmonDelete deletes a nlmon interface whose name is `name' from the
+// network namespace of `h'
+func (h *Handle) NlmonDelete(name string) error {
+	nlmon, err := h.NlmonGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(nlmon.Link); err != nil {
+		return fmt.Errorf("NlmonDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// NlmonGetByName returns a pointer to Nlmon if nlmon interface whose name is
+// `name' exists
+// in: name Name of the nlmon interface
+// return: 1. Pointer to Nlmon if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NlmonGetByName(name string) (*Nlmon, error) {
+	return pkgHandle.NlmonGetByName(name)
+}
+
+// NlmonGetByName returns a pointer to Nlmon if nlmon interface whose name is
+// `name' exists in the network namespace of `h'
+func (h *Handle) NlmonGetByName(name string) (*Nlmon, error) {
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("NlmonGetByName(%s): %v", name, err)
+	}
+	switch l := l.(type) {
+	case *netlink.GenericLink:
+		if l.Type() == "nlmon" {
+			return &Nlmon{Link: l, h: h}, nil
+		}
+	}
+	return nil, fmt.Errorf("NlmonGetByName(%s): not nlmon", name)
+}
+
+// NlmonList returns a slice of Nlmon
+// return: 1. Slice of Nlmon if success
+//         2. nil if success
+//            non-nil otherwise
+func NlmonList() ([]Nlmon, error) {
+	return pkgHandle.NlmonList()
+}
+
+// NlmonList returns a slice of Nlmon in the network namespace of `h'
+func (h *Handle) NlmonList() ([]Nlmon, error) {
+	var nlmons []Nlmon
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("NlmonList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.GenericLink); ok && l.Type() == "nlmon" {
+			nlmons = append(nlmons, Nlmon{Link: l, h: h})
+		}
+	}
+	return nlmons, nil
+}
+
+// Name returns the name of this nlmon interface
+func (nlmon *Nlmon) Name() string {
+	return nlmon.Link.Attrs().Name
+}
+
+// Index returns the ifindex of this nlmon interface
+func (nlmon *Nlmon) Index() int {
+	return nlmon.Link.Attrs().Index
+}
+
+// IfUp brings up this nlmon interface
+func (nlmon *Nlmon) IfUp() error {
+	return handleOf(nlmon.h).nlh.LinkSetUp(nlmon.Link)
+}
+
+// IfDown brings down this nlmon interface
+func (nlmon *Nlmon) IfDown() error {
+	return handleOf(nlmon.h).nlh.LinkSetDown(nlmon.Link)
+}
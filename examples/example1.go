@@ -63,22 +63,33 @@ func addNetwork() {
 	)
 	banner := "addNetwork(): "
 
+	//
+	// Undo what has been done so far on error
+	//
+	tx := iproute.TxBegin()
+	fail := func(msg string) {
+		if err := tx.Rollback(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+		errExit(msg)
+	}
+
 	//
 	// Create a bridge
 	//
 	br, err = iproute.BridgeGetByName(br1)
 	if err != nil {
 		if iproute.IsNotFound(err) {
-			br, err = iproute.BridgeAdd(br1, iproute.Up)
+			br, err = tx.BridgeAdd(br1, nil, iproute.Up)
 			if err != nil {
 				msg := fmt.Sprintf("%sBridgeAdd(%s, up): %v", banner, br1, err)
-				errExit(msg)
+				fail(msg)
 			}
 			fmt.Fprintf(os.Stderr, "Added bridge %s\n", br.Name())
 		} else {
 			msg := fmt.Sprintf("%sBridgeGetByName(%s): %v",
-				banner, br.Name(), err)
-			errExit(msg)
+				banner, br1, err)
+			fail(msg)
 		}
 	} else {
 		fmt.Fprintf(os.Stderr, "bridge %s already exists\n", br.Name())
@@ -90,17 +101,17 @@ func addNetwork() {
 	vrf, err = iproute.VrfGetByName(vrf1)
 	if err != nil {
 		if iproute.IsNotFound(err) {
-			vrf, err = iproute.VrfAdd(vrf1, 1, iproute.Up)
+			vrf, err = tx.VrfAdd(vrf1, 1, iproute.Up)
 			if err != nil {
 				msg := fmt.Sprintf("%sVrfAdd(%s, up): %v",
 					banner, vrf1, err)
-				errExit(msg)
+				fail(msg)
 			}
 			fmt.Fprintf(os.Stderr, "Added VRF %s\n", vrf.Name())
 		} else {
 			msg := fmt.Sprintf("%sVrfGetByName(%s): %v",
-				banner, vrf.Name(), err)
-			errExit(msg)
+				banner, vrf1, err)
+			fail(msg)
 		}
 	} else {
 		fmt.Fprintf(os.Stderr, "VRF %s already exists\n", vrf.Name())
@@ -119,17 +130,17 @@ func addNetwork() {
 		veth[i], err = iproute.VethGetByName(if1)
 		if err != nil {
 			if iproute.IsNotFound(err) {
-				veth[i], err = iproute.VethAdd(if1, if2, iproute.Up)
+				veth[i], err = tx.VethAdd(if1, if2, iproute.Up)
 				if err != nil {
 					msg := fmt.Sprintf("%sVethAdd(%s, %s): %v",
 						banner, if1, if2, err)
-					errExit(msg)
+					fail(msg)
 				}
 				fmt.Fprintf(os.Stderr, "Added veth pairs: %s, %s\n",
 					veth[i].Name(), veth[i].PeerName())
 			} else {
 				msg := fmt.Sprintf("%sVethGetByName(%s): %v", banner, if1, err)
-				errExit(msg)
+				fail(msg)
 			}
 		} else {
 			fmt.Fprintf(os.Stderr, "veth pair %s, %s already exists\n",
@@ -138,13 +149,13 @@ func addNetwork() {
 		//
 		// bind veth[i].Name() to VRF, PeerName() to bridge
 		//
-		if err = vrf.BindIf(veth[i].Name()); err != nil {
-			msg := fmt.Sprintf("vrf.BindIf(%s): %v", veth[i].Name, err)
-			errExit(msg)
+		if err = tx.BindIf(vrf.Name(), veth[i].Name()); err != nil {
+			msg := fmt.Sprintf("vrf.BindIf(%s): %v", veth[i].Name(), err)
+			fail(msg)
 		}
-		if err = br.BindIf(veth[i].PeerName()); err != nil {
-			msg := fmt.Sprintf("br.BindIf(%s): %v", veth[i].Name, err)
-			errExit(msg)
+		if err = tx.BindIf(br.Name(), veth[i].PeerName()); err != nil {
+			msg := fmt.Sprintf("br.BindIf(%s): %v", veth[i].PeerName(), err)
+			fail(msg)
 		}
 		if a, p, err := net.ParseCIDR(ifPrefix[i]); err == nil {
 			p.IP = a
@@ -154,14 +165,15 @@ func addNetwork() {
 						veth[i].Name(), ifPrefix[i])
 				} else {
 					msg := fmt.Sprintf("IpAddrAdd(%s): %v", veth[i].Name(), err)
-					errExit(msg)
+					fail(msg)
 				}
 			}
 		} else {
 			msg := fmt.Sprintf("ParseCIDR(%s): %v", ifPrefix[i], err)
-			errExit(msg)
+			fail(msg)
 		}
 	}
+	tx.Commit()
 }
 
 func deleteNetwork() {
@@ -0,0 +1,237 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+const (
+	GenevePort = 6081 // IANA assigned Geneve UDP port
+)
+
+type Geneve struct {
+	Link *netlink.Geneve
+	h    *Handle
+}
+
+// GeneveOptions holds the attributes of a Geneve interface
+type GeneveOptions struct {
+	Vni            uint32 // virtual network identifier. Must be 0 if External
+	Remote         net.IP // remote tunnel endpoint. Must be nil if External
+	Port           uint16 // destination UDP port. 0 for GenevePort
+	Ttl            uint8  // TTL of the encapsulated packets. 0 for default
+	TtlInherit     bool   // inherit TTL from the inner packets
+	Tos            uint8  // TOS of the encapsulated packets
+	UdpCsum        bool   // compute UDP checksum (IPv4)
+	UdpZeroCsum6Tx bool   // skip UDP checksum on transmit (IPv6)
+	UdpZeroCsum6Rx bool   // accept zero UDP checksum on receive (IPv6)
+	External       bool   // external control plane (collect metadata)
+}
+
+// addGeneveOptions adds the IFLA_GENEVE_* attributes in `opts' to
+// `data'
+func addGeneveOptions(data *nl.RtAttr, opts *GeneveOptions) error {
+	if opts.External {
+		if opts.Vni != 0 || opts.Remote != nil {
+			return fmt.Errorf("VNI and remote cannot be specified with external")
+		}
+		data.AddRtAttr(nl.IFLA_GENEVE_COLLECT_METADATA, []byte{})
+	} else {
+		if opts.Remote == nil {
+			return fmt.Errorf("remote is required")
+		}
+		data.AddRtAttr(nl.IFLA_GENEVE_ID, nl.Uint32Attr(opts.Vni))
+		if b, v4 := ipAttr(opts.Remote); v4 {
+			data.AddRtAttr(nl.IFLA_GENEVE_REMOTE, b)
+		} else {
+			data.AddRtAttr(nl.IFLA_GENEVE_REMOTE6, b)
+		}
+	}
+	port := opts.Port
+	if port == 0 {
+		port = GenevePort
+	}
+	data.AddRtAttr(nl.IFLA_GENEVE_PORT, be16Attr(port))
+	if opts.TtlInherit {
+		if opts.Ttl != 0 {
+			return fmt.Errorf("TTL and TTL inherit are exclusive")
+		}
+		data.AddRtAttr(nl.IFLA_GENEVE_TTL_INHERIT, boolAttr(true))
+	} else {
+		data.AddRtAttr(nl.IFLA_GENEVE_TTL, nl.Uint8Attr(opts.Ttl))
+	}
+	data.AddRtAttr(nl.IFLA_GENEVE_TOS, nl.Uint8Attr(opts.Tos))
+	data.AddRtAttr(nl.IFLA_GENEVE_UDP_CSUM, boolAttr(opts.UdpCsum))
+	data.AddRtAttr(nl.IFLA_GENEVE_UDP_ZERO_CSUM6_TX,
+		boolAttr(opts.UdpZeroCsum6Tx))
+	data.AddRtAttr(nl.IFLA_GENEVE_UDP_ZERO_CSUM6_RX,
+		boolAttr(opts.UdpZeroCsum6Rx))
+	return nil
+}
+
+// GeneveAdd adds a Geneve interface whose name is `name'
+// (`ip link add <name> type geneve id <vni> remote <remote> ...')
+// in: name Name of the Geneve interface
+//     opts Pointer to the Geneve attributes
+//     up Bring up `name' if true
+// return: 1. Pointer to Geneve if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func GeneveAdd(name string, opts *GeneveOptions, up bool) (*Geneve, error) {
+	return pkgHandle.GeneveAdd(name, opts, up)
+}
+
+// GeneveAdd adds a Geneve interface whose name is `name' to the
+// network namespace of `h'
+func (h *Handle) GeneveAdd(name string, opts *GeneveOptions,
+	up bool) (*Geneve, error) {
+	banner := fmt.Sprintf("GeneveAdd(%s): ", name)
+
+	if opts == nil {
+		return nil, fmt.Errorf("%sno options", banner)
+	}
+	req := newLinkRequest(unix.NLM_F_CREATE|unix.NLM_F_EXCL, 0, name)
+	linkInfo, data := newLinkInfo("geneve")
+	if err := addGeneveOptions(data, opts); err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return nil, fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	gnv, err := h.GeneveGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if up {
+		return gnv, gnv.IfUp()
+	}
+	return gnv, nil
+}
+
+// GeneveDelete deletes a Geneve interface whose name is `name'
+// in: name Name of the Geneve interface
+// return: nil if success
+//         non-nil otherwise
+func GeneveDelete(name string) error {
+	return pkgHandle.GeneveDelete(name)
+}
+
+// GeneveDelete deletes a Geneve interface whose name is `name' from
+// the network namespace of `h'
+func (h *Handle) GeneveDelete(name string) error {
+	gnv, err := h.GeneveGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(gnv.Link); err != nil {
+		return fmt.Errorf("GeneveDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// GeneveGetByName returns a pointer to Geneve if Geneve interface
+// whose name is `name' exists
+// in: name Name of the Geneve interface
+// return: 1. Pointer to Geneve if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func GeneveGetByName(name string) (*Geneve, error) {
+	return pkgHandle.GeneveGetByName(name)
+}
+
+// GeneveGetByName returns a pointer to Geneve if Geneve interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) GeneveGetByName(name string) (*Geneve, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		switch l := l.(type) {
+		case *netlink.Geneve:
+			return &Geneve{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("GeneveGetByName(%s): not Geneve", name)
+		}
+	} else {
+		return nil, fmt.Errorf("GeneveGetByName(%s): %v", name, err)
+	}
+}
+
+// GeneveList returns a slice of Geneve
+// return: 1. Slice of Geneve if success
+//         2. nil if success
+//            non-nil otherwise
+func GeneveList() ([]Geneve, error) {
+	return pkgHandle.GeneveList()
+}
+
+// GeneveList returns a slice of Geneve in the network namespace of `h'
+func (h *Handle) GeneveList() ([]Geneve, error) {
+	var gnvs []Geneve
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("GeneveList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Geneve); ok {
+			gnvs = append(gnvs, Geneve{Link: l, h: h})
+		}
+	}
+	return gnvs, nil
+}
+
+// Name returns the name of this Geneve interface
+func (gnv *Geneve) Name() string {
+	return gnv.Link.Attrs().Name
+}
+
+// Vni returns the VNI of this Geneve interface. 0 if external
+func (gnv *Geneve) Vni() uint32 {
+	return gnv.Link.ID
+}
+
+// Remote returns the remote tunnel endpoint of this Geneve interface.
+// nil if external
+func (gnv *Geneve) Remote() net.IP {
+	return gnv.Link.Remote
+}
+
+// Port returns the destination UDP port of this Geneve interface
+func (gnv *Geneve) Port() uint16 {
+	return gnv.Link.Dport
+}
+
+// External returns true if this Geneve interface is in external mode
+func (gnv *Geneve) External() bool {
+	return gnv.Link.FlowBased
+}
+
+// IfUp brings up this Geneve interface
+func (gnv *Geneve) IfUp() error {
+	return handleOf(gnv.h).nlh.LinkSetUp(gnv.Link)
+}
+
+// IfDown brings down this Geneve interface
+func (gnv *Geneve) IfDown() error {
+	return handleOf(gnv.h).nlh.LinkSetDown(gnv.Link)
+}
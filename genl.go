@@ -0,0 +1,62 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+//
+// Helpers for the generic netlink messages
+//
+
+// newGenlRequest returns a generic netlink request of family `family'
+// in the network namespace of `h'
+// in: family Name of the generic netlink family (e.g. "wireguard")
+//     cmd Command
+//     version Version of the family
+//     flags NLM_F_* flags in addition to NLM_F_ACK
+// return: 1. Pointer to nl.NetlinkRequest if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (h *Handle) newGenlRequest(family string, cmd, version uint8,
+	flags int) (*nl.NetlinkRequest, error) {
+	f, err := h.nlh.GenlFamilyGet(family)
+	if err != nil {
+		return nil, fmt.Errorf("generic netlink family %s: %v", family, err)
+	}
+	req := nl.NewNetlinkRequest(int(f.ID), flags|unix.NLM_F_ACK)
+	req.AddData(&nl.Genlmsg{Command: cmd, Version: version})
+	return req, nil
+}
+
+// genlAttrs returns the attributes of generic netlink message `msg'
+func genlAttrs(msg []byte) ([]syscall.NetlinkRouteAttr, error) {
+	if len(msg) < nl.SizeofGenlmsg {
+		return nil, fmt.Errorf("short generic netlink message")
+	}
+	return nl.ParseRouteAttr(msg[nl.SizeofGenlmsg:])
+}
+
+// nestedAttr returns a nested attribute whose type is `attrType'
+func nestedAttr(attrType int) *nl.RtAttr {
+	return nl.NewRtAttr(attrType|int(nl.NLA_F_NESTED), nil)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// Handle is a handle for the requests on a specific network namespace.
+// Every package level function has a Handle method counterpart
+// that acts on the namespace the Handle is bound to instead of
+// the namespace of the calling thread.
+type Handle struct {
+	nlh *netlink.Handle
+	ns  netns.NsHandle
+}
+
+// pkgHandle is used by the package level functions. It acts on the
+// network namespace of the calling thread.
+var pkgHandle = &Handle{nlh: &netlink.Handle{}, ns: netns.None()}
+
+// handleOf returns `h' unless it is nil. Returns pkgHandle otherwise.
+func handleOf(h *Handle) *Handle {
+	if h == nil {
+		return pkgHandle
+	}
+	return h
+}
+
+// NewHandle returns a Handle bound to the network namespace
+// of the calling thread.
+// return: 1. Pointer to Handle if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NewHandle() (*Handle, error) {
+	ns, err := netns.Get()
+	if err != nil {
+		return nil, fmt.Errorf("NewHandle(): Get(): %v", err)
+	}
+	return newHandleAt(ns)
+}
+
+// NewHandleByName returns a Handle bound to the named network
+// namespace `nsName' (/var/run/netns/`nsName')
+// in: nsName Name of the network namespace
+// return: 1. Pointer to Handle if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NewHandleByName(nsName string) (*Handle, error) {
+	ns, err := netns.GetFromPath(netnsPath(nsName))
+	if err != nil {
+		return nil, fmt.Errorf("NewHandleByName(%s): %v", nsName, err)
+	}
+	return newHandleAt(ns)
+}
+
+// NewHandleByPid returns a Handle bound to the network namespace
+// of process `pid'
+// in: pid Process ID
+// return: 1. Pointer to Handle if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NewHandleByPid(pid int) (*Handle, error) {
+	ns, err := netns.GetFromPid(pid)
+	if err != nil {
+		return nil, fmt.Errorf("NewHandleByPid(%d): %v", pid, err)
+	}
+	return newHandleAt(ns)
+}
+
+// NewHandleByFd returns a Handle bound to the network namespace
+// referred to by file descriptor `fd'. `fd' is duplicated;
+// the caller still owns it.
+// in: fd File descriptor of the network namespace
+// return: 1. Pointer to Handle if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NewHandleByFd(fd int) (*Handle, error) {
+	nfd, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("NewHandleByFd(%d): %v", fd, err)
+	}
+	return newHandleAt(netns.NsHandle(nfd))
+}
+
+func newHandleAt(ns netns.NsHandle) (*Handle, error) {
+	nlh, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		ns.Close()
+		return nil, fmt.Errorf("NewHandleAt(%v): %v", ns, err)
+	}
+	return &Handle{nlh: nlh, ns: ns}, nil
+}
+
+// Close releases the netlink sockets and the namespace file descriptor
+// held by this handle.
+func (h *Handle) Close() {
+	if h == pkgHandle {
+		return
+	}
+	h.nlh.Close()
+	h.ns.Close()
+}
+
+// NetlinkHandle returns the netlink.Handle used by this handle
+func (h *Handle) NetlinkHandle() *netlink.Handle {
+	return h.nlh
+}
+
+// Fd returns the file descriptor of the network namespace this
+// handle is bound to. Returns -1 if the handle acts on the namespace
+// of the calling thread.
+func (h *Handle) Fd() int {
+	return int(h.ns)
+}
+
+// do runs `f' in the network namespace of this handle.
+// It is used for the operations that cannot be done via a netlink
+// socket (e.g. ioctl).
+// in: f Function to be executed
+// return: nil if success
+//         non-nil otherwise
+func (h *Handle) do(f func() error) error {
+	if !h.ns.IsOpen() {
+		return f()
+	}
+	return nsDo(int(h.ns), f)
+}
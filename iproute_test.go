@@ -2,12 +2,15 @@ package iproute
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	//netns "github.com/hariguchi/go_netns"
-	"io/ioutil"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
@@ -311,38 +314,51 @@ func testPing(t *testing.T, vrf *Vrf, ifPrefix []string) {
 			return
 		}
 	}
-	if fp, err := ioutil.TempFile("", "vrfping"); err == nil {
-		defer os.Remove(fp.Name())
-
-		cmd := fmt.Sprintf("#!/bin/sh\nVRF=%s ", vrf.Name())
-		cmd += "LD_PRELOAD=/usr/bin/vrf_socket.so "
-		cmd += fmt.Sprintf("ping -f -q -c 5 -I %s %s\n", ifAddr[0], ifAddr[1])
-		if _, err := fp.WriteString(cmd); err == nil {
-			name := fp.Name()
-			if err := fp.Close(); err == nil {
-				if err := os.Chmod(name, 0755); err == nil {
-					t.Logf("Ping test:\n%s\n...", cmd)
-					if out, err := exec.Command(name).Output(); err == nil {
-						if pingMsg.MatchString(string(out)) {
-							t.Logf("confirmed.")
-						} else {
-							t.Errorf("Error: testPing():\n%s\n", string(out))
-						}
-					} else {
-						t.Errorf("testPing(): Command(%s): %v", name, err)
-						t.Fatalf("testPing(): Output: %s", string(out))
-					}
-				} else {
-					t.Errorf("testPing(): Chmod(): %v", err)
-				}
-			} else {
-				t.Errorf("testPing(): Close(): %v", err)
-			}
+	args := []string{"-f", "-q", "-c", "5", "-I", ifAddr[0], ifAddr[1]}
+	t.Logf("Ping test in %s: ping %v...", vrf.Name(), args)
+	if out, err := vrf.Output(exec.Command("ping", args...)); err == nil {
+		if pingMsg.MatchString(string(out)) {
+			t.Logf("confirmed.")
+		} else {
+			t.Errorf("Error: testPing():\n%s\n", string(out))
+		}
+	} else {
+		t.Errorf("testPing(): Output(ping): %v", err)
+		t.Fatalf("testPing(): Output: %s", string(out))
+	}
+}
+
+func testVrfDial(t *testing.T, vrf *Vrf, ifPrefix []string) {
+	var ifAddr []string
+
+	for _, prefix := range ifPrefix {
+		if ipa, _, err := net.ParseCIDR(prefix); err == nil {
+			ifAddr = append(ifAddr, ipa.String())
 		} else {
-			t.Errorf("testPing(): WriteString(%s): %v", cmd, err)
+			t.Errorf("Error: testVrfDial(): ParseCIDR(%s): %v", prefix, err)
+			return
+		}
+	}
+	addr := net.JoinHostPort(ifAddr[1], "12345")
+	t.Logf("Connecting to %s in %s...", addr, vrf.Name())
+	ln, err := vrf.ListenConfig().Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Errorf("Error: testVrfDial(): Listen(%s): %v", addr, err)
+		return
+	}
+	defer ln.Close()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Close()
 		}
+	}()
+	d := vrf.Dialer()
+	d.LocalAddr = &net.TCPAddr{IP: net.ParseIP(ifAddr[0])}
+	if c, err := d.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Logf("confirmed.")
 	} else {
-		t.Errorf("testPing(): Tempfile(): %v", err)
+		t.Errorf("Error: testVrfDial(): Dial(%s): %v", addr, err)
 	}
 }
 
@@ -447,6 +463,7 @@ func TestVrf(t *testing.T) {
 	testIpAddrAdd(t, veth, vlanId, ifAddrs)
 	vifName := fmt.Sprintf("%s.%d", veth.Name(), vlanId)
 	testPing(t, vrf, ifAddrs)
+	testVrfDial(t, vrf, ifAddrs)
 	testRoutes(t, vrf, "192.168.1.0/24", "172.16.1.3")
 
 	testVlanDelete(t, vifName)
@@ -454,6 +471,71 @@ func TestVrf(t *testing.T) {
 	testVethDelete(t, veth)
 }
 
+func TestVrfCgroup(t *testing.T) {
+	const ns = "iprouteCgroupNs"
+
+	if err := NetnsAdd(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(ns)
+	h, err := NewHandleByName(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	//
+	// VRFs of the same name and ifindex in different namespaces
+	//
+	newVrf := func(h *Handle) *Vrf {
+		return &Vrf{Link: &netlink.Vrf{Table: 100,
+			LinkAttrs: netlink.LinkAttrs{Name: "cgVrf", Index: 1}}, h: h}
+	}
+	var ino [2]uint64
+	for i, vrf := range []*Vrf{newVrf(nil), newVrf(h)} {
+		for j := 0; j < 2; j++ {
+			cgfd, err := vrf.cgroup()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var st unix.Stat_t
+			if err := unix.Fstat(cgfd, &st); err != nil {
+				t.Error(err)
+			} else if j > 0 && st.Ino != ino[i] {
+				t.Errorf("Error: cgroup of %s changed", vrf.Name())
+			}
+			ino[i] = st.Ino
+			if ok, err := bpfProgAttached(cgfd); !ok {
+				t.Errorf("Error: no program attached: %v", err)
+			}
+			unix.Close(cgfd)
+		}
+	}
+	if ino[0] == ino[1] {
+		t.Errorf("Error: VRFs in different namespaces share a cgroup")
+	}
+
+	t.Logf("Cleaning up cgroups...")
+	if err := VrfCgroupCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	root, err := cgroup2Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []*Handle{pkgHandle, h} {
+		nsIno, err := h.nsIno()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(root, "vrf", fmt.Sprintf("%d", nsIno))
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("Error: %s should be removed: %v", dir, err)
+		}
+	}
+	t.Logf("confirmed.")
+}
+
 func TestSetOnlink(t *testing.T) {
 	nhi := NHinfo{}
 	if err := SetOnlink(&nhi); err != nil {
@@ -482,7 +564,7 @@ func TestBridge(t *testing.T) {
 	} else if !IsNotFound(err) {
 		t.Fatal(err)
 	}
-	br, err = BridgeAdd(brName, Up)
+	br, err = BridgeAdd(brName, nil, Up)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -548,3 +630,1899 @@ func TestVethSetNS(t *testing.T) {
 	defer runtime.UnlockOSThread()
 
 }
+
+func TestVethAddWithOptions(t *testing.T) {
+	nsName := "iprouteTestNs2"
+	mac, _ := net.ParseMAC("02:00:00:00:25:01")
+	peerMac, _ := net.ParseMAC("02:00:00:00:25:02")
+	ip, ipnet, _ := net.ParseCIDR("10.25.0.1/24")
+	addr := &net.IPNet{IP: ip, Mask: ipnet.Mask}
+	ip, ipnet, _ = net.ParseCIDR("10.25.0.2/24")
+	peerAddr := &net.IPNet{IP: ip, Mask: ipnet.Mask}
+
+	if err := NetnsAdd(nsName); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(nsName)
+
+	self := &VethOptions{
+		Name:     "optVeth0",
+		MTU:      9000,
+		MAC:      mac,
+		TxQlen:   500,
+		TxQueues: 2,
+		RxQueues: 2,
+		Alias:    "self end",
+		Addrs:    []*net.IPNet{addr},
+		Up:       Up,
+	}
+	peer := &VethOptions{
+		Name:   "optVeth1",
+		MTU:    8000,
+		MAC:    peerMac,
+		TxQlen: 100,
+		Alias:  "peer end",
+		Netns:  nsName,
+		Addrs:  []*net.IPNet{peerAddr},
+		Up:     Up,
+	}
+	t.Logf("Adding veth %s with peer %s in %s...", self.Name, peer.Name, nsName)
+	veth, err := VethAddWithOptions(self, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete(self.Name)
+	if veth.Peer != nil {
+		t.Errorf("Error: peer of %s should not be visible", veth.Name())
+	}
+	if veth.NtxQs() != 2 || veth.NrxQs() != 2 {
+		t.Errorf("Error: %s: %d tx queues, %d rx queues",
+			veth.Name(), veth.NtxQs(), veth.NrxQs())
+	}
+	attrs := veth.Link.Attrs()
+	if attrs.MTU != 9000 || attrs.TxQLen != 500 ||
+		attrs.HardwareAddr.String() != mac.String() ||
+		attrs.Alias != "self end" {
+		t.Errorf("Error: %s: mtu %d, txqlen %d, mac %s, alias %q",
+			veth.Name(), attrs.MTU, attrs.TxQLen, attrs.HardwareAddr,
+			attrs.Alias)
+	}
+	if addrs, err := IpAddrList(self.Name, FAMILY_V4); err != nil ||
+		len(addrs) != 1 || addrs[0].String() != addr.String() {
+		t.Errorf("Error: addresses of %s: %v, %v", self.Name, addrs, err)
+	}
+	if ok, _ := VethIfExists(peer.Name); ok {
+		t.Errorf("Error: %s should be in %s", peer.Name, nsName)
+	}
+	if h, err := NewHandleByName(nsName); err == nil {
+		if l, err := h.nlh.LinkByName(peer.Name); err == nil {
+			attrs := l.Attrs()
+			if attrs.MTU != 8000 || attrs.TxQLen != 100 ||
+				attrs.HardwareAddr.String() != peerMac.String() ||
+				attrs.Alias != "peer end" {
+				t.Errorf("Error: %s: mtu %d, txqlen %d, mac %s, alias %q",
+					peer.Name, attrs.MTU, attrs.TxQLen, attrs.HardwareAddr,
+					attrs.Alias)
+			}
+		} else {
+			t.Errorf("Error: LinkByName(%s) in %s: %v", peer.Name, nsName, err)
+		}
+		if up, err := h.IfIsUpByName(peer.Name); err != nil || !up {
+			t.Errorf("Error: %s should be up: %v", peer.Name, err)
+		}
+		if addrs, err := h.IpAddrList(peer.Name, FAMILY_V4); err != nil ||
+			len(addrs) != 1 || addrs[0].String() != peerAddr.String() {
+			t.Errorf("Error: addresses of %s: %v, %v", peer.Name, addrs, err)
+		}
+		h.Close()
+	} else {
+		t.Errorf("Error: NewHandleByName(%s): %v", nsName, err)
+	}
+	if err := VethDelete(self.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("Adding veth with peer in %s by fd...", nsName)
+	f, err := os.Open(netnsPath(nsName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := int(f.Fd())
+	self = &VethOptions{Name: "optVeth0"}
+	peer = &VethOptions{Name: "optVeth1", NetnsFd: &fd}
+	_, err = VethAddWithOptions(self, peer)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := VethIfExists(peer.Name); ok {
+		t.Errorf("Error: %s should be in %s", peer.Name, nsName)
+	}
+	if err := VethDelete(self.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("Adding veth with a nonexistent master...")
+	self = &VethOptions{Name: "optVeth0", Master: "optNoSuchBr"}
+	peer = &VethOptions{Name: "optVeth1"}
+	if _, err := VethAddWithOptions(self, peer); err == nil {
+		t.Errorf("Error: VethAddWithOptions() should fail")
+	}
+	if ok, _ := VethIfExists(self.Name); ok {
+		t.Errorf("Error: %s should have been deleted", self.Name)
+		VethDelete(self.Name)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestHandle(t *testing.T) {
+	vrfName := "hdlVRF01"
+
+	h, err := NewHandle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	t.Logf("Adding VRF %s via Handle...", vrfName)
+	vrf, err := h.VrfAdd(vrfName, 101, Up)
+	if err != nil {
+		t.Fatalf("Error: VrfAdd(%s): %v", vrfName, err)
+	}
+	if v, err := VrfGetByName(vrfName); err == nil {
+		if !v.Equal(vrf) {
+			t.Errorf("Error: %s (tid %d) should be %s (tid %d)",
+				v.Name(), v.Tid(), vrf.Name(), vrf.Tid())
+		}
+	} else {
+		t.Errorf("Error: VrfGetByName(%s): %v", vrfName, err)
+	}
+	if err := h.VrfDelete(vrfName); err != nil {
+		t.Fatalf("Error: VrfDelete(%s): %v", vrfName, err)
+	}
+	if ok, err := VrfIfExists(vrfName); err != nil || ok {
+		t.Errorf("Error: VRF %s still exists: %v", vrfName, err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestNetns(t *testing.T) {
+	nsName := "iprouteTestNs1"
+
+	if ok, err := NetnsExists(nsName); err == nil {
+		if ok {
+			t.Logf("netns %s already exists. Deletes it", nsName)
+			if err := NetnsDelete(nsName); err != nil {
+				t.Fatal(err)
+			}
+		}
+	} else {
+		t.Fatal(err)
+	}
+	t.Logf("Adding netns %s...", nsName)
+	if err := NetnsAdd(nsName); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := NetnsList(); err == nil {
+		found := false
+		for _, name := range names {
+			if name == nsName {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Error: %s is not in %v", nsName, names)
+		}
+	} else {
+		t.Errorf("Error: NetnsList(): %v", err)
+	}
+	if h, err := NewHandleByName(nsName); err == nil {
+		if ifs, err := h.IfList(); err == nil {
+			if len(ifs) != 1 || ifs[0] != "lo" {
+				t.Errorf("Error: interfaces in %s: %v", nsName, ifs)
+			}
+		} else {
+			t.Errorf("Error: IfList(): %v", err)
+		}
+		if veth, err := h.VethAdd("ns-foo", "ns-bar", Up); err == nil {
+			if veth.PeerName() != "ns-bar" {
+				t.Errorf("Error: %s: should be ns-bar", veth.PeerName())
+			}
+			if ok, _ := VethIfExists(veth.Name()); ok {
+				t.Errorf("Error: %s should be in %s", veth.Name(), nsName)
+			}
+		} else {
+			t.Errorf("Error: VethAdd(ns-foo, ns-bar) in %s: %v", nsName, err)
+		}
+		h.Close()
+	} else {
+		t.Errorf("Error: NewHandleByName(%s): %v", nsName, err)
+	}
+	if err := NetnsSetId(nsName, 100); err == nil {
+		if id, err := NetnsGetId(nsName); err != nil || id != 100 {
+			t.Errorf("Error: NetnsGetId(%s): %d (should be 100), %v",
+				nsName, id, err)
+		}
+	} else {
+		t.Errorf("Error: NetnsSetId(%s, 100): %v", nsName, err)
+	}
+	t.Logf("Deleting netns %s...", nsName)
+	if err := NetnsDelete(nsName); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := NetnsExists(nsName); err != nil || ok {
+		t.Errorf("Error: netns %s still exists: %v", nsName, err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestNetnsDo(t *testing.T) {
+	nsName := "iprouteTestNs2"
+
+	if err := NetnsAdd(nsName); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(nsName)
+
+	t.Logf("Adding veth pair in %s...", nsName)
+	err := NetnsDo(nsName, func() error {
+		if _, err := VethAdd("nsdo-foo", "nsdo-bar", Up); err != nil {
+			return err
+		}
+		veth, err := VethGetByName("nsdo-foo")
+		if err != nil {
+			return err
+		}
+		if veth.PeerName() != "nsdo-bar" {
+			return fmt.Errorf("%s: should be nsdo-bar", veth.PeerName())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VethIfExists("nsdo-foo"); err != nil || ok {
+		t.Errorf("Error: nsdo-foo should not be in this namespace: %v", err)
+	}
+	err = NetnsDo(nsName, func() error {
+		return fmt.Errorf("callback error")
+	})
+	if err == nil || !isThisInError("callback error", err) {
+		t.Errorf("Error: NetnsDo() should return the callback error: %v", err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestBridgeOptions(t *testing.T) {
+	brName := "brTestOpt"
+	stp := true
+	ageing := uint32(20000)
+	prio := uint16(4096)
+
+	if ok, _ := BridgeIfExists(brName); ok {
+		BridgeDelete(brName)
+	}
+	t.Logf("Adding %s with STP on, ageing_time %d...", brName, ageing)
+	br, err := BridgeAdd(brName,
+		&BridgeOptions{Stp: &stp, AgeingTime: &ageing}, Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BridgeDelete(brName)
+
+	opts, err := br.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Stp == nil || !*opts.Stp {
+		t.Errorf("Error: STP should be on")
+	}
+	if opts.AgeingTime == nil || *opts.AgeingTime != ageing {
+		t.Errorf("Error: ageing_time should be %d", ageing)
+	}
+	t.Logf("Setting priority %d, STP off...", prio)
+	stp = false
+	if err := br.SetOptions(&BridgeOptions{Stp: &stp, Priority: &prio}); err != nil {
+		t.Fatal(err)
+	}
+	if opts, err = br.Options(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Stp == nil || *opts.Stp {
+		t.Errorf("Error: STP should be off")
+	}
+	if opts.Priority == nil || *opts.Priority != prio {
+		t.Errorf("Error: priority should be %d", prio)
+	}
+	if opts.AgeingTime == nil || *opts.AgeingTime != ageing {
+		t.Errorf("Error: ageing_time should not be changed")
+	}
+	t.Logf("confirmed.")
+}
+
+func TestBridgeVlan(t *testing.T) {
+	brName := "brTestVlan"
+	port, peer := "brvlan-p0", "brvlan-p1"
+
+	if ok, _ := BridgeIfExists(brName); ok {
+		BridgeDelete(brName)
+	}
+	br, err := BridgeAdd(brName, nil, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BridgeDelete(brName)
+	if _, err := VethAdd(port, peer, Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete(port)
+	if err := br.BindIf(port); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("Enabling VLAN filtering on %s...", brName)
+	if err := br.SetVlanFiltering(true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := br.VlanFiltering(); err != nil || !on {
+		t.Fatalf("Error: VLAN filtering should be on: %v", err)
+	}
+	t.Logf("Adding VLANs to %s...", port)
+	if err := br.VlanAdd(port, 10, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := br.VlanAddRange(port, 100, 102, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := br.VlanAdd(peer, 20, false, false); err == nil {
+		t.Errorf("Error: %s is not a port of %s", peer, brName)
+	}
+	tbls, err := br.VlanList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tbls[peer]; ok {
+		t.Errorf("Error: %s should not be listed", peer)
+	}
+	vids := make(map[uint16]BridgeVlan)
+	for _, v := range tbls[port] {
+		vids[v.Vid] = v
+	}
+	if v, ok := vids[10]; !ok || !v.Pvid || !v.Untagged {
+		t.Errorf("Error: vid 10 should be PVID and untagged: %v", tbls[port])
+	}
+	for vid := uint16(100); vid <= 102; vid++ {
+		if v, ok := vids[vid]; !ok || v.Pvid || v.Untagged {
+			t.Errorf("Error: vid %d should be tagged: %v", vid, tbls[port])
+		}
+	}
+	t.Logf("Deleting VLANs from %s...", port)
+	if err := BridgeVlanDelete(brName, port, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := br.VlanDeleteRange(port, 100, 102); err != nil {
+		t.Fatal(err)
+	}
+	if tbls, err = BridgeVlanList(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range tbls[port] {
+		if v.Vid == 10 || (v.Vid >= 100 && v.Vid <= 102) {
+			t.Errorf("Error: vid %d should be deleted", v.Vid)
+		}
+	}
+	t.Logf("confirmed.")
+}
+
+func TestBridgeFdb(t *testing.T) {
+	brName := "brTestFdb"
+	port, peer, vxName := "brfdb-p0", "brfdb-p1", "brfdb-vx"
+	mac, _ := net.ParseMAC("02:00:00:00:10:01")
+	bum, _ := net.ParseMAC("00:00:00:00:00:00")
+	vtep := net.ParseIP("192.0.2.1")
+
+	if ok, _ := BridgeIfExists(brName); ok {
+		BridgeDelete(brName)
+	}
+	br, err := BridgeAdd(brName, nil, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BridgeDelete(brName)
+	if _, err := VethAdd(port, peer, Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete(port)
+	if err := br.BindIf(port); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("ip", "link", "add", vxName, "type", "vxlan",
+		"id", "100", "dstport", "4789").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	defer LinkDel(vxName)
+	if err := br.BindIf(vxName); err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(port string, mac net.HardwareAddr) *FdbEntry {
+		fdb, err := br.FdbList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range fdb {
+			if fdb[i].Port == port && bytes.Equal(fdb[i].Mac, mac) {
+				return &fdb[i]
+			}
+		}
+		return nil
+	}
+	t.Logf("Adding static entry %s on %s...", mac, port)
+	if err := br.FdbAdd(port, mac, 0); err != nil {
+		t.Fatal(err)
+	}
+	if e := find(port, mac); e == nil || !e.Static || e.Permanent {
+		t.Errorf("Error: %s should be a static entry: %v", mac, e)
+	}
+	if err := br.FdbAdd(peer, mac, 0); err == nil {
+		t.Errorf("Error: %s is not a port of %s", peer, brName)
+	}
+	t.Logf("Flushing %s...", port)
+	if err := br.FdbFlush(port, 0); err != nil {
+		t.Fatal(err)
+	}
+	if e := find(port, mac); e != nil {
+		t.Errorf("Error: %s should be flushed", mac)
+	}
+	if err := br.FdbAdd(port, mac, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := br.FdbDelete(port, mac, 0); err != nil {
+		t.Fatal(err)
+	}
+	if e := find(port, mac); e != nil {
+		t.Errorf("Error: %s should be deleted", mac)
+	}
+
+	t.Logf("Adding remote VTEP %s on %s...", vtep, vxName)
+	if err := br.FdbAddRemote(port, bum, vtep, 0); err == nil {
+		t.Errorf("Error: %s is not a VXLAN port", port)
+	}
+	if err := br.FdbAddRemote(vxName, bum, vtep, 0); err != nil {
+		t.Fatal(err)
+	}
+	fdb, err := br.FdbList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range fdb {
+		if e.Port == vxName && e.Dst.Equal(vtep) && bytes.Equal(e.Mac, bum) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Error: remote VTEP %s not found: %v", vtep, fdb)
+	}
+	if err := br.FdbDeleteRemote(vxName, bum, vtep, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestBridgePort(t *testing.T) {
+	brName := "brTestPort"
+	port, peer := "brport-p0", "brport-p1"
+	cost := uint32(42)
+	off, on := false, true
+
+	if ok, _ := BridgeIfExists(brName); ok {
+		BridgeDelete(brName)
+	}
+	br, err := BridgeAdd(brName, nil, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BridgeDelete(brName)
+	if _, err := VethAdd(port, peer, Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete(port)
+	if _, err := BridgePortGetByName(port); err == nil {
+		t.Errorf("Error: %s is not bound to a bridge yet", port)
+	}
+	p, err := br.BindPort(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Setting cost %d, learning off, hairpin on to %s...", cost, port)
+	err = p.SetOptions(&BridgePortOptions{
+		Cost: &cost, Learning: &off, Hairpin: &on, Isolated: &on,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err = BridgePortGetByName(port); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := p.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Cost == nil || *opts.Cost != cost {
+		t.Errorf("Error: cost should be %d", cost)
+	}
+	if opts.Learning == nil || *opts.Learning {
+		t.Errorf("Error: learning should be off")
+	}
+	if opts.Hairpin == nil || !*opts.Hairpin {
+		t.Errorf("Error: hairpin should be on")
+	}
+	if opts.Isolated == nil || !*opts.Isolated {
+		t.Errorf("Error: isolated should be on")
+	}
+	if opts.UnicastFlood == nil || !*opts.UnicastFlood {
+		t.Errorf("Error: unicast flood should not be changed")
+	}
+	if s, err := p.StpState(); err != nil || s != StpForwarding {
+		t.Errorf("Error: STP state %s should be forwarding: %v", s, err)
+	}
+	if ports, err := br.Ports(); err != nil || len(ports) != 1 ||
+		ports[0].Name() != port {
+		t.Errorf("Error: %v should be [%s]: %v", ports, port, err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestBridgeMdb(t *testing.T) {
+	brName := "brTestMdb"
+	port, peer := "brmdb-p0", "brmdb-p1"
+	group := net.ParseIP("239.1.1.1")
+	source := net.ParseIP("192.0.2.10")
+
+	if ok, _ := BridgeIfExists(brName); ok {
+		BridgeDelete(brName)
+	}
+	br, err := BridgeAdd(brName, nil, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BridgeDelete(brName)
+	if _, err := VethAdd(port, peer, Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete(port)
+	p, err := br.BindPort(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("Enabling snooping and querier on %s...", brName)
+	if err := br.SetMulticastSnooping(true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := br.MulticastSnooping(); err != nil || !on {
+		t.Errorf("Error: snooping should be on: %v", err)
+	}
+	if err := br.SetMulticastQuerier(true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := br.MulticastQuerier(); err != nil || !on {
+		t.Errorf("Error: querier should be on: %v", err)
+	}
+	t.Logf("Making %s a permanent router port...", port)
+	if err := p.SetMulticastRouter(McastRouterPerm); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := p.MulticastRouter(); err != nil || m != McastRouterPerm {
+		t.Errorf("Error: router mode %d should be %d: %v",
+			m, McastRouterPerm, err)
+	}
+	if rp, err := br.MdbRouterPorts(); err != nil || len(rp) != 1 ||
+		rp[0] != port {
+		t.Errorf("Error: router ports %v should be [%s]: %v", rp, port, err)
+	}
+
+	t.Logf("Adding group %s on %s...", group, port)
+	if err := br.MdbAdd(port, group, 0, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := br.MdbAdd(port, group, 0, false, source); err != nil {
+		t.Fatal(err)
+	}
+	mdb, err := br.MdbList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var star, ssm bool
+	for _, e := range mdb {
+		if e.Port != port || !e.Group.Equal(group) {
+			continue
+		}
+		if e.Source == nil && e.Permanent {
+			star = true
+		}
+		if e.Source.Equal(source) && !e.Permanent {
+			ssm = true
+		}
+	}
+	if !star || !ssm {
+		t.Errorf("Error: (*, %s) and (%s, %s) should exist: %v",
+			group, source, group, mdb)
+	}
+	t.Logf("Deleting group %s from %s...", group, port)
+	if err := br.MdbDelete(port, group, 0, source); err != nil {
+		t.Fatal(err)
+	}
+	if err := br.MdbDelete(port, group, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mdb, err = br.MdbList(); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range mdb {
+		if e.Port == port && e.Group.Equal(group) {
+			t.Errorf("Error: %v should be deleted", e)
+		}
+	}
+	t.Logf("confirmed.")
+}
+
+func TestTopology(t *testing.T) {
+	doc := `
+namespaces: [iprouteTopoNs]
+bridges:
+  - name: brTopo
+    addresses: [192.168.77.1/24]
+veths:
+  - name: topo-br
+    master: brTopo
+    peer:
+      name: topo-ns
+      netns: iprouteTopoNs
+      addresses: [192.168.77.2/24]
+routes:
+  - dst: 10.77.0.0/16
+    via: [192.168.77.2]
+  - dst: 10.78.0.0/16
+    dev: topo-ns
+    netns: iprouteTopoNs
+`
+	topo, err := TopologyFromYAML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TopologyFromYAML([]byte("bridge: [x]")); err == nil {
+		t.Errorf("Error: unknown field should be rejected")
+	}
+	js, err := TopologyFromJSON([]byte(`{"veths": [{"name": "a",
+		"master": "br", "peer": {"name": "b", "netns": "ns"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := js.Veths[0]; v.Name != "a" || v.Master != "br" ||
+		v.Peer.Name != "b" || v.Peer.Netns != "ns" {
+		t.Errorf("Error: JSON is not parsed correctly: %+v", v)
+	}
+
+	defer topo.Destroy()
+	for i := 0; i < 2; i++ {
+		t.Logf("Applying topology (%d)...", i+1)
+		if err := topo.Apply(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, err := BridgePortGetByName("topo-br"); err != nil {
+		t.Error(err)
+	} else if br, _ := p.Bridge(); br == nil || br.Name() != "brTopo" {
+		t.Errorf("Error: topo-br should be bound to brTopo")
+	}
+	h, err := NewHandleByName("iprouteTopoNs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	addr := &net.IPNet{IP: net.ParseIP("192.168.77.2"),
+		Mask: net.CIDRMask(24, 32)}
+	if ok, err := h.IsIfPrefix("topo-ns", addr); !ok {
+		t.Errorf("Error: topo-ns should have 192.168.77.2/24: %v", err)
+	}
+	if up, err := h.IfIsUpByName("topo-ns"); !up {
+		t.Errorf("Error: topo-ns should be up: %v", err)
+	}
+
+	t.Logf("Destroying topology...")
+	if err := topo.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := BridgeIfExists("brTopo"); ok {
+		t.Errorf("Error: brTopo should be deleted")
+	}
+	if ok, _ := NetnsExists("iprouteTopoNs"); ok {
+		t.Errorf("Error: iprouteTopoNs should be deleted")
+	}
+	if err := topo.Destroy(); err != nil {
+		t.Errorf("Error: Destroy() should ignore missing objects: %v", err)
+	}
+
+	//
+	// the peer cannot be placed. Nothing should be left behind.
+	//
+	const ns = "iprouteTopoNs2"
+	topo = &Topology{
+		Namespaces: []string{ns},
+		Veths: []VethSpec{{VethEnd: VethEnd{Name: "topo-a"},
+			Peer: VethEnd{Name: "topo-b", Netns: ns}}},
+	}
+	defer topo.Destroy()
+	if err := NetnsAdd(ns); err != nil {
+		t.Fatal(err)
+	}
+	nh, err := NewHandleByName(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nh.Close()
+	if _, err := nh.VethAdd("topo-b", "topo-c", Down); err != nil {
+		t.Fatal(err)
+	}
+	if err := topo.Apply(); err == nil {
+		t.Errorf("Error: Apply() should fail: topo-b exists in %s", ns)
+	}
+	if ok, _ := VethIfExists("topo-a"); ok {
+		t.Errorf("Error: topo-a should not be left behind")
+	}
+	if err := nh.VethDelete("topo-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := topo.Apply(); err != nil {
+		t.Errorf("Error: Apply() should succeed: %v", err)
+	}
+	if ok, _ := VethIfExists("topo-a"); !ok {
+		t.Errorf("Error: topo-a should be created")
+	}
+	if ok, _ := nh.VethIfExists("topo-b"); !ok {
+		t.Errorf("Error: topo-b should be in %s", ns)
+	}
+	if err := topo.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VethAdd("topo-x", "topo-y", Down); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete("topo-x")
+	topo = &Topology{Bridges: []BridgeSpec{{Name: "topo-x"}}}
+	if err := topo.Destroy(); err == nil {
+		t.Errorf("Error: Destroy() should not delete veth topo-x as bridge")
+	}
+	if ok, _ := VethIfExists("topo-x"); !ok {
+		t.Errorf("Error: veth topo-x should not be deleted")
+	}
+	t.Logf("confirmed.")
+}
+
+func TestPlan(t *testing.T) {
+	topo := &Topology{
+		Namespaces: []string{"iproutePlanNs"},
+		Bridges: []BridgeSpec{
+			{Name: "brPlan", Addresses: []string{"192.168.78.1/24"}},
+		},
+		Veths: []VethSpec{{
+			VethEnd: VethEnd{Name: "plan-br", Master: "brPlan"},
+			Peer: VethEnd{Name: "plan-ns", Netns: "iproutePlanNs",
+				Addresses: []string{"192.168.78.2/24"}},
+		}},
+		Routes: []RouteSpec{
+			{Dst: "10.78.0.0/16", Via: []string{"192.168.78.2"}},
+		},
+	}
+	defer topo.Destroy()
+
+	p, err := topo.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Plan:\n%s", p)
+	for _, op := range p.Ops {
+		if op.Action != PlanCreate {
+			t.Errorf("Error: %s: should be create", op.String())
+		}
+	}
+	if s := p.String(); !regexp.MustCompile(`(?m)^\+ bridge brPlan$`).MatchString(s) ||
+		!regexp.MustCompile(`(?m)^\+ address 192.168.78.2/24@iproutePlanNs: on plan-ns$`).MatchString(s) ||
+		!regexp.MustCompile(`(?m)^\+ route 10.78.0.0/16: via 192.168.78.2$`).MatchString(s) {
+		t.Errorf("Error: unexpected plan:\n%s", s)
+	}
+	for i := range p.Ops {
+		t.Logf("Applying %s", p.Ops[i].String())
+		if err := p.Ops[i].Apply(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, err = topo.Plan(); err != nil {
+		t.Fatal(err)
+	} else if !p.Empty() {
+		t.Errorf("Error: plan should be empty:\n%s", p)
+	}
+
+	stray := &net.IPNet{IP: net.ParseIP("192.168.79.1"),
+		Mask: net.CIDRMask(24, 32)}
+	if err := IpAddrAdd("brPlan", stray, Down); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = topo.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Plan:\n%s", p)
+	if len(p.Ops) != 1 || p.Ops[0].Action != PlanDelete ||
+		p.Ops[0].Name != "192.168.79.1/24" {
+		t.Fatalf("Error: only 192.168.79.1/24 should be deleted:\n%s", p)
+	}
+	if err := p.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := IsIfPrefix("brPlan", stray); ok {
+		t.Errorf("Error: 192.168.79.1/24 should be deleted")
+	}
+	if err := topo.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	//
+	// IPv4 and IPv6 default routes in the same VRF table
+	//
+	topo = &Topology{
+		Vrfs: []VrfSpec{{Name: "vrfPlan", Table: 78}},
+		Veths: []VethSpec{{
+			VethEnd: VethEnd{Name: "plan-vrf", Master: "vrfPlan",
+				Addresses: []string{"192.168.81.1/24"}},
+			Peer: VethEnd{Name: "plan-vrf-peer"},
+		}},
+		Routes: []RouteSpec{
+			{Dst: "0.0.0.0/0", Via: []string{"192.168.81.2"}, Vrf: "vrfPlan"},
+		},
+	}
+	defer topo.Destroy()
+	if p, err = topo.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := IfIndex("plan-vrf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dst, _ := net.ParseCIDR("::/0")
+	r := &Route{Dst: dst, LinkIndex: index, Scope: SCOPE_LINK}
+	if err := VrfAddRouteByName("vrfPlan", r); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = topo.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Plan:\n%s", p)
+	if len(p.Ops) != 1 || p.Ops[0].Action != PlanDelete ||
+		p.Ops[0].Name != "default" {
+		t.Errorf("Error: only the IPv6 default should be deleted:\n%s", p)
+	}
+	if err := topo.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestTx(t *testing.T) {
+	const ns = "iprouteTxNs"
+	addr := &net.IPNet{IP: net.ParseIP("192.168.80.1"),
+		Mask: net.CIDRMask(24, 32)}
+	_, dst, _ := net.ParseCIDR("10.80.0.0/16")
+	route := &Route{Dst: dst, Gw: net.ParseIP("192.168.80.2")}
+
+	if err := NetnsAdd(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(ns)
+
+	build := func(tx *Tx) error {
+		if _, err := tx.BridgeAdd("brTx", nil, Up); err != nil {
+			return err
+		}
+		if _, err := tx.VethAdd("tx-br", "tx-ns", Up); err != nil {
+			return err
+		}
+		if err := tx.BindIf("brTx", "tx-br"); err != nil {
+			return err
+		}
+		if err := tx.IpAddrAdd("brTx", addr, Up); err != nil {
+			return err
+		}
+		if err := tx.AddRoute(route); err != nil {
+			return err
+		}
+		return tx.IfSetNS("tx-ns", ns)
+	}
+	gone := func() {
+		for _, name := range []string{"brTx", "tx-br", "tx-ns"} {
+			if _, err := IfIndex(name); err == nil {
+				t.Errorf("Error: %s should be deleted", name)
+			}
+		}
+	}
+
+	t.Logf("Rolling back on error...")
+	tx := TxBegin()
+	if err := build(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.BindIf("noSuchMaster", "tx-br"); err == nil {
+		t.Fatalf("Error: BindIf(noSuchMaster) should fail")
+	} else {
+		t.Logf("%v", err)
+	}
+	gone()
+	if err := tx.BindIf("brTx", "tx-br"); err == nil {
+		t.Errorf("Error: ended transaction should not be used")
+	}
+
+	t.Logf("Rolling back explicitly...")
+	tx = TxBegin()
+	if err := build(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	gone()
+
+	t.Logf("Committing...")
+	tx = TxBegin()
+	if err := build(tx); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	defer LinkDel("brTx")
+	defer LinkDel("tx-br")
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := BridgePortGetByName("tx-br"); err != nil {
+		t.Error(err)
+	} else if br, _ := p.Bridge(); br == nil || br.Name() != "brTx" {
+		t.Errorf("Error: tx-br should be bound to brTx")
+	}
+	if ok, err := IsIfPrefix("brTx", addr); !ok {
+		t.Errorf("Error: brTx should have %s: %v", addr, err)
+	}
+
+	//
+	// a VXLAN interface cannot be brought up if its port is in use
+	//
+	t.Logf("Rolling back an address added to a link that cannot be up...")
+	conn, err := net.ListenPacket("udp4", ":48780")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := VxlanAdd("vxTx", &VxlanOptions{Vni: 80, Port: 48780,
+		Remote: net.ParseIP("192.168.81.2")}, Down); err != nil {
+		t.Fatal(err)
+	}
+	defer VxlanDelete("vxTx")
+	vxAddr := &net.IPNet{IP: net.ParseIP("192.168.81.1"),
+		Mask: net.CIDRMask(24, 32)}
+	tx = TxBegin()
+	if err := tx.IpAddrAdd("vxTx", vxAddr, Up); err == nil {
+		t.Errorf("Error: vxTx should not be brought up")
+	} else {
+		t.Logf("%v", err)
+	}
+	if ok, _ := IsIfPrefix("vxTx", vxAddr); ok {
+		t.Errorf("Error: %s should be deleted from vxTx", vxAddr)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestBond(t *testing.T) {
+	const name = "bondTest1"
+	members := [2][2]string{
+		{"bond-m1", "m1-bond"},
+		{"bond-m2", "m2-bond"},
+	}
+
+	if _, err := BondAdd(name, &BondOptions{Mode: "no-such-mode"}, Down); err == nil {
+		t.Errorf("Error: unknown mode should be rejected")
+	}
+	bond, err := BondAdd(name, &BondOptions{Mode: "active-backup",
+		Miimon: 100}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BondDelete(name)
+	if bond.Mode() != "active-backup" || bond.Link.Miimon != 100 {
+		t.Errorf("Error: mode %s, miimon %d", bond.Mode(), bond.Link.Miimon)
+	}
+	if ok, _ := BondIfExists(name); !ok {
+		t.Errorf("Error: BondIfExists(%s) should be true", name)
+	}
+	if bonds, err := BondList(); err != nil || len(bonds) == 0 {
+		t.Errorf("Error: BondList(): %v", err)
+	}
+	for _, m := range members {
+		if _, err := VethAdd(m[0], m[1], Up); err != nil {
+			t.Fatal(err)
+		}
+		defer VethDelete(m[0])
+		if err := bond.AddSlave(m[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slaves, err := bond.Slaves()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slaves) != 2 {
+		t.Fatalf("Error: %s should have 2 slaves: %+v", name, slaves)
+	}
+	for _, s := range slaves {
+		t.Logf("%s: %s, mii %s", s.Name, s.State, s.MiiStatus)
+	}
+	if err := bond.SetActiveSlave(members[1][0]); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := bond.ActiveSlave(); err != nil {
+		t.Error(err)
+	} else if s != members[1][0] {
+		t.Errorf("Error: active slave is %s, not %s", s, members[1][0])
+	}
+	if err := bond.DeleteSlave(members[0][0]); err != nil {
+		t.Fatal(err)
+	}
+	if slaves, _ := bond.Slaves(); len(slaves) != 1 {
+		t.Errorf("Error: %s should have 1 slave: %+v", name, slaves)
+	}
+	if err := BondDelete(name); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestMacvlan(t *testing.T) {
+	const ns = "iprouteMacvlanNs"
+	macs := []net.HardwareAddr{
+		{0x02, 0, 0, 0, 0x81, 1},
+		{0x02, 0, 0, 0, 0x81, 2},
+	}
+
+	if _, err := VethAdd("mv-parent", "mv-peer", Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete("mv-parent")
+
+	if _, err := MacvlanAdd("mvTest", "mv-parent", "no-such-mode", Down); err == nil {
+		t.Errorf("Error: unknown mode should be rejected")
+	}
+	m, err := MacvlanAdd("mvTest", "mv-parent", "source", Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Mode() != "source" || m.IsTap() {
+		t.Errorf("Error: %s: mode %s, tap %v", m.Name(), m.Mode(), m.IsTap())
+	}
+	for _, mac := range macs {
+		if err := m.AddSourceMac(mac); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l, err := m.SourceMacs(); err != nil {
+		t.Error(err)
+	} else if len(l) != 2 {
+		t.Errorf("Error: %s should have 2 source MACs: %v", m.Name(), l)
+	}
+	if err := m.DeleteSourceMac(macs[0]); err != nil {
+		t.Error(err)
+	}
+	if l, _ := m.SourceMacs(); len(l) != 1 || l[0].String() != macs[1].String() {
+		t.Errorf("Error: %s should have %s only: %v", m.Name(), macs[1], l)
+	}
+	if err := m.FlushSourceMacs(); err != nil {
+		t.Error(err)
+	}
+	if l, _ := m.SourceMacs(); len(l) != 0 {
+		t.Errorf("Error: %s should have no source MACs: %v", m.Name(), l)
+	}
+
+	tap, err := MacvtapAdd("mvtapTest", "mv-parent", "bridge", Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tap.Mode() != "bridge" || !tap.IsTap() {
+		t.Errorf("Error: %s: mode %s, tap %v", tap.Name(), tap.Mode(), tap.IsTap())
+	}
+	if _, err := MacvlanGetByName("mvtapTest"); err == nil {
+		t.Errorf("Error: mvtapTest is not MACVLAN")
+	}
+	if l, _ := MacvlanList(); len(l) != 1 {
+		t.Errorf("Error: MacvlanList() should return 1 interface: %d", len(l))
+	}
+	if l, _ := MacvtapList(); len(l) != 1 {
+		t.Errorf("Error: MacvtapList() should return 1 interface: %d", len(l))
+	}
+	if err := MacvtapDelete("mvtapTest"); err != nil {
+		t.Error(err)
+	}
+	if err := MacvlanDelete("mvTest"); err != nil {
+		t.Error(err)
+	}
+
+	if err := NetnsAdd(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(ns)
+	if err := MacvlanAddNS("mvTestNs", "mv-parent", "bridge", ns, Up); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandleByName(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if m, err := h.MacvlanGetByName("mvTestNs"); err != nil {
+		t.Error(err)
+	} else if up, _ := h.IfIsUpByName(m.Name()); !up {
+		t.Errorf("Error: %s should be up", m.Name())
+	}
+	if _, err := IfIndex("mvTestNs"); err == nil {
+		t.Errorf("Error: mvTestNs should not be in this namespace")
+	}
+	t.Logf("confirmed.")
+}
+
+func TestIpvlan(t *testing.T) {
+	if _, err := VethAdd("ipvl-parent", "ipvl-peer", Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete("ipvl-parent")
+
+	if _, err := IpvlanAdd("ipvl-parent", "ipvlTest1", "l4", ""); err == nil {
+		t.Errorf("Error: unknown mode should be rejected")
+	}
+	ipvlan, err := IpvlanAdd("ipvl-parent", "ipvlTest1", "l2", "private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ipvlan.Mode() != "l2" || ipvlan.Flag() != "private" {
+		t.Errorf("Error: %s: mode %s, flag %s",
+			ipvlan.Name(), ipvlan.Mode(), ipvlan.Flag())
+	}
+	if _, err := IpvlanAdd("ipvl-parent", "ipvlTest2", "l3s", ""); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := IpvlanList("ipvl-parent"); err != nil {
+		t.Error(err)
+	} else if len(l) != 2 {
+		t.Errorf("Error: ipvl-parent should have 2 IPVLANs: %d", len(l))
+	}
+	for _, name := range []string{"ipvlTest1", "ipvlTest2"} {
+		if err := IpvlanDelete(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if l, _ := IpvlanList("ipvl-parent"); len(l) != 0 {
+		t.Errorf("Error: ipvl-parent should have no IPVLANs: %d", len(l))
+	}
+	t.Logf("confirmed.")
+}
+
+func TestVxlan(t *testing.T) {
+	if _, err := VethAdd("vx-underlay", "underlay-vx", Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete("vx-underlay")
+
+	learning := false
+	vx, err := VxlanAdd("vxTest1", &VxlanOptions{
+		Vni:      100,
+		Local:    net.ParseIP("192.168.82.1"),
+		Remote:   net.ParseIP("192.168.82.2"),
+		Dev:      "vx-underlay",
+		Learning: &learning,
+		Ttl:      64,
+		UdpCsum:  true,
+	}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VxlanDelete("vxTest1")
+	l := vx.Link
+	if vx.Vni() != 100 || l.Port != VxlanPort || l.Learning || l.TTL != 64 ||
+		!l.UDPCSum || !l.Group.Equal(net.ParseIP("192.168.82.2")) ||
+		!l.SrcAddr.Equal(net.ParseIP("192.168.82.1")) {
+		t.Errorf("Error: unexpected attributes: %+v", l)
+	}
+	br, err := BridgeAdd("brVxlan", nil, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer BridgeDelete("brVxlan")
+	if err := br.BindIf(vx.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if ports, _ := br.Ports(); len(ports) != 1 || ports[0].Name() != vx.Name() {
+		t.Errorf("Error: %s should be bound to %s", vx.Name(), br.Name())
+	}
+
+	if _, err := VxlanAdd("vxTest2", &VxlanOptions{Vni: 200,
+		External: true}, Down); err == nil {
+		t.Errorf("Error: VNI and external should be exclusive")
+	}
+	ext, err := VxlanAdd("vxTest2", &VxlanOptions{External: true,
+		VniFilter: true, Port: 4790}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VxlanDelete("vxTest2")
+	if ok, err := ext.VniFiltering(); !ok {
+		t.Errorf("Error: VNI filtering should be enabled: %v", err)
+	}
+	if !ext.Link.FlowBased || ext.Link.Port != 4790 || ext.Link.Learning {
+		t.Errorf("Error: unexpected attributes: %+v", ext.Link)
+	}
+	if err := ext.VniAdd(200, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ext.VniAdd(300, 309, net.ParseIP("192.168.82.3")); err != nil {
+		t.Fatal(err)
+	}
+	vnis, err := ext.VniList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("VNIs: %+v", vnis)
+	if len(vnis) != 2 || vnis[0].Vni != 200 || vnis[0].VniEnd != 0 ||
+		vnis[1].Vni != 300 || vnis[1].VniEnd != 309 ||
+		!vnis[1].Group.Equal(net.ParseIP("192.168.82.3")) {
+		t.Errorf("Error: unexpected VNI filter: %+v", vnis)
+	}
+	if err := ext.VniDelete(300, 309); err != nil {
+		t.Error(err)
+	}
+	if vnis, _ := ext.VniList(); len(vnis) != 1 {
+		t.Errorf("Error: only VNI 200 should remain: %+v", vnis)
+	}
+	if l, _ := VxlanList(); len(l) != 2 {
+		t.Errorf("Error: VxlanList() should return 2 interfaces: %d", len(l))
+	}
+	if ok, err := vx.TtlInherit(); ok || err != nil {
+		t.Errorf("Error: %s should not inherit TTL: %v", vx.Name(), err)
+	}
+	if _, err := VxlanAdd("vxTest3", &VxlanOptions{Vni: 300, Ttl: 64,
+		TtlInherit: true}, Down); err == nil {
+		t.Errorf("Error: TTL and TTL inherit should be exclusive")
+	}
+	inh, err := VxlanAdd("vxTest3", &VxlanOptions{Vni: 300,
+		Remote: net.ParseIP("192.168.82.4"), TtlInherit: true}, Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VxlanDelete("vxTest3")
+	if ok, err := inh.TtlInherit(); !ok {
+		t.Errorf("Error: %s should inherit TTL: %v", inh.Name(), err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestGeneve(t *testing.T) {
+	gnv, err := GeneveAdd("gnvTest1", &GeneveOptions{
+		Vni:     100,
+		Remote:  net.ParseIP("192.168.83.2"),
+		Ttl:     64,
+		Tos:     0x10,
+		UdpCsum: true,
+	}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer GeneveDelete("gnvTest1")
+	if gnv.Vni() != 100 || gnv.Port() != GenevePort || gnv.External() ||
+		!gnv.Remote().Equal(net.ParseIP("192.168.83.2")) ||
+		gnv.Link.Ttl != 64 || gnv.Link.Tos != 0x10 {
+		t.Errorf("Error: unexpected attributes: %+v", gnv.Link)
+	}
+
+	gnv, err = GeneveAdd("gnvTest2", &GeneveOptions{
+		Remote:         net.ParseIP("2001:db8::2"),
+		Vni:            200,
+		Port:           6082,
+		UdpZeroCsum6Tx: true,
+		UdpZeroCsum6Rx: true,
+	}, Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer GeneveDelete("gnvTest2")
+	if gnv.Vni() != 200 || gnv.Port() != 6082 ||
+		!gnv.Remote().Equal(net.ParseIP("2001:db8::2")) {
+		t.Errorf("Error: unexpected attributes: %+v", gnv.Link)
+	}
+
+	if _, err := GeneveAdd("gnvTest3", &GeneveOptions{Vni: 300,
+		External: true}, Down); err == nil {
+		GeneveDelete("gnvTest3")
+		t.Errorf("Error: VNI was accepted with external")
+	}
+	gnv, err = GeneveAdd("gnvTest3", &GeneveOptions{External: true,
+		Port: 6083}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer GeneveDelete("gnvTest3")
+	if !gnv.External() || gnv.Vni() != 0 {
+		t.Errorf("Error: %s should be external: %+v", gnv.Name(), gnv.Link)
+	}
+	if gnvs, _ := GeneveList(); len(gnvs) != 3 {
+		t.Errorf("Error: GeneveList() returned %d interfaces", len(gnvs))
+	}
+	if _, err := GeneveGetByName("lo"); err == nil {
+		t.Errorf("Error: lo should not be Geneve")
+	}
+	t.Logf("confirmed.")
+}
+
+func TestWireguard(t *testing.T) {
+	priv, err := WgGenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, err := ParseWgKey(priv.String()); err != nil || k != priv {
+		t.Fatalf("Error: ParseWgKey(%s): %v", priv, err)
+	}
+	if _, err := ParseWgKey("AAAA"); err == nil {
+		t.Errorf("Error: short key was accepted")
+	}
+	peerKey, _ := WgGenerateKey() // not a real public key, but works
+	psk, _ := WgGenerateKey()
+
+	wg, err := WireguardAdd("wgTest1", &WireguardOptions{
+		PrivateKey: &priv,
+		ListenPort: 51820,
+		Fwmark:     0x100,
+	}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer WireguardDelete("wgTest1")
+	_, allowed, _ := net.ParseCIDR("10.10.0.0/16")
+	_, allowed6, _ := net.ParseCIDR("2001:db8:10::/48")
+	peer := WgPeer{
+		PublicKey:    peerKey,
+		PresharedKey: &psk,
+		Endpoint:     &net.UDPAddr{IP: net.ParseIP("192.0.2.2"), Port: 51821},
+		AllowedIPs:   []net.IPNet{*allowed, *allowed6},
+		Keepalive:    25,
+	}
+	if err := wg.AddPeer(&peer); err != nil {
+		t.Fatal(err)
+	}
+	dev, err := wg.Device()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.PublicKey.IsZero() || dev.ListenPort != 51820 ||
+		dev.Fwmark != 0x100 || len(dev.Peers) != 1 {
+		t.Fatalf("Error: unexpected device: %+v", dev)
+	}
+	p := dev.Peers[0]
+	if p.PublicKey != peerKey || p.PresharedKey == nil ||
+		*p.PresharedKey != psk || p.Keepalive != 25 ||
+		p.Endpoint.String() != peer.Endpoint.String() ||
+		len(p.AllowedIPs) != 2 || !p.LastHandshake.IsZero() {
+		t.Errorf("Error: unexpected peer: %+v", p)
+	}
+	if err := wg.SetListenPort(51822); err != nil {
+		t.Error(err)
+	}
+	if err := wg.DeletePeer(peerKey); err != nil {
+		t.Fatal(err)
+	}
+	if peers, err := wg.Peers(); err != nil || len(peers) != 0 {
+		t.Errorf("Error: peers remain: %+v: %v", peers, err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestTuntap(t *testing.T) {
+	const ns = "iprouteTuntapNs"
+	var uid, gid uint32 = 1000, 1000
+
+	tun, err := TunAdd("tunTest1", &TuntapOptions{
+		Persist: true,
+		Owner:   &uid,
+		Group:   &gid,
+	}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer TuntapDelete("tunTest1")
+	if len(tun.Files) != 1 {
+		t.Errorf("Error: %s: %d queues are open", tun.Name(), len(tun.Files))
+	}
+	if err := tun.Close(); err != nil {
+		t.Error(err)
+	}
+	tun, err = TuntapGetByName("tunTest1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tun.IsTap() || !tun.Persist() {
+		t.Errorf("Error: %s should be persistent TUN: %+v", tun.Name(), tun.Link)
+	}
+	if owner, ok, err := tun.Owner(); !ok || owner != uid {
+		t.Errorf("Error: %s: owner %d: %v", tun.Name(), owner, err)
+	}
+	if group, ok, err := tun.Group(); !ok || group != gid {
+		t.Errorf("Error: %s: group %d: %v", tun.Name(), group, err)
+	}
+	if _, err := tun.Open(); err != nil {
+		t.Error(err)
+	}
+	tun.Close()
+
+	tap, err := TapAdd("tapTest1", &TuntapOptions{
+		MultiQueue: true,
+		Queues:     2,
+		VnetHdr:    true,
+	}, Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tap.IsTap() || tap.Persist() || !tap.MultiQueue() ||
+		len(tap.Files) != 2 {
+		t.Errorf("Error: %s: unexpected attributes: %+v", tap.Name(), tap.Link)
+	}
+	if owner, ok, err := tap.Owner(); ok || err != nil {
+		t.Errorf("Error: %s should have no owner: %d, %v", tap.Name(), owner, err)
+	}
+	if group, ok, err := tap.Group(); ok || err != nil {
+		t.Errorf("Error: %s should have no group: %d, %v", tap.Name(), group, err)
+	}
+	if _, err := tap.Open(); err != nil || len(tap.Files) != 3 {
+		t.Errorf("Error: %s: cannot open a queue: %v", tap.Name(), err)
+	}
+	if taps, _ := TuntapList(); len(taps) < 2 {
+		t.Errorf("Error: TuntapList() returned %d interfaces", len(taps))
+	}
+	tap.Close()
+	if _, err := TuntapGetByName("tapTest1"); err == nil {
+		TuntapDelete("tapTest1")
+		t.Errorf("Error: non-persistent tapTest1 remains")
+	}
+
+	if err := NetnsAdd(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(ns)
+	h, err := NewHandleByName(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	tap, err = h.TapAdd("tapTestNs", nil, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+	if tap, err := h.TuntapGetByName("tapTestNs"); err == nil {
+		if _, ok, err := tap.Owner(); ok || err != nil {
+			t.Errorf("Error: tapTestNs should have no owner: %v", err)
+		}
+		if _, ok, err := tap.Group(); ok || err != nil {
+			t.Errorf("Error: tapTestNs should have no group: %v", err)
+		}
+	} else {
+		t.Error(err)
+	}
+	if _, err := IfIndex("tapTestNs"); err == nil {
+		t.Errorf("Error: tapTestNs should not be in this namespace")
+	}
+	t.Logf("confirmed.")
+}
+
+func TestDummy(t *testing.T) {
+	ifb, err := IfbAdd("ifbTest1", Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer IfbDelete("ifbTest1")
+	if up, _ := IfIsUpByName(ifb.Name()); !up || ifb.Index() == 0 {
+		t.Errorf("Error: %s should be up", ifb.Name())
+	}
+	if ifbs, _ := IfbList(); len(ifbs) == 0 {
+		t.Errorf("Error: IfbList() returned no interfaces")
+	}
+	if _, err := DummyGetByName(ifb.Name()); err == nil {
+		t.Errorf("Error: %s should not be dummy", ifb.Name())
+	}
+
+	dummy, err := DummyAdd("dummyTest1", Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DummyDelete("dummyTest1")
+	ip, ipnet, _ := net.ParseCIDR("10.99.0.1/32")
+	ipnet.IP = ip
+	if err := IpAddrAdd(dummy.Name(), ipnet, Up); err != nil {
+		t.Error(err)
+	}
+	if dummies, _ := DummyList(); len(dummies) != 1 ||
+		dummies[0].Index() != dummy.Index() {
+		t.Errorf("Error: DummyList() returned %+v", dummies)
+	}
+
+	nlmon, err := NlmonAdd("nlmonTest1", Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nlmons, _ := NlmonList(); len(nlmons) != 1 {
+		t.Errorf("Error: NlmonList() returned %d interfaces", len(nlmons))
+	}
+	if err := NlmonDelete(nlmon.Name()); err != nil {
+		t.Error(err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestMacsec(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:02")
+	peerSci := MacsecSci(mac, 1)
+	if peerSci != 0x0200000000020001 {
+		t.Errorf("Error: MacsecSci(%s, 1): %016x", mac, peerSci)
+	}
+	if _, err := VethAdd("ms-parent", "parent-ms", Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete("ms-parent")
+
+	m, err := MacsecAdd("msTest1", "ms-parent", &MacsecOptions{
+		Port:          11,
+		CipherSuite:   "gcm-aes-128",
+		Encrypt:       true,
+		ReplayProtect: true,
+		Window:        32,
+	}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer MacsecDelete("msTest1")
+	opts, err := m.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Sci&0xffff != 11 || opts.CipherSuite != "gcm-aes-128" ||
+		!opts.Encrypt || !*opts.Protect || !opts.ReplayProtect ||
+		opts.Window != 32 || opts.Validate != "strict" {
+		t.Errorf("Error: %s: unexpected attributes: %+v", m.Name(), opts)
+	}
+
+	key := make([]byte, 16)
+	sa := MacsecSA{An: 0, Active: true, Pn: 100, Key: key}
+	sa.KeyId[0] = 1
+	if err := m.TxSAAdd(&sa); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RxSCAdd(peerSci, true); err != nil {
+		t.Fatal(err)
+	}
+	sa.An = 1
+	if err := m.RxSAAdd(peerSci, &sa); err != nil {
+		t.Fatal(err)
+	}
+	if sas, err := m.TxSAList(); err != nil || len(sas) != 1 ||
+		sas[0].An != 0 || !sas[0].Active || sas[0].Pn != 100 ||
+		sas[0].KeyId != sa.KeyId {
+		t.Errorf("Error: %s: TX SAs: %+v: %v", m.Name(), sas, err)
+	}
+	scs, err := m.RxSCList()
+	if err != nil || len(scs) != 1 || scs[0].Sci != peerSci ||
+		len(scs[0].SAs) != 1 || scs[0].SAs[0].An != 1 {
+		t.Errorf("Error: %s: RX SCs: %+v: %v", m.Name(), scs, err)
+	}
+	if err := m.TxSAUpdate(&MacsecSA{An: 0}); err != nil {
+		t.Error(err)
+	}
+	if err := m.RxSADelete(peerSci, 1); err != nil {
+		t.Error(err)
+	}
+	if err := m.RxSCDelete(peerSci); err != nil {
+		t.Error(err)
+	}
+	if err := m.TxSADelete(0); err != nil {
+		t.Error(err)
+	}
+	if scs, _ := m.RxSCList(); len(scs) != 0 {
+		t.Errorf("Error: %s: RX SCs remain: %+v", m.Name(), scs)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestXfrm(t *testing.T) {
+	const (
+		ns   = "iprouteXfrmNs"
+		ifId = 42
+	)
+	if err := NetnsAdd(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer NetnsDelete(ns)
+	h, err := NewHandleByName(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	local, remote := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	_, any4, _ := net.ParseCIDR("0.0.0.0/0")
+	state := XfrmState{
+		Src:   local,
+		Dst:   remote,
+		Proto: XFRM_PROTO_ESP,
+		Mode:  XFRM_MODE_TUNNEL,
+		Spi:   0x100,
+		Reqid: 1,
+		Ifid:  ifId,
+		Aead: &XfrmStateAlgo{
+			Name:   "rfc4106(gcm(aes))",
+			Key:    make([]byte, 20),
+			ICVLen: 128,
+		},
+		Encap: &XfrmStateEncap{
+			Type:    XFRM_ENCAP_ESPINUDP,
+			SrcPort: 4500,
+			DstPort: 4500,
+		},
+	}
+	if err := h.XfrmStateAdd(&state); err != nil {
+		t.Fatal(err)
+	}
+	policy := XfrmPolicy{
+		Src:  any4,
+		Dst:  any4,
+		Dir:  XFRM_DIR_OUT,
+		Ifid: ifId,
+		Tmpls: []XfrmPolicyTmpl{{
+			Src:   local,
+			Dst:   remote,
+			Proto: XFRM_PROTO_ESP,
+			Mode:  XFRM_MODE_TUNNEL,
+			Reqid: 1,
+		}},
+	}
+	if err := h.XfrmPolicyAdd(&policy); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := h.XfrmStateGet(&state); err != nil {
+		t.Error(err)
+	} else if s.Spi != state.Spi || s.Ifid != ifId || s.Encap == nil ||
+		s.Aead == nil || s.Aead.Name != state.Aead.Name {
+		t.Errorf("Error: unexpected state: SPI %#x, if_id %d", s.Spi, s.Ifid)
+	}
+	if ps, err := h.XfrmPolicyList(FAMILY_V4); err != nil || len(ps) != 1 ||
+		ps[0].Ifid != ifId || len(ps[0].Tmpls) != 1 {
+		t.Errorf("Error: unexpected policies: %d: %v", len(ps), err)
+	}
+	if err := h.XfrmPolicyDelete(&policy); err != nil {
+		t.Error(err)
+	}
+	if err := h.XfrmStateFlush(XFRM_PROTO_IPSEC_ANY); err != nil {
+		t.Error(err)
+	}
+	if ss, _ := h.XfrmStateList(FAMILY_ALL); len(ss) != 0 {
+		t.Errorf("Error: %d states remain after flush", len(ss))
+	}
+	if err := h.XfrmStateAdd(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	//
+	// XFRM interface in a VRF
+	//
+	if _, err := h.VrfAdd("vrfXfrm", 1042, Up); err != nil {
+		t.Fatal(err)
+	}
+	x, err := h.XfrmiAdd("xfrmTest1", "", ifId, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.IfId() != ifId {
+		t.Errorf("Error: %s: if_id %d", x.Name(), x.IfId())
+	}
+	if err := h.VrfBindIf("vrfXfrm", x.Name()); err != nil {
+		t.Error(err)
+	}
+	if ss, err := x.States(); err != nil || len(ss) != 1 {
+		t.Errorf("Error: %s: %d states: %v", x.Name(), len(ss), err)
+	}
+	if xs, _ := h.XfrmiList(); len(xs) != 1 {
+		t.Errorf("Error: XfrmiList() returned %d interfaces", len(xs))
+	}
+	if err := h.XfrmiDelete(x.Name()); err != nil {
+		t.Error(err)
+	}
+	t.Logf("confirmed.")
+}
+
+func TestTunnel(t *testing.T) {
+	if _, err := VethAdd("tun-underlay", "underlay-tun", Up); err != nil {
+		t.Fatal(err)
+	}
+	defer VethDelete("tun-underlay")
+	if _, err := VxlanAdd("vxTun", &VxlanOptions{Vni: 10}, Down); err != nil {
+		t.Fatal(err)
+	}
+	defer VxlanDelete("vxTun")
+	if ok, err := IsTunnelByName("vxTun"); !ok {
+		t.Errorf("Error: vxTun should be a tunnel: %v", err)
+	}
+	if ok, _ := IsTunnelByName("tun-underlay"); ok {
+		t.Errorf("Error: tun-underlay should not be a tunnel")
+	}
+
+	tests := []struct {
+		name, kind string
+		opts       TunnelOptions
+	}{
+		{"greTest", "gre", TunnelOptions{
+			Local:  net.ParseIP("192.168.83.1"),
+			Remote: net.ParseIP("192.168.83.2"),
+			Dev:    "tun-underlay",
+			IKey:   10, OKey: 20, Ttl: 64}},
+		{"gretapTest", "gretap", TunnelOptions{
+			Local:      net.ParseIP("192.168.83.1"),
+			Remote:     net.ParseIP("192.168.83.3"),
+			NoPmtuDisc: true}},
+		{"ip6greTest", "ip6gre", TunnelOptions{
+			Local:      net.ParseIP("2001:db8::1"),
+			Remote:     net.ParseIP("2001:db8::2"),
+			EncapLimit: 2, Ttl: 32}},
+		{"erspanTest", "erspan", TunnelOptions{
+			Local:  net.ParseIP("192.168.83.1"),
+			Remote: net.ParseIP("192.168.83.4"),
+			IKey:   100, OKey: 100,
+			ErspanVer: 2, ErspanDir: 1, ErspanHwid: 7}},
+	}
+	if _, err := TunnelAdd("ip6greBad", "ip6gre", &TunnelOptions{
+		Local: net.ParseIP("192.168.83.1")}, Down); err == nil {
+		t.Errorf("Error: IPv4 endpoint for ip6gre should be rejected")
+	}
+	if _, err := TunnelAdd("erspanBad", "erspan", nil, Down); err == nil {
+		t.Errorf("Error: ERSPAN without a key should be rejected")
+	}
+	for _, test := range tests {
+		tun, err := TunnelAdd(test.name, test.kind, &test.opts, Up)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer TunnelDelete(test.name)
+		if tun.Kind() != test.kind {
+			t.Errorf("Error: %s: kind %s", tun.Name(), tun.Kind())
+		}
+		opts, err := tun.Options()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := test.opts
+		if want.ErspanVer == 0 && test.kind == "erspan" {
+			want.ErspanVer = 1
+		}
+		if !opts.Local.Equal(want.Local) || !opts.Remote.Equal(want.Remote) ||
+			opts.Dev != want.Dev || opts.IKey != want.IKey ||
+			opts.OKey != want.OKey || opts.Ttl != want.Ttl ||
+			opts.NoPmtuDisc != want.NoPmtuDisc ||
+			opts.ErspanVer != want.ErspanVer ||
+			opts.ErspanDir != want.ErspanDir ||
+			opts.ErspanHwid != want.ErspanHwid ||
+			(want.EncapLimit != 0 && opts.EncapLimit != want.EncapLimit) {
+			t.Errorf("Error: %s: %+v", tun.Name(), opts)
+		}
+		if ok, err := IsTunnelByName(test.name); !ok {
+			t.Errorf("Error: %s should be a tunnel: %v", test.name, err)
+		}
+	}
+	if tuns, _ := TunnelList(); len(tuns) < len(tests) {
+		t.Errorf("Error: TunnelList() returned %d tunnels", len(tuns))
+	}
+	t.Logf("confirmed.")
+}
+
+func TestIptunnel(t *testing.T) {
+	vrfName := "vrfIptun1"
+	_, sixrd, _ := net.ParseCIDR("2001:db8::/32")
+	_, relay, _ := net.ParseCIDR("10.0.0.0/8")
+	tests := []struct {
+		name string
+		kind string
+		opts TunnelOptions
+	}{
+		{"ipipTest1", "ipip", TunnelOptions{
+			Local:  net.ParseIP("192.0.2.1"),
+			Remote: net.ParseIP("192.0.2.2"),
+			Ttl:    64,
+		}},
+		{"sitTest1", "sit", TunnelOptions{
+			Local:       net.ParseIP("192.0.2.1"),
+			Ttl:         64,
+			SixrdPrefix: sixrd,
+			SixrdRelay:  relay,
+		}},
+		{"ip6tnlTest1", "ip6tnl", TunnelOptions{
+			Local:      net.ParseIP("2001:db8::1"),
+			Remote:     net.ParseIP("2001:db8::2"),
+			Mode:       "any",
+			EncapLimit: 4,
+			FlowLabel:  0x12345,
+		}},
+		{"ip6tnlTest2", "ip6tnl", TunnelOptions{
+			Local:        net.ParseIP("2001:db8::1"),
+			Remote:       net.ParseIP("2001:db8::3"),
+			NoEncapLimit: true,
+		}},
+	}
+	for _, test := range tests {
+		tun, err := TunnelAdd(test.name, test.kind, &test.opts, Up)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer TunnelDelete(test.name)
+		opts, err := tun.Options()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := test.opts
+		if want.Mode == "" && test.kind == "ip6tnl" {
+			want.Mode = "ip6ip6"
+		}
+		if !opts.Local.Equal(want.Local) || !opts.Remote.Equal(want.Remote) ||
+			opts.Ttl != want.Ttl || opts.Mode != want.Mode ||
+			opts.FlowLabel != want.FlowLabel ||
+			opts.NoEncapLimit != want.NoEncapLimit ||
+			(want.EncapLimit != 0 && opts.EncapLimit != want.EncapLimit) ||
+			opts.SixrdPrefix.String() != want.SixrdPrefix.String() ||
+			opts.SixrdRelay.String() != want.SixrdRelay.String() {
+			t.Errorf("Error: %s: %+v", tun.Name(), opts)
+		}
+	}
+	if _, err := TunnelAdd("ipipTest2", "ipip", &TunnelOptions{
+		Remote: net.ParseIP("2001:db8::2"),
+	}, Up); err == nil {
+		TunnelDelete("ipipTest2")
+		t.Errorf("Error: ipip accepted an IPv6 endpoint")
+	}
+
+	//
+	// Create a tunnel in a VRF
+	//
+	vrf, err := VrfAdd(vrfName, 1010, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer VrfDelete(vrfName)
+	tun, err := TunnelAdd("ipipTest3", "ipip", &TunnelOptions{
+		Local:  net.ParseIP("192.0.2.1"),
+		Remote: net.ParseIP("192.0.2.3"),
+		Vrf:    vrfName,
+	}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer TunnelDelete("ipipTest3")
+	l, err := LinkByName(tun.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Attrs().MasterIndex != vrf.Link.Attrs().Index {
+		t.Errorf("Error: %s is not bound to %s", tun.Name(), vrfName)
+	}
+	t.Logf("confirmed.")
+}
@@ -28,8 +28,14 @@ import (
 // return: nil if success
 //         non-nil otherwise
 func LinkDel(name string) error {
-	if l, err := netlink.LinkByName(name); err == nil {
-		return netlink.LinkDel(l)
+	return pkgHandle.LinkDel(name)
+}
+
+// LinkDel deletes the specified link device (interface) in the
+// network namespace of `h'
+func (h *Handle) LinkDel(name string) error {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		return h.nlh.LinkDel(l)
 	} else {
 		return err
 	}
@@ -42,7 +48,13 @@ func LinkDel(name string) error {
 //         2. nil if success
 //            non-nil otherwise
 func IfIndex(name string) (int, error) {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.IfIndex(name)
+}
+
+// IfIndex returns the ifindex associated with interface `name'
+// in the network namespace of `h'
+func (h *Handle) IfIndex(name string) (int, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		return l.Attrs().Index, nil
 	} else {
 		return -1, err
@@ -56,7 +68,13 @@ func IfIndex(name string) (int, error) {
 //         2. nil if success
 //            non-nil otherwise
 func IfName(ifIndex int) (string, error) {
-	if l, err := netlink.LinkByIndex(ifIndex); err == nil {
+	return pkgHandle.IfName(ifIndex)
+}
+
+// IfName retuns the interface name whose ifindex is `ifIndex'
+// in the network namespace of `h'
+func (h *Handle) IfName(ifIndex int) (string, error) {
+	if l, err := h.nlh.LinkByIndex(ifIndex); err == nil {
 		return l.Attrs().Name, nil
 	} else {
 		return "", err
@@ -68,7 +86,13 @@ func IfName(ifIndex int) (string, error) {
 // return: 1. Link instance for the instance whose if success
 //            Undetermined Link instance otherwise
 func LinkByIndex(ifIndex int) (Link, error) {
-	return netlink.LinkByIndex(ifIndex)
+	return pkgHandle.LinkByIndex(ifIndex)
+}
+
+// LinkByIndex returns Link instance whose ifindex is `ifIndex'
+// in the network namespace of `h'
+func (h *Handle) LinkByIndex(ifIndex int) (Link, error) {
+	return h.nlh.LinkByIndex(ifIndex)
 }
 
 // LinkByIndex returns Link instance whose name is `name'
@@ -76,7 +100,13 @@ func LinkByIndex(ifIndex int) (Link, error) {
 // return: 1. Link instance for the instance whose if success
 //            Undetermined Link instance otherwise
 func LinkByName(name string) (Link, error) {
-	return netlink.LinkByName(name)
+	return pkgHandle.LinkByName(name)
+}
+
+// LinkByName returns Link instance whose name is `name'
+// in the network namespace of `h'
+func (h *Handle) LinkByName(name string) (Link, error) {
+	return h.nlh.LinkByName(name)
 }
 
 // IfUpByName brings up the specified interface
@@ -84,8 +114,14 @@ func LinkByName(name string) (Link, error) {
 // return: nil if success
 //         non-nil otherwise
 func IfUpByName(name string) error {
-	if l, err := netlink.LinkByName(name); err == nil {
-		return netlink.LinkSetUp(l)
+	return pkgHandle.IfUpByName(name)
+}
+
+// IfUpByName brings up the specified interface in the network
+// namespace of `h'
+func (h *Handle) IfUpByName(name string) error {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		return h.nlh.LinkSetUp(l)
 	} else {
 		return err
 	}
@@ -96,8 +132,14 @@ func IfUpByName(name string) error {
 // return: nil if success
 //         non-nil otherwise
 func IfDownByName(name string) error {
-	if l, err := netlink.LinkByName(name); err == nil {
-		return netlink.LinkSetDown(l)
+	return pkgHandle.IfDownByName(name)
+}
+
+// IfDownByName brings down the specified interface in the network
+// namespace of `h'
+func (h *Handle) IfDownByName(name string) error {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		return h.nlh.LinkSetDown(l)
 	} else {
 		return err
 	}
@@ -110,7 +152,13 @@ func IfDownByName(name string) error {
 //         2. nil if success
 //            non-nil otherwise
 func IfIsUpByName(name string) (bool, error) {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.IfIsUpByName(name)
+}
+
+// IfIsUpByName returns true if the specified interface in the
+// network namespace of `h' is up
+func (h *Handle) IfIsUpByName(name string) (bool, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		if l.Attrs().Flags&net.FlagUp != 0 {
 			return true, nil
 		} else {
@@ -128,9 +176,15 @@ func IfIsUpByName(name string) (bool, error) {
 // return: nil if success
 //         non-nil otherwise
 func IfRename(oldName, newName string) error {
+	return pkgHandle.IfRename(oldName, newName)
+}
+
+// IfRename changes the name of the specified interface in the
+// network namespace of `h'
+func (h *Handle) IfRename(oldName, newName string) error {
 	errMsg := fmt.Sprintf("Error: IfRename(%s, %s): ", oldName, newName)
 
-	if l, err := netlink.LinkByName(oldName); err == nil {
+	if l, err := h.nlh.LinkByName(oldName); err == nil {
 		var linkUp bool
 		if l.Attrs().Flags&net.FlagUp == 0 {
 			linkUp = false
@@ -139,7 +193,7 @@ func IfRename(oldName, newName string) error {
 			// link is up. bring it down first.
 			//
 			linkUp = true
-			if err := netlink.LinkSetDown(l); err != nil {
+			if err := h.nlh.LinkSetDown(l); err != nil {
 				return fmt.Errorf("IfRename(%s): LinkSetName(%s): %v",
 					oldName, newName, err)
 			}
@@ -147,12 +201,12 @@ func IfRename(oldName, newName string) error {
 		//
 		// link is down now. Rename the interface
 		//
-		if err := netlink.LinkSetName(l, newName); err == nil {
+		if err := h.nlh.LinkSetName(l, newName); err == nil {
 			if linkUp {
 				//
 				// Bring up the link again
 				//
-				if err := netlink.LinkSetUp(l); err != nil {
+				if err := h.nlh.LinkSetUp(l); err != nil {
 					return fmt.Errorf(errMsg+"LinkSetUp(): %v", err)
 				}
 			}
@@ -162,7 +216,7 @@ func IfRename(oldName, newName string) error {
 				//
 				// Bring up the link again
 				//
-				if err := netlink.LinkSetUp(l); err != nil {
+				if err := h.nlh.LinkSetUp(l); err != nil {
 					return fmt.Errorf(errMsg+"LinkSetUp(): %v", err)
 				}
 			}
@@ -178,8 +232,14 @@ func IfRename(oldName, newName string) error {
 // return: nil if success
 //         non-nil otherwise
 func IfUnbind(ifName string) error {
-	if l, err := netlink.LinkByName(ifName); err == nil {
-		return netlink.LinkSetNoMaster(l)
+	return pkgHandle.IfUnbind(ifName)
+}
+
+// IfUnbind unbinds an interface from the master device in the
+// network namespace of `h'
+func (h *Handle) IfUnbind(ifName string) error {
+	if l, err := h.nlh.LinkByName(ifName); err == nil {
+		return h.nlh.LinkSetNoMaster(l)
 	} else {
 		return err
 	}
@@ -190,15 +250,27 @@ func IfUnbind(ifName string) error {
 // return: nil if success
 //         non-nil otherwise
 func IfDelete(name string) error {
-	return LinkDel(name)
+	return pkgHandle.LinkDel(name)
+}
+
+// IfDelete deletes the interface whose name is `name' in the
+// network namespace of `h'
+func (h *Handle) IfDelete(name string) error {
+	return h.LinkDel(name)
 }
 
 func IfExists(name string) (bool, error) {
-	return ifExists(name, nil)
+	return pkgHandle.ifExists(name, nil)
+}
+
+// IfExists returns true if interface `name' exists in the network
+// namespace of `h'
+func (h *Handle) IfExists(name string) (bool, error) {
+	return h.ifExists(name, nil)
 }
 
-func ifExists(name string, kind netlink.Link) (bool, error) {
-	l, err := LinkByName(name)
+func (h *Handle) ifExists(name string, kind netlink.Link) (bool, error) {
+	l, err := h.LinkByName(name)
 	if err == nil {
 		if kind == nil {
 			return true, nil
@@ -216,38 +288,42 @@ func ifExists(name string, kind netlink.Link) (bool, error) {
 }
 
 // IsTunnelByIndex returns true if theh specified interface is a
-// tunnel interface.
+// tunnel interface (tun, GRE, IPIP, SIT, VXLAN, WireGuard, ...)
 // in: ifindex Ifindex of the interface to test
 // return: 1. true if the interface is a tunnel interface
 //            false otherwise
 //         2. nil if success
 //            non-nil otherwise
 func IsTunnelByIndex(ifindex int) (bool, error) {
-	if link, err := netlink.LinkByIndex(ifindex); err == nil {
-		if link.Type() == "tun" {
-			return true, nil
-		} else {
-			return false, nil
-		}
-	} else {
+	return pkgHandle.IsTunnelByIndex(ifindex)
+}
+
+// IsTunnelByIndex returns true if theh specified interface in the
+// network namespace of `h' is a tunnel interface.
+func (h *Handle) IsTunnelByIndex(ifindex int) (bool, error) {
+	kind, err := h.linkKind(ifindex)
+	if err != nil {
 		return false, err
 	}
+	return tunnelKinds[kind], nil
 }
 
 // IsTunnelByName returns true if theh specified interface is a
-// tunnel interface.
+// tunnel interface (tun, GRE, IPIP, SIT, VXLAN, WireGuard, ...)
 // in: name Name of the interface to test
 // return: 1. true if the interface is a tunnel interface
 //            false otherwise
 //         2. nil if success
 //            non-nil otherwise
 func IsTunnelByName(name string) (bool, error) {
-	if link, err := netlink.LinkByName(name); err == nil {
-		if link.Type() == "tun" {
-			return true, nil
-		} else {
-			return false, nil
-		}
+	return pkgHandle.IsTunnelByName(name)
+}
+
+// IsTunnelByName returns true if theh specified interface in the
+// network namespace of `h' is a tunnel interface.
+func (h *Handle) IsTunnelByName(name string) (bool, error) {
+	if link, err := h.nlh.LinkByName(name); err == nil {
+		return h.IsTunnelByIndex(link.Attrs().Index)
 	} else {
 		return false, err
 	}
@@ -261,12 +337,18 @@ func IsTunnelByName(name string) (bool, error) {
 // return: nil if success
 //         non-nil otherwise
 func IpAddrAdd(name string, addr *net.IPNet, up bool) error {
-	if l, err := netlink.LinkByName(name); err == nil {
-		if err := netlink.AddrAdd(l, &netlink.Addr{IPNet: addr}); err != nil {
+	return pkgHandle.IpAddrAdd(name, addr, up)
+}
+
+// IpAddrAdd adds an IP prefix to an interface in the network
+// namespace of `h'
+func (h *Handle) IpAddrAdd(name string, addr *net.IPNet, up bool) error {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		if err := h.nlh.AddrAdd(l, &netlink.Addr{IPNet: addr}); err != nil {
 			return err
 		}
 		if up {
-			return netlink.LinkSetUp(l)
+			return h.nlh.LinkSetUp(l)
 		}
 		return nil
 	} else {
@@ -280,8 +362,14 @@ func IpAddrAdd(name string, addr *net.IPNet, up bool) error {
 // return: nil if success
 //         non-nil otherwise
 func IpAddrDelete(name string, addr *net.IPNet) error {
-	if l, err := netlink.LinkByName(name); err == nil {
-		return netlink.AddrDel(l, &netlink.Addr{IPNet: addr})
+	return pkgHandle.IpAddrDelete(name, addr)
+}
+
+// IpAddrDelete deletes an IP prefix from an interface in the network
+// namespace of `h'
+func (h *Handle) IpAddrDelete(name string, addr *net.IPNet) error {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		return h.nlh.AddrDel(l, &netlink.Addr{IPNet: addr})
 	} else {
 		return err
 	}
@@ -296,13 +384,19 @@ func IpAddrDelete(name string, addr *net.IPNet) error {
 // return: nil if success
 //         non-nil otherwise
 func IpAddrReplace(name string, addr *net.IPNet, up bool) error {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.IpAddrReplace(name, addr, up)
+}
+
+// IpAddrReplace replaces (or adds unless present) an IP prefix
+// on an interface in the network namespace of `h'
+func (h *Handle) IpAddrReplace(name string, addr *net.IPNet, up bool) error {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		if err :=
-			netlink.AddrReplace(l, &netlink.Addr{IPNet: addr}); err != nil {
+			h.nlh.AddrReplace(l, &netlink.Addr{IPNet: addr}); err != nil {
 			return err
 		}
 		if up {
-			return netlink.LinkSetUp(l)
+			return h.nlh.LinkSetUp(l)
 		}
 		return nil
 	} else {
@@ -318,10 +412,16 @@ func IpAddrReplace(name string, addr *net.IPNet, up bool) error {
 //         2. nil if success
 //            non-nil otherwise
 func IpAddrList(name string, family int) ([]*net.IPNet, error) {
+	return pkgHandle.IpAddrList(name, family)
+}
+
+// IpAddrList returns a list of IP prefixes associated with the interface
+// in the network namespace of `h'
+func (h *Handle) IpAddrList(name string, family int) ([]*net.IPNet, error) {
 	var rc []*net.IPNet
 
-	if l, err := netlink.LinkByName(name); err == nil {
-		if addr, err := netlink.AddrList(l, family); err == nil {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		if addr, err := h.nlh.AddrList(l, family); err == nil {
 			for _, a := range addr {
 				rc = append(rc, a.IPNet)
 			}
@@ -341,7 +441,13 @@ func IpAddrList(name string, family int) ([]*net.IPNet, error) {
 //         2. nil if success
 //            non-nil otherwise
 func IPv4AddrList(name string) ([]*net.IPNet, error) {
-	return IpAddrList(name, nl.FAMILY_V4)
+	return pkgHandle.IpAddrList(name, nl.FAMILY_V4)
+}
+
+// IPv4AddrList returns a list of IPv4 prefixes associated with the
+// interface in the network namespace of `h'
+func (h *Handle) IPv4AddrList(name string) ([]*net.IPNet, error) {
+	return h.IpAddrList(name, nl.FAMILY_V4)
 }
 
 // Ipv6AddrList returns a list of IPv6 prefixes associated with the interface
@@ -351,7 +457,13 @@ func IPv4AddrList(name string) ([]*net.IPNet, error) {
 //         2. nil if success
 //            non-nil otherwise
 func IPv6AddrList(name string) ([]*net.IPNet, error) {
-	return IpAddrList(name, nl.FAMILY_V6)
+	return pkgHandle.IpAddrList(name, nl.FAMILY_V6)
+}
+
+// IPv6AddrList returns a list of IPv6 prefixes associated with the
+// interface in the network namespace of `h'
+func (h *Handle) IPv6AddrList(name string) ([]*net.IPNet, error) {
+	return h.IpAddrList(name, nl.FAMILY_V6)
 }
 
 // IsIfPrefix returns true if `ifPrefix' belongs to interface `ifName'
@@ -362,7 +474,13 @@ func IPv6AddrList(name string) ([]*net.IPNet, error) {
 //         2. nil if success
 //            non-nil otherwise
 func IsIfPrefix(ifName string, ifPrefix *net.IPNet) (bool, error) {
-	if prefixes, err := IpAddrList(ifName, nl.FAMILY_ALL); err == nil {
+	return pkgHandle.IsIfPrefix(ifName, ifPrefix)
+}
+
+// IsIfPrefix returns true if `ifPrefix' belongs to interface `ifName'
+// in the network namespace of `h'
+func (h *Handle) IsIfPrefix(ifName string, ifPrefix *net.IPNet) (bool, error) {
+	if prefixes, err := h.IpAddrList(ifName, nl.FAMILY_ALL); err == nil {
 		for _, pfx := range prefixes {
 			if IPNetEqual(pfx, ifPrefix) == true {
 				return true, nil
@@ -382,16 +500,28 @@ func IsIfPrefix(ifName string, ifPrefix *net.IPNet) (bool, error) {
 //         2. nil if success
 //            non-nil otherwise
 func IsIfPrefixByName(ifName, ifPrefix string) (bool, error) {
+	return pkgHandle.IsIfPrefixByName(ifName, ifPrefix)
+}
+
+// IsIfPrefixByName returns true if `ifPrefix' belongs to interface
+// `ifName' in the network namespace of `h'
+func (h *Handle) IsIfPrefixByName(ifName, ifPrefix string) (bool, error) {
 	if _, addr, err := net.ParseCIDR(ifPrefix); err == nil {
-		return IsIfPrefix(ifName, addr)
+		return h.IsIfPrefix(ifName, addr)
 	} else {
 		return false, err
 	}
 }
 
 func IfList() ([]string, error) {
+	return pkgHandle.IfList()
+}
+
+// IfList returns the names of the interfaces in the network
+// namespace of `h'
+func (h *Handle) IfList() ([]string, error) {
 	var ifs []string
-	ll, err := netlink.LinkList()
+	ll, err := h.nlh.LinkList()
 	if err != nil {
 		return nil, fmt.Errorf("LinkList(): %v", err)
 	}
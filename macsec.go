@@ -0,0 +1,755 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"net"
+	"syscall"
+)
+
+const (
+	MacsecKeyIdLen = 16 // length of a MACsec key ID
+	MacsecSaltLen  = 12 // length of a MACsec salt (XPN)
+)
+
+//
+// linux/if_link.h
+//
+const (
+	iflaMacsecSci           = 1  // IFLA_MACSEC_SCI
+	iflaMacsecPort          = 2  // IFLA_MACSEC_PORT
+	iflaMacsecIcvLen        = 3  // IFLA_MACSEC_ICV_LEN
+	iflaMacsecCipherSuite   = 4  // IFLA_MACSEC_CIPHER_SUITE
+	iflaMacsecWindow        = 5  // IFLA_MACSEC_WINDOW
+	iflaMacsecEncodingSa    = 6  // IFLA_MACSEC_ENCODING_SA
+	iflaMacsecEncrypt       = 7  // IFLA_MACSEC_ENCRYPT
+	iflaMacsecProtect       = 8  // IFLA_MACSEC_PROTECT
+	iflaMacsecIncSci        = 9  // IFLA_MACSEC_INC_SCI
+	iflaMacsecEs            = 10 // IFLA_MACSEC_ES
+	iflaMacsecScb           = 11 // IFLA_MACSEC_SCB
+	iflaMacsecReplayProtect = 12 // IFLA_MACSEC_REPLAY_PROTECT
+	iflaMacsecValidation    = 13 // IFLA_MACSEC_VALIDATION
+)
+
+//
+// linux/if_macsec.h
+//
+const (
+	macsecGenlName    = "macsec"
+	macsecGenlVersion = 1
+
+	macsecCipherIdDefault   = 0x0080020001000001 // MACSEC_DEFAULT_CIPHER_ID
+	macsecCipherIdGcmAes128 = 0x0080C20001000001 // MACSEC_CIPHER_ID_GCM_AES_128
+	macsecCipherIdGcmAes256 = 0x0080C20001000002 // MACSEC_CIPHER_ID_GCM_AES_256
+	macsecCipherIdXpn128    = 0x0080C20001000003 // MACSEC_CIPHER_ID_GCM_AES_XPN_128
+	macsecCipherIdXpn256    = 0x0080C20001000004 // MACSEC_CIPHER_ID_GCM_AES_XPN_256
+
+	macsecCmdGetTxsc = 0 // MACSEC_CMD_GET_TXSC
+	macsecCmdAddRxsc = 1 // MACSEC_CMD_ADD_RXSC
+	macsecCmdDelRxsc = 2 // MACSEC_CMD_DEL_RXSC
+	macsecCmdUpdRxsc = 3 // MACSEC_CMD_UPD_RXSC
+	macsecCmdAddTxsa = 4 // MACSEC_CMD_ADD_TXSA
+	macsecCmdDelTxsa = 5 // MACSEC_CMD_DEL_TXSA
+	macsecCmdUpdTxsa = 6 // MACSEC_CMD_UPD_TXSA
+	macsecCmdAddRxsa = 7 // MACSEC_CMD_ADD_RXSA
+	macsecCmdDelRxsa = 8 // MACSEC_CMD_DEL_RXSA
+	macsecCmdUpdRxsa = 9 // MACSEC_CMD_UPD_RXSA
+
+	macsecAttrIfindex    = 1 // MACSEC_ATTR_IFINDEX
+	macsecAttrRxscConfig = 2 // MACSEC_ATTR_RXSC_CONFIG
+	macsecAttrSaConfig   = 3 // MACSEC_ATTR_SA_CONFIG
+	macsecAttrTxsaList   = 5 // MACSEC_ATTR_TXSA_LIST
+	macsecAttrRxscList   = 6 // MACSEC_ATTR_RXSC_LIST
+
+	macsecRxscAttrSci    = 1 // MACSEC_RXSC_ATTR_SCI
+	macsecRxscAttrActive = 2 // MACSEC_RXSC_ATTR_ACTIVE
+	macsecRxscAttrSaList = 3 // MACSEC_RXSC_ATTR_SA_LIST
+
+	macsecSaAttrAn     = 1 // MACSEC_SA_ATTR_AN
+	macsecSaAttrActive = 2 // MACSEC_SA_ATTR_ACTIVE
+	macsecSaAttrPn     = 3 // MACSEC_SA_ATTR_PN
+	macsecSaAttrKey    = 4 // MACSEC_SA_ATTR_KEY
+	macsecSaAttrKeyid  = 5 // MACSEC_SA_ATTR_KEYID
+	macsecSaAttrSsci   = 8 // MACSEC_SA_ATTR_SSCI
+	macsecSaAttrSalt   = 9 // MACSEC_SA_ATTR_SALT
+)
+
+// macsecCiphers are the cipher suites of MACsec
+var macsecCiphers = map[string]uint64{
+	"gcm-aes-128":     macsecCipherIdGcmAes128,
+	"gcm-aes-256":     macsecCipherIdGcmAes256,
+	"gcm-aes-xpn-128": macsecCipherIdXpn128,
+	"gcm-aes-xpn-256": macsecCipherIdXpn256,
+}
+
+// macsecValidation are the frame validation modes of MACsec
+var macsecValidation = map[string]uint8{
+	"disabled": 0,
+	"check":    1,
+	"strict":   2,
+}
+
+// Macsec is a MACsec interface. The netlink package has no type for
+// MACsec.
+type Macsec struct {
+	Link *netlink.GenericLink
+	h    *Handle
+}
+
+// MacsecOptions holds the attributes of a MACsec interface
+type MacsecOptions struct {
+	Sci           uint64 // secure channel identifier. 0 for MAC + Port
+	Port          uint16 // port of the SCI. 0 for 1. Exclusive with Sci
+	CipherSuite   string // gcm-aes-{128,256}, gcm-aes-xpn-{128,256}. "" for 128
+	IcvLen        uint8  // ICV length. 0 for 16
+	Encrypt       bool   // encrypt (otherwise integrity only)
+	Protect       *bool  // protect frames. nil for true
+	ReplayProtect bool   // replay protection
+	Window        uint32 // replay window (ReplayProtect only)
+	EncodingSa    uint8  // active TX SA (AN)
+	Validate      string // disabled, check, or strict. "" for strict
+	SendSci       bool   // include the SCI in every frame
+	EndStation    bool   // end station bit
+	Scb           bool   // single copy broadcast bit
+}
+
+// MacsecSA is a MACsec secure association
+type MacsecSA struct {
+	An     uint8                // association number: 0-3
+	Active bool                 // enabled
+	Pn     uint64               // next packet number. 0 for 1 on add
+	Key    []byte               // key (write only): 16 or 32 bytes
+	KeyId  [MacsecKeyIdLen]byte // key ID
+	Ssci   uint32               // short SCI (XPN only)
+	Salt   [MacsecSaltLen]byte  // salt (XPN only, write only)
+}
+
+// MacsecRxSC is a MACsec receive secure channel
+type MacsecRxSC struct {
+	Sci    uint64
+	Active bool
+	SAs    []MacsecSA
+}
+
+// MacsecSci returns the SCI made of `mac' and `port'
+// in: mac MAC address of the peer
+//     port Port of the peer
+// return: SCI
+func MacsecSci(mac net.HardwareAddr, port uint16) uint64 {
+	b := make([]byte, 8)
+	copy(b[0:6], mac)
+	binary.BigEndian.PutUint16(b[6:8], port)
+	return binary.BigEndian.Uint64(b)
+}
+
+// sciAttr returns `sci' as the bytes of a sci_t (big endian) attribute
+func sciAttr(sci uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, sci)
+	return b
+}
+
+// addMacsecOptions adds the IFLA_MACSEC_* attributes in `opts' to
+// `data'
+func addMacsecOptions(data *nl.RtAttr, opts *MacsecOptions) error {
+	if opts.Sci != 0 {
+		if opts.Port != 0 {
+			return fmt.Errorf("SCI and port are exclusive")
+		}
+		data.AddRtAttr(iflaMacsecSci, sciAttr(opts.Sci))
+	} else if opts.Port != 0 {
+		data.AddRtAttr(iflaMacsecPort, be16Attr(opts.Port))
+	}
+	if opts.CipherSuite != "" {
+		id, ok := macsecCiphers[opts.CipherSuite]
+		if !ok {
+			return fmt.Errorf("unknown cipher suite: %s", opts.CipherSuite)
+		}
+		data.AddRtAttr(iflaMacsecCipherSuite, nl.Uint64Attr(id))
+	}
+	if opts.IcvLen != 0 {
+		data.AddRtAttr(iflaMacsecIcvLen, nl.Uint8Attr(opts.IcvLen))
+	}
+	protect := true
+	if opts.Protect != nil {
+		protect = *opts.Protect
+	}
+	data.AddRtAttr(iflaMacsecEncrypt, boolAttr(opts.Encrypt))
+	data.AddRtAttr(iflaMacsecProtect, boolAttr(protect))
+	data.AddRtAttr(iflaMacsecReplayProtect, boolAttr(opts.ReplayProtect))
+	if opts.ReplayProtect {
+		data.AddRtAttr(iflaMacsecWindow, nl.Uint32Attr(opts.Window))
+	} else if opts.Window != 0 {
+		return fmt.Errorf("window requires replay protection")
+	}
+	data.AddRtAttr(iflaMacsecEncodingSa, nl.Uint8Attr(opts.EncodingSa))
+	if opts.Validate != "" {
+		v, ok := macsecValidation[opts.Validate]
+		if !ok {
+			return fmt.Errorf("unknown validation: %s", opts.Validate)
+		}
+		data.AddRtAttr(iflaMacsecValidation, nl.Uint8Attr(v))
+	}
+	data.AddRtAttr(iflaMacsecIncSci, boolAttr(opts.SendSci))
+	data.AddRtAttr(iflaMacsecEs, boolAttr(opts.EndStation))
+	data.AddRtAttr(iflaMacsecScb, boolAttr(opts.Scb))
+	return nil
+}
+
+// MacsecAdd adds a MACsec interface whose name is `name' on
+// interface `parent' (`ip link add link <parent> <name> type macsec ...')
+// in: name Name of the MACsec interface
+//     parent Name of the parent interface
+//     opts Pointer to the MACsec attributes. nil for the defaults
+//     up Bring up `name' if true
+// return: 1. Pointer to Macsec if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func MacsecAdd(name, parent string, opts *MacsecOptions,
+	up bool) (*Macsec, error) {
+	return pkgHandle.MacsecAdd(name, parent, opts, up)
+}
+
+// MacsecAdd adds a MACsec interface whose name is `name' to the
+// network namespace of `h'
+func (h *Handle) MacsecAdd(name, parent string, opts *MacsecOptions,
+	up bool) (*Macsec, error) {
+	banner := fmt.Sprintf("MacsecAdd(%s, %s): ", name, parent)
+
+	if opts == nil {
+		opts = &MacsecOptions{}
+	}
+	index, err := h.IfIndex(parent)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	req := newLinkRequest(unix.NLM_F_CREATE|unix.NLM_F_EXCL, 0, name)
+	req.AddData(nl.NewRtAttr(unix.IFLA_LINK, nl.Uint32Attr(uint32(index))))
+	linkInfo, data := newLinkInfo("macsec")
+	if err := addMacsecOptions(data, opts); err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return nil, fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	m, err := h.MacsecGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if up {
+		return m, m.IfUp()
+	}
+	return m, nil
+}
+
+// MacsecDelete deletes a MACsec interface whose name is `name'
+// in: name Name of the MACsec interface
+// return: nil if success
+//         non-nil otherwise
+func MacsecDelete(name string) error {
+	return pkgHandle.MacsecDelete(name)
+}
+
+// MacsecDelete deletes a MACsec interface whose name is `name' from
+// the network namespace of `h'
+func (h *Handle) MacsecDelete(name string) error {
+	m, err := h.MacsecGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(m.Link); err != nil {
+		return fmt.Errorf("MacsecDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// MacsecGetByName returns a pointer to Macsec if MACsec interface
+// whose name is `name' exists
+// in: name Name of the MACsec interface
+// return: 1. Pointer to Macsec if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func MacsecGetByName(name string) (*Macsec, error) {
+	return pkgHandle.MacsecGetByName(name)
+}
+
+// MacsecGetByName returns a pointer to Macsec if MACsec interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) MacsecGetByName(name string) (*Macsec, error) {
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("MacsecGetByName(%s): %v", name, err)
+	}
+	if l, ok := l.(*netlink.GenericLink); ok && l.Type() == "macsec" {
+		return &Macsec{Link: l, h: h}, nil
+	}
+	return nil, fmt.Errorf("MacsecGetByName(%s): not MACsec", name)
+}
+
+// MacsecList returns a slice of Macsec
+// return: 1. Slice of Macsec if success
+//         2. nil if success
+//            non-nil otherwise
+func MacsecList() ([]Macsec, error) {
+	return pkgHandle.MacsecList()
+}
+
+// MacsecList returns a slice of Macsec in the network namespace of `h'
+func (h *Handle) MacsecList() ([]Macsec, error) {
+	var ms []Macsec
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("MacsecList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.GenericLink); ok && l.Type() == "macsec" {
+			ms = append(ms, Macsec{Link: l, h: h})
+		}
+	}
+	return ms, nil
+}
+
+// Name returns the name of this MACsec interface
+func (m *Macsec) Name() string {
+	return m.Link.Attrs().Name
+}
+
+// Index returns the ifindex of this MACsec interface
+func (m *Macsec) Index() int {
+	return m.Link.Attrs().Index
+}
+
+// IfUp brings up this MACsec interface
+func (m *Macsec) IfUp() error {
+	return handleOf(m.h).nlh.LinkSetUp(m.Link)
+}
+
+// IfDown brings down this MACsec interface
+func (m *Macsec) IfDown() error {
+	return handleOf(m.h).nlh.LinkSetDown(m.Link)
+}
+
+// Options returns the current attributes of this MACsec interface.
+// Sci is set; Port is not.
+// return: 1. Pointer to MacsecOptions if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (m *Macsec) Options() (*MacsecOptions, error) {
+	data, err := handleOf(m.h).linkInfoData(m.Index(), false)
+	if err != nil {
+		return nil, fmt.Errorf("Options(%s): %v", m.Name(), err)
+	}
+	native := nl.NativeEndian()
+	opts := &MacsecOptions{}
+	protect := false
+	opts.Protect = &protect
+	for _, a := range data {
+		switch a.Attr.Type & nl.NLA_TYPE_MASK {
+		case iflaMacsecSci:
+			opts.Sci = binary.BigEndian.Uint64(a.Value[0:8])
+		case iflaMacsecCipherSuite:
+			id := native.Uint64(a.Value[0:8])
+			if id == macsecCipherIdDefault {
+				id = macsecCipherIdGcmAes128
+			}
+			for name, v := range macsecCiphers {
+				if v == id {
+					opts.CipherSuite = name
+				}
+			}
+		case iflaMacsecIcvLen:
+			opts.IcvLen = a.Value[0]
+		case iflaMacsecEncrypt:
+			opts.Encrypt = a.Value[0] != 0
+		case iflaMacsecProtect:
+			protect = a.Value[0] != 0
+		case iflaMacsecReplayProtect:
+			opts.ReplayProtect = a.Value[0] != 0
+		case iflaMacsecWindow:
+			opts.Window = native.Uint32(a.Value[0:4])
+		case iflaMacsecEncodingSa:
+			opts.EncodingSa = a.Value[0]
+		case iflaMacsecValidation:
+			for name, v := range macsecValidation {
+				if v == a.Value[0] {
+					opts.Validate = name
+				}
+			}
+		case iflaMacsecIncSci:
+			opts.SendSci = a.Value[0] != 0
+		case iflaMacsecEs:
+			opts.EndStation = a.Value[0] != 0
+		case iflaMacsecScb:
+			opts.Scb = a.Value[0] != 0
+		}
+	}
+	return opts, nil
+}
+
+// xpn returns true if the cipher suite of this MACsec interface is
+// extended packet numbering
+func (m *Macsec) xpn() (bool, error) {
+	opts, err := m.Options()
+	if err != nil {
+		return false, err
+	}
+	return opts.CipherSuite == "gcm-aes-xpn-128" ||
+		opts.CipherSuite == "gcm-aes-xpn-256", nil
+}
+
+// genl sends MACsec command `cmd' with attributes `attrs' for this
+// MACsec interface
+func (m *Macsec) genl(cmd uint8, attrs ...*nl.RtAttr) error {
+	h := handleOf(m.h)
+	req, err := h.newGenlRequest(macsecGenlName, cmd, macsecGenlVersion, 0)
+	if err != nil {
+		return err
+	}
+	req.AddData(nl.NewRtAttr(macsecAttrIfindex,
+		nl.Uint32Attr(uint32(m.Index()))))
+	for _, a := range attrs {
+		req.AddData(a)
+	}
+	_, err = h.execute(req, unix.NETLINK_GENERIC, 0)
+	return err
+}
+
+// rxscAttr returns MACSEC_ATTR_RXSC_CONFIG of `sci'
+func rxscAttr(sci uint64) *nl.RtAttr {
+	a := nestedAttr(macsecAttrRxscConfig)
+	a.AddRtAttr(macsecRxscAttrSci, sciAttr(sci))
+	return a
+}
+
+// saAttr returns MACSEC_ATTR_SA_CONFIG of `sa'
+// in: sa Pointer to the SA
+//     xpn true if extended packet numbering
+//     add true to add `sa' (with the key)
+//         false to update or delete `sa'
+//     del true to delete `sa' (AN only)
+func saAttr(sa *MacsecSA, xpn, add, del bool) (*nl.RtAttr, error) {
+	if sa.An > 3 {
+		return nil, fmt.Errorf("invalid AN: %d", sa.An)
+	}
+	a := nestedAttr(macsecAttrSaConfig)
+	a.AddRtAttr(macsecSaAttrAn, nl.Uint8Attr(sa.An))
+	if del {
+		return a, nil
+	}
+	a.AddRtAttr(macsecSaAttrActive, boolAttr(sa.Active))
+	pn := sa.Pn
+	if pn == 0 && add {
+		pn = 1
+	}
+	if pn != 0 {
+		if xpn {
+			a.AddRtAttr(macsecSaAttrPn, nl.Uint64Attr(pn))
+		} else if pn > 0xffffffff {
+			return nil, fmt.Errorf("PN %d: too large without XPN", pn)
+		} else {
+			a.AddRtAttr(macsecSaAttrPn, nl.Uint32Attr(uint32(pn)))
+		}
+	}
+	if !add {
+		return a, nil
+	}
+	if len(sa.Key) == 0 {
+		return nil, fmt.Errorf("AN %d: no key", sa.An)
+	}
+	a.AddRtAttr(macsecSaAttrKey, sa.Key)
+	a.AddRtAttr(macsecSaAttrKeyid, sa.KeyId[:])
+	if xpn {
+		a.AddRtAttr(macsecSaAttrSsci, nl.Uint32Attr(sa.Ssci))
+		a.AddRtAttr(macsecSaAttrSalt, sa.Salt[:])
+	}
+	return a, nil
+}
+
+// saModify sends `cmd' for SA `sa' of the TX SC (sci == nil) or the
+// RX SC `*sci'
+func (m *Macsec) saModify(cmd uint8, sci *uint64, sa *MacsecSA,
+	add, del bool) error {
+	xpn, err := m.xpn()
+	if err != nil {
+		return err
+	}
+	a, err := saAttr(sa, xpn, add, del)
+	if err != nil {
+		return err
+	}
+	if sci == nil {
+		return m.genl(cmd, a)
+	}
+	return m.genl(cmd, rxscAttr(*sci), a)
+}
+
+// TxSAAdd adds TX SA `sa' to this MACsec interface
+// (`ip macsec add <name> tx sa <an> pn <pn> on key <keyid> <key>')
+// in: sa Pointer to the SA. sa.Key is required
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) TxSAAdd(sa *MacsecSA) error {
+	if err := m.saModify(macsecCmdAddTxsa, nil, sa, true, false); err != nil {
+		return fmt.Errorf("TxSAAdd(%s, %d): %v", m.Name(), sa.An, err)
+	}
+	return nil
+}
+
+// TxSAUpdate updates the state (and the PN if non-zero) of TX SA
+// `sa.An' (`ip macsec set <name> tx sa <an> pn <pn> on|off')
+// in: sa Pointer to the SA. The keys are ignored
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) TxSAUpdate(sa *MacsecSA) error {
+	if err := m.saModify(macsecCmdUpdTxsa, nil, sa, false, false); err != nil {
+		return fmt.Errorf("TxSAUpdate(%s, %d): %v", m.Name(), sa.An, err)
+	}
+	return nil
+}
+
+// TxSADelete deletes TX SA `an' (`ip macsec del <name> tx sa <an>')
+// in: an Association number
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) TxSADelete(an uint8) error {
+	err := m.saModify(macsecCmdDelTxsa, nil, &MacsecSA{An: an}, false, true)
+	if err != nil {
+		return fmt.Errorf("TxSADelete(%s, %d): %v", m.Name(), an, err)
+	}
+	return nil
+}
+
+// RxSCAdd adds RX SC `sci' to this MACsec interface
+// (`ip macsec add <name> rx sci <sci> on|off')
+// in: sci SCI of the peer (see MacsecSci())
+//     active Enable the RX SC if true
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) RxSCAdd(sci uint64, active bool) error {
+	a := rxscAttr(sci)
+	a.AddRtAttr(macsecRxscAttrActive, boolAttr(active))
+	if err := m.genl(macsecCmdAddRxsc, a); err != nil {
+		return fmt.Errorf("RxSCAdd(%s, %016x): %v", m.Name(), sci, err)
+	}
+	return nil
+}
+
+// RxSCUpdate enables or disables RX SC `sci'
+// (`ip macsec set <name> rx sci <sci> on|off')
+// in: sci SCI of the peer
+//     active Enable the RX SC if true
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) RxSCUpdate(sci uint64, active bool) error {
+	a := rxscAttr(sci)
+	a.AddRtAttr(macsecRxscAttrActive, boolAttr(active))
+	if err := m.genl(macsecCmdUpdRxsc, a); err != nil {
+		return fmt.Errorf("RxSCUpdate(%s, %016x): %v", m.Name(), sci, err)
+	}
+	return nil
+}
+
+// RxSCDelete deletes RX SC `sci' and its SAs
+// (`ip macsec del <name> rx sci <sci>')
+// in: sci SCI of the peer
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) RxSCDelete(sci uint64) error {
+	if err := m.genl(macsecCmdDelRxsc, rxscAttr(sci)); err != nil {
+		return fmt.Errorf("RxSCDelete(%s, %016x): %v", m.Name(), sci, err)
+	}
+	return nil
+}
+
+// RxSAAdd adds SA `sa' to RX SC `sci'
+// (`ip macsec add <name> rx sci <sci> sa <an> pn <pn> on key <keyid> <key>')
+// in: sci SCI of the peer
+//     sa Pointer to the SA. sa.Key is required
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) RxSAAdd(sci uint64, sa *MacsecSA) error {
+	if err := m.saModify(macsecCmdAddRxsa, &sci, sa, true, false); err != nil {
+		return fmt.Errorf("RxSAAdd(%s, %016x, %d): %v", m.Name(), sci, sa.An,
+			err)
+	}
+	return nil
+}
+
+// RxSAUpdate updates the state (and the PN if non-zero) of SA
+// `sa.An' of RX SC `sci'
+// in: sci SCI of the peer
+//     sa Pointer to the SA. The keys are ignored
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) RxSAUpdate(sci uint64, sa *MacsecSA) error {
+	if err := m.saModify(macsecCmdUpdRxsa, &sci, sa, false, false); err != nil {
+		return fmt.Errorf("RxSAUpdate(%s, %016x, %d): %v", m.Name(), sci,
+			sa.An, err)
+	}
+	return nil
+}
+
+// RxSADelete deletes SA `an' of RX SC `sci'
+// in: sci SCI of the peer
+//     an Association number
+// return: nil if success
+//         non-nil otherwise
+func (m *Macsec) RxSADelete(sci uint64, an uint8) error {
+	err := m.saModify(macsecCmdDelRxsa, &sci, &MacsecSA{An: an}, false, true)
+	if err != nil {
+		return fmt.Errorf("RxSADelete(%s, %016x, %d): %v", m.Name(), sci, an,
+			err)
+	}
+	return nil
+}
+
+// dump returns the MACSEC_ATTR_* attributes of this MACsec interface
+func (m *Macsec) dump() ([]syscall.NetlinkRouteAttr, error) {
+	h := handleOf(m.h)
+	req, err := h.newGenlRequest(macsecGenlName, macsecCmdGetTxsc,
+		macsecGenlVersion, unix.NLM_F_DUMP)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := h.execute(req, unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("MACSEC_CMD_GET_TXSC: %v", err)
+	}
+	for _, msg := range msgs {
+		attrs, err := genlAttrs(msg)
+		if err != nil {
+			return nil, err
+		}
+		a := attrByType(attrs, macsecAttrIfindex)
+		if a != nil && int(nl.NativeEndian().Uint32(a.Value[0:4])) == m.Index() {
+			return attrs, nil
+		}
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+// parseMacsecSAs returns the SAs in SA list `b'. The keys and the
+// salts are not returned by the kernel.
+func parseMacsecSAs(b []byte) ([]MacsecSA, error) {
+	var sas []MacsecSA
+
+	list, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range list {
+		attrs, err := nl.ParseRouteAttr(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		sa := MacsecSA{}
+		for _, a := range attrs {
+			switch a.Attr.Type & nl.NLA_TYPE_MASK {
+			case macsecSaAttrAn:
+				sa.An = a.Value[0]
+			case macsecSaAttrActive:
+				sa.Active = a.Value[0] != 0
+			case macsecSaAttrPn:
+				if len(a.Value) >= 8 {
+					sa.Pn = nl.NativeEndian().Uint64(a.Value[0:8])
+				} else {
+					sa.Pn = uint64(nl.NativeEndian().Uint32(a.Value[0:4]))
+				}
+			case macsecSaAttrKeyid:
+				copy(sa.KeyId[:], a.Value)
+			case macsecSaAttrSsci:
+				sa.Ssci = nl.NativeEndian().Uint32(a.Value[0:4])
+			}
+		}
+		sas = append(sas, sa)
+	}
+	return sas, nil
+}
+
+// TxSAList returns the TX SAs of this MACsec interface
+// return: 1. Slice of MacsecSA if success
+//         2. nil if success
+//            non-nil otherwise
+func (m *Macsec) TxSAList() ([]MacsecSA, error) {
+	banner := fmt.Sprintf("TxSAList(%s): ", m.Name())
+	attrs, err := m.dump()
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	a := attrByType(attrs, macsecAttrTxsaList)
+	if a == nil {
+		return nil, nil
+	}
+	sas, err := parseMacsecSAs(a.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	return sas, nil
+}
+
+// RxSCList returns the RX SCs and their SAs of this MACsec interface
+// return: 1. Slice of MacsecRxSC if success
+//         2. nil if success
+//            non-nil otherwise
+func (m *Macsec) RxSCList() ([]MacsecRxSC, error) {
+	banner := fmt.Sprintf("RxSCList(%s): ", m.Name())
+	var scs []MacsecRxSC
+
+	attrs, err := m.dump()
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	a := attrByType(attrs, macsecAttrRxscList)
+	if a == nil {
+		return nil, nil
+	}
+	list, err := nl.ParseRouteAttr(a.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	for _, e := range list {
+		attrs, err := nl.ParseRouteAttr(e.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s%v", banner, err)
+		}
+		sc := MacsecRxSC{}
+		for _, a := range attrs {
+			switch a.Attr.Type & nl.NLA_TYPE_MASK {
+			case macsecRxscAttrSci:
+				sc.Sci = binary.BigEndian.Uint64(a.Value[0:8])
+			case macsecRxscAttrActive:
+				sc.Active = a.Value[0] != 0
+			case macsecRxscAttrSaList:
+				if sc.SAs, err = parseMacsecSAs(a.Value); err != nil {
+					return nil, fmt.Errorf("%s%v", banner, err)
+				}
+			}
+		}
+		scs = append(scs, sc)
+	}
+	return scs, nil
+}
@@ -0,0 +1,446 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"net"
+)
+
+// Macvlan is a MACVLAN or MACVTAP interface
+type Macvlan struct {
+	Link netlink.Link // *netlink.Macvlan or *netlink.Macvtap
+	h    *Handle
+}
+
+var macvlanModes = map[string]netlink.MacvlanMode{
+	"private":  netlink.MACVLAN_MODE_PRIVATE,
+	"vepa":     netlink.MACVLAN_MODE_VEPA,
+	"bridge":   netlink.MACVLAN_MODE_BRIDGE,
+	"passthru": netlink.MACVLAN_MODE_PASSTHRU,
+	"source":   netlink.MACVLAN_MODE_SOURCE,
+}
+
+// newMacvlan returns netlink.Macvlan (or netlink.Macvtap if `tap' is
+// true) on parent interface `parent' in the network namespace of `h'
+func (h *Handle) newMacvlan(name, parent, mode string,
+	tap bool) (netlink.Link, error) {
+	m := netlink.MACVLAN_MODE_DEFAULT
+	if mode != "" {
+		var ok bool
+		if m, ok = macvlanModes[mode]; !ok {
+			return nil, fmt.Errorf("unknown mode: %s", mode)
+		}
+	}
+	l, err := h.nlh.LinkByName(parent)
+	if err != nil {
+		return nil, fmt.Errorf("LinkByName(%s): %v", parent, err)
+	}
+	macvlan := netlink.Macvlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        name,
+			ParentIndex: l.Attrs().Index,
+		},
+		Mode: m,
+	}
+	if tap {
+		return &netlink.Macvtap{Macvlan: macvlan}, nil
+	}
+	return &macvlan, nil
+}
+
+func (h *Handle) macvlanAdd(name, parent, mode string, tap,
+	up bool) (*Macvlan, error) {
+	banner := fmt.Sprintf("MacvlanAdd(%s, %s): ", name, parent)
+	if tap {
+		banner = fmt.Sprintf("MacvtapAdd(%s, %s): ", name, parent)
+	}
+	l, err := h.newMacvlan(name, parent, mode, tap)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if err := h.nlh.LinkAdd(l); err != nil {
+		return nil, fmt.Errorf("%sLinkAdd(): %v", banner, err)
+	}
+	macvlan, err := h.macvlanGetByName(name, tap)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if up {
+		return macvlan, h.nlh.LinkSetUp(macvlan.Link)
+	}
+	return macvlan, nil
+}
+
+// macvlanAddNS adds a MACVLAN (or MACVTAP) interface on `parent'
+// in the network namespace of `h' directly into network
+// namespace `nsName'
+func (h *Handle) macvlanAddNS(name, parent, mode, nsName string, tap,
+	up bool) error {
+	banner := fmt.Sprintf("MacvlanAddNS(%s, %s, %s): ", name, parent, nsName)
+	if tap {
+		banner = fmt.Sprintf("MacvtapAddNS(%s, %s, %s): ", name, parent, nsName)
+	}
+	nh, err := NewHandleByName(nsName)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	defer nh.Close()
+
+	l, err := h.newMacvlan(name, parent, mode, tap)
+	if err != nil {
+		return fmt.Errorf("%s%v", banner, err)
+	}
+	l.Attrs().Namespace = netlink.NsFd(nh.Fd())
+	if err := h.nlh.LinkAdd(l); err != nil {
+		return fmt.Errorf("%sLinkAdd(): %v", banner, err)
+	}
+	if up {
+		if err := nh.IfUpByName(name); err != nil {
+			return fmt.Errorf("%s%v", banner, err)
+		}
+	}
+	return nil
+}
+
+func (h *Handle) macvlanGetByName(name string, tap bool) (*Macvlan, error) {
+	banner := fmt.Sprintf("MacvlanGetByName(%s): ", name)
+	if tap {
+		banner = fmt.Sprintf("MacvtapGetByName(%s): ", name)
+	}
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	switch l.(type) {
+	case *netlink.Macvlan:
+		if !tap {
+			return &Macvlan{Link: l, h: h}, nil
+		}
+	case *netlink.Macvtap:
+		if tap {
+			return &Macvlan{Link: l, h: h}, nil
+		}
+	}
+	if tap {
+		return nil, fmt.Errorf("%snot a MACVTAP", banner)
+	}
+	return nil, fmt.Errorf("%snot a MACVLAN", banner)
+}
+
+func (h *Handle) macvlanList(tap bool) ([]Macvlan, error) {
+	var macvlans []Macvlan
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		switch l.(type) {
+		case *netlink.Macvlan:
+			if !tap {
+				macvlans = append(macvlans, Macvlan{Link: l, h: h})
+			}
+		case *netlink.Macvtap:
+			if tap {
+				macvlans = append(macvlans, Macvlan{Link: l, h: h})
+			}
+		}
+	}
+	return macvlans, nil
+}
+
+// MacvlanAdd adds a MACVLAN interface on parent interface `parent'
+// in: name Name of the MACVLAN interface
+//     parent Name of the parent interface
+//     mode private, vepa, bridge, passthru, or source.
+//          "" for the default (vepa)
+//     up Bring up `name' if true
+// return: 1. Pointer to Macvlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func MacvlanAdd(name, parent, mode string, up bool) (*Macvlan, error) {
+	return pkgHandle.MacvlanAdd(name, parent, mode, up)
+}
+
+// MacvlanAdd adds a MACVLAN interface on parent interface `parent'
+// in the network namespace of `h'
+func (h *Handle) MacvlanAdd(name, parent, mode string,
+	up bool) (*Macvlan, error) {
+	return h.macvlanAdd(name, parent, mode, false, up)
+}
+
+// MacvlanAddNS adds a MACVLAN interface on parent interface `parent'
+// directly into network namespace `nsName'. Unlike adding it and
+// calling IfSetNS(), the interface never appears in the namespace
+// of `parent'.
+// in: name Name of the MACVLAN interface
+//     parent Name of the parent interface
+//     mode private, vepa, bridge, passthru, or source
+//     nsName Name of the network namespace to put `name' in
+//     up Bring up `name' if true
+// return: nil if success
+//         non-nil otherwise
+func MacvlanAddNS(name, parent, mode, nsName string, up bool) error {
+	return pkgHandle.MacvlanAddNS(name, parent, mode, nsName, up)
+}
+
+// MacvlanAddNS adds a MACVLAN interface on parent interface `parent'
+// in the network namespace of `h' directly into network
+// namespace `nsName'
+func (h *Handle) MacvlanAddNS(name, parent, mode, nsName string,
+	up bool) error {
+	return h.macvlanAddNS(name, parent, mode, nsName, false, up)
+}
+
+// MacvlanDelete deletes the specified MACVLAN interface
+// in: name Name of the MACVLAN interface to be deleted
+// return: nil if success
+//         non-nil otherwise
+func MacvlanDelete(name string) error {
+	return pkgHandle.MacvlanDelete(name)
+}
+
+// MacvlanDelete deletes the specified MACVLAN interface from the
+// network namespace of `h'
+func (h *Handle) MacvlanDelete(name string) error {
+	if _, err := h.macvlanGetByName(name, false); err != nil {
+		return err
+	}
+	return h.LinkDel(name)
+}
+
+// MacvlanGetByName returns a pointer to Macvlan if MACVLAN interface
+// whose name is `name' exists
+// in: name Name of the MACVLAN interface
+// return: 1. Pointer to Macvlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func MacvlanGetByName(name string) (*Macvlan, error) {
+	return pkgHandle.MacvlanGetByName(name)
+}
+
+// MacvlanGetByName returns a pointer to Macvlan if MACVLAN interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) MacvlanGetByName(name string) (*Macvlan, error) {
+	return h.macvlanGetByName(name, false)
+}
+
+// MacvlanList returns a slice of the MACVLAN interfaces
+// return: 1. Slice of Macvlan if success
+//         2. nil if success
+//            non-nil otherwise
+func MacvlanList() ([]Macvlan, error) {
+	return pkgHandle.MacvlanList()
+}
+
+// MacvlanList returns a slice of the MACVLAN interfaces in the
+// network namespace of `h'
+func (h *Handle) MacvlanList() ([]Macvlan, error) {
+	macvlans, err := h.macvlanList(false)
+	if err != nil {
+		return nil, fmt.Errorf("MacvlanList(): %v", err)
+	}
+	return macvlans, nil
+}
+
+// MacvtapAdd adds a MACVTAP interface on parent interface `parent'
+// in: name Name of the MACVTAP interface
+//     parent Name of the parent interface
+//     mode private, vepa, bridge, passthru, or source.
+//          "" for the default (vepa)
+//     up Bring up `name' if true
+// return: 1. Pointer to Macvlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func MacvtapAdd(name, parent, mode string, up bool) (*Macvlan, error) {
+	return pkgHandle.MacvtapAdd(name, parent, mode, up)
+}
+
+// MacvtapAdd adds a MACVTAP interface on parent interface `parent'
+// in the network namespace of `h'
+func (h *Handle) MacvtapAdd(name, parent, mode string,
+	up bool) (*Macvlan, error) {
+	return h.macvlanAdd(name, parent, mode, true, up)
+}
+
+// MacvtapAddNS adds a MACVTAP interface on parent interface `parent'
+// directly into network namespace `nsName'
+// in: name Name of the MACVTAP interface
+//     parent Name of the parent interface
+//     mode private, vepa, bridge, passthru, or source
+//     nsName Name of the network namespace to put `name' in
+//     up Bring up `name' if true
+// return: nil if success
+//         non-nil otherwise
+func MacvtapAddNS(name, parent, mode, nsName string, up bool) error {
+	return pkgHandle.MacvtapAddNS(name, parent, mode, nsName, up)
+}
+
+// MacvtapAddNS adds a MACVTAP interface on parent interface `parent'
+// in the network namespace of `h' directly into network
+// namespace `nsName'
+func (h *Handle) MacvtapAddNS(name, parent, mode, nsName string,
+	up bool) error {
+	return h.macvlanAddNS(name, parent, mode, nsName, true, up)
+}
+
+// MacvtapDelete deletes the specified MACVTAP interface
+// in: name Name of the MACVTAP interface to be deleted
+// return: nil if success
+//         non-nil otherwise
+func MacvtapDelete(name string) error {
+	return pkgHandle.MacvtapDelete(name)
+}
+
+// MacvtapDelete deletes the specified MACVTAP interface from the
+// network namespace of `h'
+func (h *Handle) MacvtapDelete(name string) error {
+	if _, err := h.macvlanGetByName(name, true); err != nil {
+		return err
+	}
+	return h.LinkDel(name)
+}
+
+// MacvtapGetByName returns a pointer to Macvlan if MACVTAP interface
+// whose name is `name' exists
+// in: name Name of the MACVTAP interface
+// return: 1. Pointer to Macvlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func MacvtapGetByName(name string) (*Macvlan, error) {
+	return pkgHandle.MacvtapGetByName(name)
+}
+
+// MacvtapGetByName returns a pointer to Macvlan if MACVTAP interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) MacvtapGetByName(name string) (*Macvlan, error) {
+	return h.macvlanGetByName(name, true)
+}
+
+// MacvtapList returns a slice of the MACVTAP interfaces
+// return: 1. Slice of Macvlan if success
+//         2. nil if success
+//            non-nil otherwise
+func MacvtapList() ([]Macvlan, error) {
+	return pkgHandle.MacvtapList()
+}
+
+// MacvtapList returns a slice of the MACVTAP interfaces in the
+// network namespace of `h'
+func (h *Handle) MacvtapList() ([]Macvlan, error) {
+	macvlans, err := h.macvlanList(true)
+	if err != nil {
+		return nil, fmt.Errorf("MacvtapList(): %v", err)
+	}
+	return macvlans, nil
+}
+
+// macvlan returns netlink.Macvlan of this interface
+func (m *Macvlan) macvlan() *netlink.Macvlan {
+	if l, ok := m.Link.(*netlink.Macvtap); ok {
+		return &l.Macvlan
+	}
+	return m.Link.(*netlink.Macvlan)
+}
+
+// Name returns the name of this interface
+func (m *Macvlan) Name() string {
+	return m.Link.Attrs().Name
+}
+
+// IsTap returns true if this interface is MACVTAP
+func (m *Macvlan) IsTap() bool {
+	_, ok := m.Link.(*netlink.Macvtap)
+	return ok
+}
+
+// Mode returns the mode of this interface: private, vepa, bridge,
+// passthru, or source
+func (m *Macvlan) Mode() string {
+	mode := m.macvlan().Mode
+	for s, v := range macvlanModes {
+		if v == mode {
+			return s
+		}
+	}
+	return "vepa"
+}
+
+// SourceMacs returns the allowed source MAC addresses (source mode)
+// return: 1. Slice of the MAC addresses if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (m *Macvlan) SourceMacs() ([]net.HardwareAddr, error) {
+	l, err := handleOf(m.h).nlh.LinkByIndex(m.Link.Attrs().Index)
+	if err != nil {
+		return nil, fmt.Errorf("SourceMacs(%s): %v", m.Name(), err)
+	}
+	m.Link = l
+	return m.macvlan().MACAddrs, nil
+}
+
+// AddSourceMac allows source MAC address `mac' (source mode)
+// in: mac MAC address
+// return: nil if success
+//         non-nil otherwise
+func (m *Macvlan) AddSourceMac(mac net.HardwareAddr) error {
+	if err := handleOf(m.h).nlh.MacvlanMACAddrAdd(m.Link, mac); err != nil {
+		return fmt.Errorf("AddSourceMac(%s, %s): %v", m.Name(), mac, err)
+	}
+	return nil
+}
+
+// DeleteSourceMac disallows source MAC address `mac' (source mode)
+// in: mac MAC address
+// return: nil if success
+//         non-nil otherwise
+func (m *Macvlan) DeleteSourceMac(mac net.HardwareAddr) error {
+	if err := handleOf(m.h).nlh.MacvlanMACAddrDel(m.Link, mac); err != nil {
+		return fmt.Errorf("DeleteSourceMac(%s, %s): %v", m.Name(), mac, err)
+	}
+	return nil
+}
+
+// SetSourceMacs replaces the allowed source MAC addresses with
+// `macs' (source mode)
+// in: macs MAC addresses
+// return: nil if success
+//         non-nil otherwise
+func (m *Macvlan) SetSourceMacs(macs []net.HardwareAddr) error {
+	if err := handleOf(m.h).nlh.MacvlanMACAddrSet(m.Link, macs); err != nil {
+		return fmt.Errorf("SetSourceMacs(%s): %v", m.Name(), err)
+	}
+	return nil
+}
+
+// FlushSourceMacs deletes all the allowed source MAC addresses
+// (source mode)
+// return: nil if success
+//         non-nil otherwise
+func (m *Macvlan) FlushSourceMacs() error {
+	if err := handleOf(m.h).nlh.MacvlanMACAddrFlush(m.Link); err != nil {
+		return fmt.Errorf("FlushSourceMacs(%s): %v", m.Name(), err)
+	}
+	return nil
+}
@@ -20,6 +20,16 @@ import (
 	"fmt"
 	netns "github.com/hariguchi/go_netns"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	NetnsRunDir     = "/var/run/netns"
+	NSIDNotAssigned = -1
 )
 
 // IfSetNS bind an interface to a network namespace
@@ -28,20 +38,26 @@ import (
 // return: nil if success
 //         non-nil otherwise
 func IfSetNS(ifName, nsName string) error {
+	return pkgHandle.IfSetNS(ifName, nsName)
+}
+
+// IfSetNS moves an interface in the network namespace of `h'
+// to network namespace `nsName'
+func (h *Handle) IfSetNS(ifName, nsName string) error {
 	var (
 		err error
 		l   netlink.Link
-		h   netns.NsHandle
+		ns  netns.NsHandle
 	)
-	l, err = netlink.LinkByName(ifName)
+	l, err = h.nlh.LinkByName(ifName)
 	if err != nil {
 		return fmt.Errorf("IfSetNS(): LinkByName(%s): %v", ifName, err)
 	}
-	h, err = netns.GetHandleByName(nsName)
+	ns, err = netns.GetHandleByName(nsName)
 	if err != nil {
 		return fmt.Errorf("IfSetNs(): GetHandleByName(%s): %v", nsName, err)
 	}
-	return netlink.LinkSetNsFd(l, int(h))
+	return h.nlh.LinkSetNsFd(l, int(ns))
 }
 
 // IfSetNSbyPid bind an interface to a network namespace
@@ -50,56 +66,351 @@ func IfSetNS(ifName, nsName string) error {
 // return: nil if success
 //         non-nil otherwise
 func IfSetNSbyPid(ifName string, pid int) error {
-	l, err := netlink.LinkByName(ifName)
+	return pkgHandle.IfSetNSbyPid(ifName, pid)
+}
+
+// IfSetNSbyPid moves an interface in the network namespace of `h'
+// to the network namespace of process `pid'
+func (h *Handle) IfSetNSbyPid(ifName string, pid int) error {
+	l, err := h.nlh.LinkByName(ifName)
 	if err != nil {
 		return fmt.Errorf("IfSetNSbyPid(): LinkByName(%s): %v", ifName, err)
 	}
-	return netlink.LinkSetNsPid(l, pid)
+	return h.nlh.LinkSetNsPid(l, pid)
 }
 
-// IfUnsetNS unbind an interface from a network namespace
+// IfUnsetNS unbind an interface from a network namespace.
+// The interface is moved back to the network namespace of process 1.
 // in: ifName Name of the interface to be unbound
 //     nsName Name of the network namespace to unbind `ifName'
 // return: nil if success
 //         non-nil otherwise
 func IfUnsetNS(ifName, nsName string) error {
-	var (
-		errMsg string
-		ns     netns.NsDesc
-	)
-	//
-	// save the current namespace handle
-	//
-	h, err := netns.GetMyHandle()
-	if err != nil {
-		return fmt.Errorf("IfUnsetNS(%s): GetMyHandle(): %v", nsName, err)
-	}
 	//
-	// switch to namespace `nsName'
+	// open a handle in namespace `nsName' instead of switching
+	// the namespace of this thread
 	//
-	ns, err = netns.SetByName(nsName)
+	h, err := NewHandleByName(nsName)
 	if err != nil {
 		return fmt.Errorf("IfUnsetNS(): namespace %s: %v", nsName, err)
 	}
-	defer ns.Close()
+	defer h.Close()
 
 	//
 	// delete interface from this namespace
 	//
-	err = IfSetNSbyPid(ifName, 1)
+	if err := h.IfSetNSbyPid(ifName, 1); err != nil {
+		return fmt.Errorf("IfSetNSbyPid(%s, 1): %v", ifName, err)
+	}
+	return nil
+}
+
+// netnsPath returns the path of the bind mount of named network
+// namespace `nsName'
+func netnsPath(nsName string) string {
+	return filepath.Join(NetnsRunDir, nsName)
+}
+
+// netnsRunDirPrepare creates NetnsRunDir unless it exists and
+// makes it a shared mount point so that the bind mounts of
+// network namespaces propagate to other mount namespaces.
+// This is what `ip netns add' does.
+// return: nil if success
+//         non-nil otherwise
+func netnsRunDirPrepare() error {
+	if err := os.MkdirAll(NetnsRunDir, 0755); err != nil {
+		return fmt.Errorf("MkdirAll(%s): %v", NetnsRunDir, err)
+	}
+	made := false
+	for {
+		err := unix.Mount("", NetnsRunDir, "none",
+			unix.MS_SHARED|unix.MS_REC, "")
+		if err == nil {
+			return nil
+		}
+		if err != unix.EINVAL || made {
+			return fmt.Errorf("mount --make-shared %s: %v", NetnsRunDir, err)
+		}
+		//
+		// NetnsRunDir is not a mount point. Upgrade it to one.
+		//
+		err = unix.Mount(NetnsRunDir, NetnsRunDir, "none",
+			unix.MS_BIND|unix.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("mount --bind %s %s: %v",
+				NetnsRunDir, NetnsRunDir, err)
+		}
+		made = true
+	}
+}
+
+// NetnsAdd creates a named network namespace `nsName' in the same
+// way as `ip netns add' does. The namespace of the calling thread
+// is not changed.
+// in: nsName Name of the network namespace to be added
+// return: nil if success
+//         non-nil otherwise
+func NetnsAdd(nsName string) error {
+	banner := fmt.Sprintf("NetnsAdd(%s): ", nsName)
+	if err := netnsRunDirPrepare(); err != nil {
+		return fmt.Errorf(banner+"%v", err)
+	}
+	path := netnsPath(nsName)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CREAT|unix.O_EXCL, 0)
+	if err != nil {
+		return fmt.Errorf(banner+"Open(%s): %v", path, err)
+	}
+	unix.Close(fd)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	orig, err := unix.Open("/proc/thread-self/ns/net",
+		unix.O_RDONLY|unix.O_CLOEXEC, 0)
 	if err != nil {
-		errMsg = fmt.Sprintf("IfSetNSbyPid(%s, 1): %v. ", ifName, err)
+		os.Remove(path)
+		return fmt.Errorf(banner+"Open(/proc/thread-self/ns/net): %v", err)
+	}
+	defer unix.Close(orig)
+
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		os.Remove(path)
+		return fmt.Errorf(banner+"Unshare(): %v", err)
+	}
+	err = unix.Mount("/proc/thread-self/ns/net", path, "none", unix.MS_BIND, "")
+	if err != nil {
+		err = fmt.Errorf(banner+"mount --bind %s: %v", path, err)
+		os.Remove(path)
 	}
 	//
 	// back to original namespace
 	//
-	err = netns.SetByHandle(h)
+	if serr := unix.Setns(orig, unix.CLONE_NEWNET); serr != nil {
+		//
+		// Keep this thread locked. It is terminated when the
+		// goroutine exits.
+		//
+		runtime.LockOSThread()
+		if err != nil {
+			return fmt.Errorf("%v; failed to switch back namespace: %v",
+				err, serr)
+		}
+		return fmt.Errorf(banner+"failed to switch back namespace: %v", serr)
+	}
+	return err
+}
+
+// NetnsDelete deletes named network namespace `nsName' in the same
+// way as `ip netns delete' does. The namespace itself is freed by the
+// kernel when no process or interface uses it.
+// in: nsName Name of the network namespace to be deleted
+// return: nil if success
+//         non-nil otherwise
+func NetnsDelete(nsName string) error {
+	path := netnsPath(nsName)
+	//
+	// EINVAL: `path' is not a mount point. Remove the stale file.
+	//
+	err := unix.Unmount(path, unix.MNT_DETACH)
+	if err != nil && err != unix.EINVAL {
+		return fmt.Errorf("NetnsDelete(%s): umount(%s): %v", nsName, path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("NetnsDelete(%s): %v", nsName, err)
+	}
+	return nil
+}
+
+// NetnsList returns the names of the named network namespaces
+// return: 1. slice of network namespace names if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NetnsList() ([]string, error) {
+	var names []string
+
+	files, err := ioutil.ReadDir(NetnsRunDir)
 	if err != nil {
-		errMsg += fmt.Sprintf(
-			"IfUnsetNS(%s): failed to switch back namespace: %v", nsName, err)
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return nil, fmt.Errorf("NetnsList(): ReadDir(%s): %v", NetnsRunDir, err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if ok, _ := isNetns(netnsPath(f.Name())); ok {
+			names = append(names, f.Name())
+		}
 	}
-	if errMsg == "" {
-		return nil
+	return names, nil
+}
+
+// NetnsExists returns true if named network namespace `nsName' exists
+// in: nsName Name of the network namespace
+// return: 1. true if `nsName' exists
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NetnsExists(nsName string) (bool, error) {
+	ok, err := isNetns(netnsPath(nsName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("NetnsExists(%s): %v", nsName, err)
+	}
+	return ok, nil
+}
+
+// isNetns returns true if `path' is a bind mount of a network namespace
+func isNetns(path string) (bool, error) {
+	var st unix.Statfs_t
+
+	if err := unix.Statfs(path, &st); err != nil {
+		if err == unix.ENOENT {
+			return false, os.ErrNotExist
+		}
+		return false, err
+	}
+	return st.Type == unix.NSFS_MAGIC, nil
+}
+
+// NetnsGetId returns the netnsid (nsid) of named network namespace
+// `nsName'.
+// in: nsName Name of the network namespace
+// return: 1. nsid if success. NSIDNotAssigned unless nsid is assigned
+//            -1 otherwise
+//         2. nil if success
+//            non-nil otherwise
+func NetnsGetId(nsName string) (int, error) {
+	return pkgHandle.NetnsGetId(nsName)
+}
+
+// NetnsGetId returns the netnsid (nsid) of named network namespace
+// `nsName' seen from the network namespace of `h'
+func (h *Handle) NetnsGetId(nsName string) (int, error) {
+	path := netnsPath(nsName)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("NetnsGetId(%s): Open(%s): %v", nsName, path, err)
+	}
+	defer unix.Close(fd)
+
+	id, err := h.nlh.GetNetNsIdByFd(fd)
+	if err != nil {
+		return -1, fmt.Errorf("NetnsGetId(%s): %v", nsName, err)
+	}
+	return id, nil
+}
+
+// NetnsSetId assigns netnsid `nsid' to named network namespace `nsName'
+// in the same way as `ip netns set' does.
+// in: nsName Name of the network namespace
+//     nsid netnsid to be assigned
+// return: nil if success
+//         non-nil otherwise
+func NetnsSetId(nsName string, nsid int) error {
+	return pkgHandle.NetnsSetId(nsName, nsid)
+}
+
+// NetnsSetId assigns netnsid `nsid' to named network namespace `nsName'
+// in the network namespace of `h'
+func (h *Handle) NetnsSetId(nsName string, nsid int) error {
+	path := netnsPath(nsName)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("NetnsSetId(%s, %d): Open(%s): %v",
+			nsName, nsid, path, err)
+	}
+	defer unix.Close(fd)
+
+	if err := h.nlh.SetNetNsIdByFd(fd, nsid); err != nil {
+		return fmt.Errorf("NetnsSetId(%s, %d): %v", nsName, nsid, err)
+	}
+	return nil
+}
+
+// nsDo runs `f' in the network namespace referred to by file
+// descriptor `fd'. The calling goroutine is locked to its thread
+// while `f' runs so that no other goroutine is scheduled on the thread
+// in the namespace.
+// in: fd File descriptor of the network namespace
+//     f Function to be executed
+// return: nil if both `f' and switching back the namespace succeed
+//         non-nil otherwise. It contains the errors of both.
+func nsDo(fd int, f func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	orig, err := unix.Open("/proc/thread-self/ns/net",
+		unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("Open(/proc/thread-self/ns/net): %v", err)
+	}
+	defer unix.Close(orig)
+
+	if err := unix.Setns(fd, unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("Setns(): %v", err)
+	}
+	ferr := f()
+	if err := unix.Setns(orig, unix.CLONE_NEWNET); err != nil {
+		//
+		// The thread is left in the wrong namespace.
+		// Keep it locked so that it will be terminated
+		// when the goroutine exits.
+		//
+		runtime.LockOSThread()
+		if ferr != nil {
+			return fmt.Errorf("%v; failed to switch back namespace: %v",
+				ferr, err)
+		}
+		return fmt.Errorf("failed to switch back namespace: %v", err)
+	}
+	return ferr
+}
+
+// NetnsDo runs `f' in named network namespace `nsName' and
+// switches back to the original namespace. The package level
+// functions called in `f' act on `nsName'. Note that the goroutines
+// started in `f' do not run in `nsName'.
+// in: nsName Name of the network namespace
+//     f Function to be executed
+// return: nil if success
+//         non-nil otherwise. It contains both the error returned by `f'
+//         and the error in switching back to the original namespace
+func NetnsDo(nsName string, f func() error) error {
+	path := netnsPath(nsName)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("NetnsDo(%s): Open(%s): %v", nsName, path, err)
+	}
+	defer unix.Close(fd)
+
+	if err := nsDo(fd, f); err != nil {
+		return fmt.Errorf("NetnsDo(%s): %v", nsName, err)
+	}
+	return nil
+}
+
+// NetnsDoByPid runs `f' in the network namespace of process `pid'
+// and switches back to the original namespace.
+// in: pid Process ID
+//     f Function to be executed
+// return: nil if success
+//         non-nil otherwise. It contains both the error returned by `f'
+//         and the error in switching back to the original namespace
+func NetnsDoByPid(pid int, f func() error) error {
+	path := fmt.Sprintf("/proc/%d/ns/net", pid)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("NetnsDoByPid(%d): Open(%s): %v", pid, path, err)
+	}
+	defer unix.Close(fd)
+
+	if err := nsDo(fd, f); err != nil {
+		return fmt.Errorf("NetnsDoByPid(%d): %v", pid, err)
 	}
-	return fmt.Errorf(errMsg)
+	return nil
 }
@@ -0,0 +1,643 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"net"
+	"sort"
+	"strings"
+)
+
+// PlanAction is the type of a plan operation
+type PlanAction int
+
+const (
+	PlanCreate PlanAction = iota
+	PlanModify
+	PlanDelete
+)
+
+func (a PlanAction) String() string {
+	switch a {
+	case PlanCreate:
+		return "+"
+	case PlanModify:
+		return "~"
+	case PlanDelete:
+		return "-"
+	default:
+		return "?"
+	}
+}
+
+// PlanOp is an operation of a plan
+type PlanOp struct {
+	Action PlanAction
+	Kind   string // netns, bridge, vrf, veth, vlan, master, address, link or route
+	Netns  string // network namespace of the object
+	Name   string // name of the object (interface name, prefix, ...)
+	Detail string // what is changed
+	do     func(hs topoHandles) error
+}
+
+// Plan is a list of the operations that converge the system to
+// a Topology. The operations are applied in order.
+type Plan struct {
+	Ops []PlanOp
+}
+
+// String renders this operation in a line as follows:
+//   <+|~|-> <kind> <name>[@<netns>][: <detail>]
+func (op *PlanOp) String() string {
+	s := fmt.Sprintf("%s %s %s", op.Action, op.Kind, op.Name)
+	if op.Netns != "" {
+		s += "@" + op.Netns
+	}
+	if op.Detail != "" {
+		s += ": " + op.Detail
+	}
+	return s
+}
+
+// Apply applies this operation
+// return: nil if success
+//         non-nil otherwise
+func (op *PlanOp) Apply() error {
+	hs := make(topoHandles)
+	defer hs.close()
+
+	if err := op.do(hs); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	return nil
+}
+
+// Empty returns true if this plan has no operations
+func (p *Plan) Empty() bool {
+	return len(p.Ops) == 0
+}
+
+// String renders this plan, an operation per line
+func (p *Plan) String() string {
+	if p.Empty() {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	for i := range p.Ops {
+		b.WriteString(p.Ops[i].String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Apply applies all the operations of this plan in order.
+// It stops at the first error.
+// return: nil if success
+//         non-nil otherwise
+func (p *Plan) Apply() error {
+	hs := make(topoHandles)
+	defer hs.close()
+
+	for i := range p.Ops {
+		op := &p.Ops[i]
+		if err := op.do(hs); err != nil {
+			return fmt.Errorf("Plan.Apply(): %s: %v", op, err)
+		}
+	}
+	return nil
+}
+
+const (
+	planNetns = iota
+	planLink
+	planIf
+	planRoute
+	planDelete
+	planSections
+)
+
+// planner computes Plan comparing Topology with the live state
+type planner struct {
+	hs        topoHandles
+	nsOK      map[string]bool
+	routes    map[string]Routes
+	recreated map[string]bool // <netns>/<name> of the VRFs to be recreated
+	ops       [planSections][]PlanOp
+}
+
+// handle returns the Handle for network namespace `nsName'.
+// Returns nil if `nsName' does not exist yet.
+func (pl *planner) handle(nsName string) *Handle {
+	if nsName != "" && !pl.nsOK[nsName] {
+		return nil
+	}
+	h, err := pl.hs.get(nsName)
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+func (pl *planner) add(section int, action PlanAction, kind, nsName, name,
+	detail string, do func(hs topoHandles) error) {
+	pl.ops[section] = append(pl.ops[section], PlanOp{
+		Action: action,
+		Kind:   kind,
+		Netns:  nsName,
+		Name:   name,
+		Detail: detail,
+		do:     do,
+	})
+}
+
+// link returns the link `name' in `nsName'. nil if it does not exist.
+func (pl *planner) link(nsName, name string) netlink.Link {
+	if h := pl.handle(nsName); h != nil {
+		if l, err := h.nlh.LinkByName(name); err == nil {
+			return l
+		}
+	}
+	return nil
+}
+
+// prefixString returns `ipnet' in the canonical string
+func prefixString(ipnet *net.IPNet) string {
+	ip := ipnet.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	ones, _ := ipnet.Mask.Size()
+	return fmt.Sprintf("%s/%d", ip, ones)
+}
+
+// Plan computes the operations that converge the system to Topology
+// `t' without changing anything. Unlike Apply(), the plan also
+// deletes the addresses on the interfaces in `t' and the routes in
+// the tables of the VRFs in `t' that are not in `t'.
+// return: 1. Pointer to Plan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (t *Topology) Plan() (*Plan, error) {
+	pl := &planner{
+		hs:        make(topoHandles),
+		nsOK:      make(map[string]bool),
+		routes:    make(map[string]Routes),
+		recreated: make(map[string]bool),
+	}
+	defer pl.hs.close()
+
+	for _, ns := range t.Namespaces {
+		ns := ns
+		if ok, _ := NetnsExists(ns); ok {
+			pl.nsOK[ns] = true
+			continue
+		}
+		pl.add(planNetns, PlanCreate, "netns", "", ns, "",
+			func(hs topoHandles) error { return NetnsAdd(ns) })
+	}
+	//
+	// namespaces that are not in t.Namespaces but exist
+	//
+	nss, _ := NetnsList()
+	for _, ns := range nss {
+		pl.nsOK[ns] = true
+	}
+	for i := range t.Bridges {
+		if err := pl.planBridge(&t.Bridges[i]); err != nil {
+			return nil, fmt.Errorf("Plan(): bridge %s: %v", t.Bridges[i].Name, err)
+		}
+	}
+	for i := range t.Vrfs {
+		if err := pl.planVrf(&t.Vrfs[i]); err != nil {
+			return nil, fmt.Errorf("Plan(): VRF %s: %v", t.Vrfs[i].Name, err)
+		}
+	}
+	for i := range t.Veths {
+		if err := pl.planVeth(&t.Veths[i]); err != nil {
+			return nil, fmt.Errorf("Plan(): veth %s: %v", t.Veths[i].Name, err)
+		}
+	}
+	for i := range t.Vlans {
+		if err := pl.planVlan(&t.Vlans[i]); err != nil {
+			return nil, fmt.Errorf("Plan(): VLAN %s: %v", t.Vlans[i].Name(), err)
+		}
+	}
+	if err := pl.planRoutes(t); err != nil {
+		return nil, fmt.Errorf("Plan(): %v", err)
+	}
+	p := &Plan{}
+	for _, ops := range pl.ops {
+		p.Ops = append(p.Ops, ops...)
+	}
+	return p, nil
+}
+
+func (pl *planner) planBridge(b *BridgeSpec) error {
+	ns, name := b.Netns, b.Name
+	exists := pl.link(ns, name) != nil
+	if !exists {
+		pl.add(planLink, PlanCreate, "bridge", ns, name, "",
+			func(hs topoHandles) error {
+				h, err := hs.get(ns)
+				if err != nil {
+					return err
+				}
+				_, err = h.BridgeAdd(name, nil, Up)
+				return err
+			})
+	}
+	return pl.planIf(ns, name, "", b.Addresses, exists)
+}
+
+func (pl *planner) planVrf(v *VrfSpec) error {
+	ns, name, table := v.Netns, v.Name, v.Table
+	exists := false
+	if h := pl.handle(ns); h != nil {
+		if vrf, err := h.VrfGetByName(name); err == nil {
+			if vrf.Tid() == table {
+				exists = true
+			} else {
+				pl.add(planLink, PlanModify, "vrf", ns, name,
+					fmt.Sprintf("table %d -> %d (recreated)", vrf.Tid(), table),
+					func(hs topoHandles) error {
+						h, err := hs.get(ns)
+						if err != nil {
+							return err
+						}
+						if err := h.VrfDelete(name); err != nil {
+							return err
+						}
+						_, err = h.VrfAdd(name, table, Up)
+						return err
+					})
+				//
+				// the addresses and the slaves are gone with the old VRF
+				//
+				pl.recreated[ns+"/"+name] = true
+				return pl.planIf(ns, name, "", v.Addresses, false)
+			}
+		}
+	}
+	if !exists {
+		pl.add(planLink, PlanCreate, "vrf", ns, name,
+			fmt.Sprintf("table %d", table),
+			func(hs topoHandles) error {
+				h, err := hs.get(ns)
+				if err != nil {
+					return err
+				}
+				_, err = h.VrfAdd(name, table, Up)
+				return err
+			})
+	}
+	return pl.planIf(ns, name, "", v.Addresses, exists)
+}
+
+func (pl *planner) planVeth(v *VethSpec) error {
+	exists := pl.link(v.Netns, v.Name) != nil
+	if !exists {
+		peer := v.Peer.Name
+		if v.Peer.Netns != "" {
+			peer += "@" + v.Peer.Netns
+		}
+		pl.add(planLink, PlanCreate, "veth", v.Netns, v.Name, "peer "+peer,
+			func(hs topoHandles) error {
+				if err := v.create(hs); err != nil {
+					return err
+				}
+				for _, end := range []*VethEnd{&v.VethEnd, &v.Peer} {
+					h, err := hs.get(end.Netns)
+					if err != nil {
+						return err
+					}
+					if err := h.IfUpByName(end.Name); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+	}
+	err := pl.planIf(v.Netns, v.Name, v.Master, v.Addresses, exists)
+	if err != nil {
+		return err
+	}
+	return pl.planIf(v.Peer.Netns, v.Peer.Name, v.Peer.Master,
+		v.Peer.Addresses, exists)
+}
+
+func (pl *planner) planVlan(v *VlanSpec) error {
+	ns, parent, id := v.Netns, v.Parent, v.Id
+	exists := pl.link(ns, v.Name()) != nil
+	if !exists {
+		pl.add(planLink, PlanCreate, "vlan", ns, v.Name(),
+			fmt.Sprintf("id %d on %s", id, parent),
+			func(hs topoHandles) error {
+				h, err := hs.get(ns)
+				if err != nil {
+					return err
+				}
+				vlan, err := h.VlanAdd(parent, id)
+				if err != nil {
+					return err
+				}
+				return h.IfUpByName(vlan.Name())
+			})
+	}
+	return pl.planIf(ns, v.Name(), v.Master, v.Addresses, exists)
+}
+
+// planIf plans the master, the addresses and the state of
+// interface `name'
+func (pl *planner) planIf(ns, name, master string, addrs []string,
+	exists bool) error {
+	var l netlink.Link
+	if exists {
+		l = pl.link(ns, name)
+	}
+	h := pl.handle(ns)
+
+	if master != "" {
+		cur := ""
+		if l != nil && l.Attrs().MasterIndex != 0 {
+			cur, _ = h.IfName(l.Attrs().MasterIndex)
+		}
+		if cur != master || pl.recreated[ns+"/"+master] {
+			action, detail := PlanCreate, master
+			if l != nil {
+				if cur == "" {
+					cur = "none"
+				}
+				action, detail = PlanModify, cur+" -> "+master
+			}
+			pl.add(planIf, action, "master", ns, name, detail,
+				func(hs topoHandles) error {
+					h, err := hs.get(ns)
+					if err != nil {
+						return err
+					}
+					return h.ensureMaster(name, master)
+				})
+		}
+	}
+
+	cur := make(map[string]*net.IPNet)
+	if l != nil {
+		pfxs, err := h.IpAddrList(name, FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		for _, pfx := range pfxs {
+			if pfx.IP.IsLinkLocalUnicast() && pfx.IP.To4() == nil {
+				continue // fe80::/64 added by the kernel
+			}
+			cur[prefixString(pfx)] = pfx
+		}
+	}
+	want := make(map[string]bool)
+	for _, a := range addrs {
+		ip, ipnet, err := net.ParseCIDR(a)
+		if err != nil {
+			return err
+		}
+		ipnet.IP = ip
+		s := prefixString(ipnet)
+		want[s] = true
+		if cur[s] != nil {
+			continue
+		}
+		pl.add(planIf, PlanCreate, "address", ns, s, "on "+name,
+			func(hs topoHandles) error {
+				h, err := hs.get(ns)
+				if err != nil {
+					return err
+				}
+				return h.IpAddrAdd(name, ipnet, Down)
+			})
+	}
+	var stale []string
+	for s := range cur {
+		if !want[s] {
+			stale = append(stale, s)
+		}
+	}
+	sort.Strings(stale)
+	for _, s := range stale {
+		pfx := cur[s]
+		pl.add(planDelete, PlanDelete, "address", ns, s, "on "+name,
+			func(hs topoHandles) error {
+				h, err := hs.get(ns)
+				if err != nil {
+					return err
+				}
+				return h.IpAddrDelete(name, pfx)
+			})
+	}
+
+	if l != nil && l.Attrs().Flags&net.FlagUp == 0 {
+		pl.add(planIf, PlanModify, "link", ns, name, "down -> up",
+			func(hs topoHandles) error {
+				h, err := hs.get(ns)
+				if err != nil {
+					return err
+				}
+				return h.IfUpByName(name)
+			})
+	}
+	return nil
+}
+
+// tableRoutes returns the unicast routes in table `table' of `nsName'
+func (pl *planner) tableRoutes(nsName string, table int) Routes {
+	key := fmt.Sprintf("%s/%d", nsName, table)
+	if rr, ok := pl.routes[key]; ok {
+		return rr
+	}
+	var rr Routes
+	if h := pl.handle(nsName); h != nil {
+		rr, _ = h.VrfGetRoutesByTid(table, FAMILY_ALL, RTN_UNICAST)
+	}
+	pl.routes[key] = rr
+	return rr
+}
+
+// routeDst returns the destination of `dst' in the canonical string
+func routeDst(dst *net.IPNet) string {
+	if dst == nil {
+		return "default"
+	}
+	if ones, _ := dst.Mask.Size(); ones == 0 {
+		return "default"
+	}
+	return prefixString(dst)
+}
+
+// routeKey returns the key of the route to `dst' of address family
+// `family' in table `table' of `nsName'. The IPv4 and IPv6 default
+// routes differ only in the family.
+func routeKey(nsName string, table, family int, dst *net.IPNet) string {
+	return fmt.Sprintf("%s/%d/%d/%s", nsName, table, family, routeDst(dst))
+}
+
+// ipFamily returns the address family of `ip'
+func ipFamily(ip net.IP) int {
+	if ip.To4() != nil {
+		return FAMILY_V4
+	}
+	return FAMILY_V6
+}
+
+// describeRoute returns the next-hops and the device of `r'
+func describeRoute(h *Handle, r *Route) string {
+	var via []string
+	dev := ""
+	if r.Gw != nil {
+		via = append(via, r.Gw.String())
+	}
+	for _, nh := range r.MultiPath {
+		via = append(via, nh.Gw.String())
+	}
+	if r.LinkIndex != 0 {
+		dev, _ = h.IfName(r.LinkIndex)
+	}
+	return routeDetail(via, dev)
+}
+
+func routeDetail(via []string, dev string) string {
+	var s []string
+	if len(via) > 0 {
+		v := append([]string{}, via...)
+		sort.Strings(v)
+		s = append(s, "via "+strings.Join(v, ","))
+	}
+	if dev != "" {
+		s = append(s, "dev "+dev)
+	}
+	return strings.Join(s, " ")
+}
+
+func (pl *planner) planRoutes(t *Topology) error {
+	tables := make(map[string]int) // VRF@netns -> table
+	for _, v := range t.Vrfs {
+		tables[v.Name+"@"+v.Netns] = int(v.Table)
+	}
+	want := make(map[string]bool) // netns/table/family/dst
+	for i := range t.Routes {
+		rs := &t.Routes[i]
+		_, dst, err := net.ParseCIDR(rs.Dst)
+		if err != nil {
+			return fmt.Errorf("route %s: %v", rs.Dst, err)
+		}
+		for _, s := range rs.Via {
+			if net.ParseIP(s) == nil {
+				return fmt.Errorf("route %s: invalid next-hop %s", rs.Dst, s)
+			}
+		}
+		table := unix.RT_TABLE_MAIN
+		if rs.Vrf != "" {
+			table = tables[rs.Vrf+"@"+rs.Netns]
+			if table == 0 {
+				if h := pl.handle(rs.Netns); h != nil {
+					if vrf, err := h.VrfGetByName(rs.Vrf); err == nil {
+						table = int(vrf.Tid())
+					}
+				}
+			}
+		}
+		name := routeDst(dst)
+		key := routeKey(rs.Netns, table, ipFamily(dst.IP), dst)
+		want[key] = true
+		detail := routeDetail(rs.Via, rs.Dev)
+		if rs.Vrf != "" {
+			detail += " vrf " + rs.Vrf
+		}
+		var cur *Route
+		if table != 0 {
+			rr := pl.tableRoutes(rs.Netns, table)
+			for j := range rr {
+				r := &rr[j]
+				if routeKey(rs.Netns, table, r.Family, r.Dst) == key {
+					cur = r
+					break
+				}
+			}
+		}
+		action := PlanCreate
+		if cur != nil {
+			h := pl.handle(rs.Netns)
+			curDetail := describeRoute(h, cur)
+			var curDev string
+			if cur.LinkIndex != 0 {
+				curDev, _ = h.IfName(cur.LinkIndex)
+			}
+			dev := rs.Dev
+			if dev == "" && len(cur.MultiPath) == 0 {
+				dev = curDev // not specified: any device
+			}
+			if routeDetail(rs.Via, dev) == curDetail {
+				continue
+			}
+			action = PlanModify
+			detail = curDetail + " -> " + detail
+		}
+		pl.add(planRoute, action, "route", rs.Netns, name, detail,
+			func(hs topoHandles) error {
+				h, err := hs.get(rs.Netns)
+				if err != nil {
+					return err
+				}
+				r, err := h.route(rs)
+				if err != nil {
+					return err
+				}
+				if rs.Vrf != "" {
+					return h.VrfReplaceRouteByName(rs.Vrf, r)
+				}
+				return h.ReplaceRoute(r)
+			})
+	}
+
+	//
+	// the routes in the VRF tables that are not in `t'
+	//
+	for _, v := range t.Vrfs {
+		ns, table := v.Netns, int(v.Table)
+		h := pl.handle(ns)
+		rr := pl.tableRoutes(ns, table)
+		for j := range rr {
+			r := rr[j]
+			name := routeDst(r.Dst)
+			if r.Protocol == unix.RTPROT_KERNEL ||
+				want[routeKey(ns, table, r.Family, r.Dst)] {
+				continue
+			}
+			pl.add(planDelete, PlanDelete, "route", ns, name,
+				describeRoute(h, &r)+" vrf "+v.Name,
+				func(hs topoHandles) error {
+					h, err := hs.get(ns)
+					if err != nil {
+						return err
+					}
+					return h.nlh.RouteDel(&r)
+				})
+		}
+	}
+	return nil
+}
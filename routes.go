@@ -18,7 +18,6 @@ package iproute
 
 import (
 	"fmt"
-	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
 	"net"
 )
@@ -37,7 +36,7 @@ func NewRoute(dst *net.IPNet, nh IPs) (Route, error) {
 	}
 	errMsg := fmt.Sprintf("ERROR: NewRoute(%v, %v): ", dst, nh)
 	if len(nh) <= 0 {
-		return Route{}, fmt.Errorf(errMsg + "# of nh is <= 0")
+		return Route{}, fmt.Errorf("%s# of nh is <= 0", errMsg)
 	}
 	r := Route{Dst: dst}
 	for _, ipa := range nh {
@@ -136,7 +135,13 @@ func ClearPervasive(i interface{}) error {
 //         2. nil if success
 //            non-nil otherwise
 func GetRoutes(family int, tblType int) (Routes, error) {
-	return VrfGetRoutesByTid(0, family, tblType)
+	return pkgHandle.VrfGetRoutesByTid(0, family, tblType)
+}
+
+// GetRoutes returns a slice of netlink.Route whose family is `family',
+// and table type is `tableType' in the network namespace of `h'
+func (h *Handle) GetRoutes(family int, tblType int) (Routes, error) {
+	return h.VrfGetRoutesByTid(0, family, tblType)
 }
 
 // GetIPv4routes returns a slice of IPv4 netlink.Route
@@ -145,7 +150,13 @@ func GetRoutes(family int, tblType int) (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func GetIPv4routes() (Routes, error) {
-	return VrfGetRoutesByTid(0, nl.FAMILY_V4, RTN_UNICAST)
+	return pkgHandle.VrfGetRoutesByTid(0, nl.FAMILY_V4, RTN_UNICAST)
+}
+
+// GetIPv4routes returns a slice of IPv4 netlink.Route in the
+// network namespace of `h'
+func (h *Handle) GetIPv4routes() (Routes, error) {
+	return h.VrfGetRoutesByTid(0, nl.FAMILY_V4, RTN_UNICAST)
 }
 
 // GetIPv4localRoutes returns a slice of IPv4 netlink.Route of
@@ -155,7 +166,13 @@ func GetIPv4routes() (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func GetIPv4localRoutes() (Routes, error) {
-	return VrfGetRoutesByTid(0, nl.FAMILY_V4, RTN_LOCAL)
+	return pkgHandle.VrfGetRoutesByTid(0, nl.FAMILY_V4, RTN_LOCAL)
+}
+
+// GetIPv4localRoutes returns a slice of IPv4 netlink.Route of
+// local routes in the network namespace of `h'
+func (h *Handle) GetIPv4localRoutes() (Routes, error) {
+	return h.VrfGetRoutesByTid(0, nl.FAMILY_V4, RTN_LOCAL)
 }
 
 // GetIPv6routes returns a slice of IPv6 netlink.Route
@@ -164,7 +181,13 @@ func GetIPv4localRoutes() (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func GetIPv6routes(name string) (Routes, error) {
-	return VrfGetRoutesByTid(0, nl.FAMILY_V6, RTN_UNICAST)
+	return pkgHandle.VrfGetRoutesByTid(0, nl.FAMILY_V6, RTN_UNICAST)
+}
+
+// GetIPv6routes returns a slice of IPv6 netlink.Route in the
+// network namespace of `h'
+func (h *Handle) GetIPv6routes(name string) (Routes, error) {
+	return h.VrfGetRoutesByTid(0, nl.FAMILY_V6, RTN_UNICAST)
 }
 
 // AddRoute adds a route
@@ -172,8 +195,13 @@ func GetIPv6routes(name string) (Routes, error) {
 // return: nil if success
 //         non-nil otherwise
 func AddRoute(r *Route) error {
+	return pkgHandle.AddRoute(r)
+}
+
+// AddRoute adds a route to the network namespace of `h'
+func (h *Handle) AddRoute(r *Route) error {
 	r.Table = 0
-	return netlink.RouteAdd(r)
+	return h.nlh.RouteAdd(r)
 }
 
 // DeleteRoute deletes a route
@@ -181,8 +209,13 @@ func AddRoute(r *Route) error {
 // return: nil if success
 //         non-nil otherwise
 func DeleteRoute(r *Route) error {
+	return pkgHandle.DeleteRoute(r)
+}
+
+// DeleteRoute deletes a route from the network namespace of `h'
+func (h *Handle) DeleteRoute(r *Route) error {
 	r.Table = 0
-	return netlink.RouteDel(r)
+	return h.nlh.RouteDel(r)
 }
 
 // ReplaceRoute replaces the existing route
@@ -191,6 +224,12 @@ func DeleteRoute(r *Route) error {
 // return: nil if success
 //         non-nil otherwise
 func ReplaceRoute(r *Route) error {
+	return pkgHandle.ReplaceRoute(r)
+}
+
+// ReplaceRoute replaces the existing route in the network namespace
+// of `h'. The route is added unless it exists.
+func (h *Handle) ReplaceRoute(r *Route) error {
 	r.Table = 0
-	return netlink.RouteReplace(r)
+	return h.nlh.RouteReplace(r)
 }
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"strings"
+	"syscall"
+)
+
+//
+// Helpers for the rtnetlink messages the netlink package does not build
+//
+
+// execute executes netlink request `req' in the network namespace of `h'
+// in: req Netlink request
+//     sockType Netlink protocol (e.g. unix.NETLINK_ROUTE)
+//     resType Type of the response messages. 0 for ACK only.
+// return: 1. Slice of response messages if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (h *Handle) execute(req *nl.NetlinkRequest, sockType int,
+	resType uint16) ([][]byte, error) {
+	var msgs [][]byte
+
+	err := h.do(func() error {
+		var err error
+		msgs, err = req.Execute(sockType, resType)
+		return err
+	})
+	return msgs, err
+}
+
+// newLinkRequest returns a RTM_NEWLINK request for interface `name'
+// (index == 0) or the interface whose ifindex is `index'
+// in: flags NLM_F_* flags in addition to NLM_F_ACK
+//     index Ifindex of the existing interface. 0 to create one
+//     name Name of the interface to be created
+// return: Pointer to nl.NetlinkRequest
+func newLinkRequest(flags int, index int, name string) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, flags|unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+	if name != "" {
+		req.AddData(nl.NewRtAttr(unix.IFLA_IFNAME, nl.ZeroTerminated(name)))
+	}
+	return req
+}
+
+// newLinkInfo returns IFLA_LINKINFO attribute whose IFLA_INFO_KIND
+// is `kind', and its (empty) IFLA_INFO_DATA attribute
+// in: kind Kind of the link (e.g. "bridge")
+// return: 1. Pointer to IFLA_LINKINFO
+//         2. Pointer to IFLA_INFO_DATA
+func newLinkInfo(kind string) (*nl.RtAttr, *nl.RtAttr) {
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_KIND, nl.NonZeroTerminated(kind))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	return linkInfo, data
+}
+
+// newSlaveLinkInfo returns IFLA_LINKINFO attribute whose
+// IFLA_INFO_SLAVE_KIND is `kind', and its (empty) IFLA_INFO_SLAVE_DATA
+// attribute
+// in: kind Kind of the master (e.g. "bridge")
+// return: 1. Pointer to IFLA_LINKINFO
+//         2. Pointer to IFLA_INFO_SLAVE_DATA
+func newSlaveLinkInfo(kind string) (*nl.RtAttr, *nl.RtAttr) {
+	linkInfo := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	linkInfo.AddRtAttr(nl.IFLA_INFO_SLAVE_KIND, nl.NonZeroTerminated(kind))
+	data := linkInfo.AddRtAttr(nl.IFLA_INFO_SLAVE_DATA, nil)
+	return linkInfo, data
+}
+
+// linkAttrs returns the IFLA_* attributes of the interface whose
+// ifindex is `index'
+// in: index Ifindex of the interface
+// return: 1. Slice of the attributes if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (h *Handle) linkAttrs(index int) ([]syscall.NetlinkRouteAttr, error) {
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+
+	msgs, err := h.execute(req, unix.NETLINK_ROUTE, unix.RTM_NEWLINK)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("ifindex %d: link not found", index)
+	}
+	return nl.ParseRouteAttr(msgs[0][unix.SizeofIfInfomsg:])
+}
+
+// linkInfoData returns the attributes in IFLA_LINKINFO/IFLA_INFO_DATA
+// (or IFLA_INFO_SLAVE_DATA if `slave' is true) of the interface
+// whose ifindex is `index'
+// in: index Ifindex of the interface
+//     slave Return IFLA_INFO_SLAVE_DATA if true
+//           Return IFLA_INFO_DATA otherwise
+// return: 1. Slice of the attributes if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (h *Handle) linkInfoData(index int,
+	slave bool) ([]syscall.NetlinkRouteAttr, error) {
+	attrs, err := h.linkAttrs(index)
+	if err != nil {
+		return nil, err
+	}
+	linkInfo := attrByType(attrs, unix.IFLA_LINKINFO)
+	if linkInfo == nil {
+		return nil, nil
+	}
+	info, err := nl.ParseRouteAttr(linkInfo.Value)
+	if err != nil {
+		return nil, err
+	}
+	t := uint16(nl.IFLA_INFO_DATA)
+	if slave {
+		t = nl.IFLA_INFO_SLAVE_DATA
+	}
+	data := attrByType(info, t)
+	if data == nil {
+		return nil, nil
+	}
+	return nl.ParseRouteAttr(data.Value)
+}
+
+// linkKind returns IFLA_INFO_KIND of the interface whose ifindex
+// is `index'
+// in: index Ifindex of the interface
+// return: 1. Kind of the interface (e.g. "gre".) "" if none
+//         2. nil if success
+//            non-nil otherwise
+func (h *Handle) linkKind(index int) (string, error) {
+	attrs, err := h.linkAttrs(index)
+	if err != nil {
+		return "", err
+	}
+	linkInfo := attrByType(attrs, unix.IFLA_LINKINFO)
+	if linkInfo == nil {
+		return "", nil
+	}
+	info, err := nl.ParseRouteAttr(linkInfo.Value)
+	if err != nil {
+		return "", err
+	}
+	if kind := attrByType(info, nl.IFLA_INFO_KIND); kind != nil {
+		return strings.TrimRight(string(kind.Value), "\x00"), nil
+	}
+	return "", nil
+}
+
+// attrByType returns the attribute whose type is `t' in `attrs'
+// in: attrs Slice of the attributes
+//     t Attribute type
+// return: Pointer to the attribute if found
+//         nil otherwise
+func attrByType(attrs []syscall.NetlinkRouteAttr,
+	t uint16) *syscall.NetlinkRouteAttr {
+	for i := range attrs {
+		if attrs[i].Attr.Type&nl.NLA_TYPE_MASK == t {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+// boolAttr returns the u8 attribute value of `b'
+func boolAttr(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// rawData is a netlink request data given as bytes
+// (e.g. a family specific header)
+type rawData []byte
+
+func (d rawData) Len() int {
+	return len(d)
+}
+
+func (d rawData) Serialize() []byte {
+	return d
+}
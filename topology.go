@@ -0,0 +1,531 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vishvananda/netns"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// Topology is a declarative description of the bridges, VRFs, veth
+// pairs, VLAN interfaces and routes. Apply() creates what is missing.
+// Destroy() deletes every object in Topology, including the ones
+// that existed before Apply(), and the network namespaces listed in
+// Namespaces. A link is not deleted if it is not of the kind given
+// in Topology (e.g. a veth named as a bridge.) Netns "" means the
+// network namespace of the calling thread everywhere in Topology.
+//
+// Example (YAML):
+//   namespaces: [ns1]
+//   bridges:
+//     - name: br1
+//   vrfs:
+//     - name: vrf1
+//       table: 1
+//   veths:
+//     - name: vrf11
+//       master: vrf1
+//       addresses: [192.168.1.1/24]
+//       peer:
+//         name: br-vrf11
+//         master: br1
+//   routes:
+//     - dst: 10.0.0.0/8
+//       via: [192.168.1.254]
+//       vrf: vrf1
+type Topology struct {
+	Namespaces []string     `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	Bridges    []BridgeSpec `json:"bridges,omitempty" yaml:"bridges,omitempty"`
+	Vrfs       []VrfSpec    `json:"vrfs,omitempty" yaml:"vrfs,omitempty"`
+	Veths      []VethSpec   `json:"veths,omitempty" yaml:"veths,omitempty"`
+	Vlans      []VlanSpec   `json:"vlans,omitempty" yaml:"vlans,omitempty"`
+	Routes     []RouteSpec  `json:"routes,omitempty" yaml:"routes,omitempty"`
+}
+
+// BridgeSpec describes a bridge
+type BridgeSpec struct {
+	Name      string   `json:"name" yaml:"name"`
+	Netns     string   `json:"netns,omitempty" yaml:"netns,omitempty"`
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+}
+
+// VrfSpec describes a VRF
+type VrfSpec struct {
+	Name      string   `json:"name" yaml:"name"`
+	Netns     string   `json:"netns,omitempty" yaml:"netns,omitempty"`
+	Table     uint32   `json:"table" yaml:"table"`
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+}
+
+// VethEnd describes one end of a veth pair
+type VethEnd struct {
+	Name      string   `json:"name" yaml:"name"`
+	Netns     string   `json:"netns,omitempty" yaml:"netns,omitempty"`
+	Master    string   `json:"master,omitempty" yaml:"master,omitempty"`
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+}
+
+// VethSpec describes a veth pair
+type VethSpec struct {
+	VethEnd `yaml:",inline"`
+	Peer    VethEnd `json:"peer" yaml:"peer"`
+}
+
+// VlanSpec describes a VLAN interface <Parent>.<Id>
+type VlanSpec struct {
+	Parent    string   `json:"parent" yaml:"parent"`
+	Id        uint16   `json:"id" yaml:"id"`
+	Netns     string   `json:"netns,omitempty" yaml:"netns,omitempty"`
+	Master    string   `json:"master,omitempty" yaml:"master,omitempty"`
+	Addresses []string `json:"addresses,omitempty" yaml:"addresses,omitempty"`
+}
+
+// RouteSpec describes a route. Either Via or Dev must be given.
+type RouteSpec struct {
+	Dst   string   `json:"dst" yaml:"dst"`
+	Via   []string `json:"via,omitempty" yaml:"via,omitempty"`
+	Dev   string   `json:"dev,omitempty" yaml:"dev,omitempty"`
+	Vrf   string   `json:"vrf,omitempty" yaml:"vrf,omitempty"`
+	Netns string   `json:"netns,omitempty" yaml:"netns,omitempty"`
+}
+
+// Name returns the name of the VLAN interface
+func (v *VlanSpec) Name() string {
+	return fmt.Sprintf("%s.%d", v.Parent, v.Id)
+}
+
+// TopologyFromYAML returns Topology described in YAML
+// in: data YAML document
+// return: 1. Pointer to Topology if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TopologyFromYAML(data []byte) (*Topology, error) {
+	var t Topology
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("TopologyFromYAML(): %v", err)
+	}
+	return &t, nil
+}
+
+// TopologyFromJSON returns Topology described in JSON
+// in: data JSON document
+// return: 1. Pointer to Topology if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TopologyFromJSON(data []byte) (*Topology, error) {
+	var t Topology
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("TopologyFromJSON(): %v", err)
+	}
+	return &t, nil
+}
+
+// LoadTopology reads Topology from file `path'. The file is parsed
+// as JSON if its extension is .json, as YAML otherwise.
+// in: path Path to the file
+// return: 1. Pointer to Topology if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func LoadTopology(path string) (*Topology, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadTopology(%s): %v", path, err)
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return TopologyFromJSON(data)
+	}
+	return TopologyFromYAML(data)
+}
+
+// topoHandles holds a Handle per network namespace during
+// Apply() or Destroy()
+type topoHandles map[string]*Handle
+
+// get returns the Handle for network namespace `nsName'
+func (hs topoHandles) get(nsName string) (*Handle, error) {
+	if nsName == "" {
+		return pkgHandle, nil
+	}
+	if h, ok := hs[nsName]; ok {
+		return h, nil
+	}
+	h, err := NewHandleByName(nsName)
+	if err != nil {
+		return nil, err
+	}
+	hs[nsName] = h
+	return h, nil
+}
+
+func (hs topoHandles) close() {
+	for _, h := range hs {
+		h.Close()
+	}
+}
+
+// isGone returns true if `err' says the object does not exist
+func isGone(err error) bool {
+	return isThisInError(`not found|no such|cannot find`, err)
+}
+
+// ensureAddrs adds the IP prefixes in `addrs' to interface `ifName'
+// unless they are assigned
+func (h *Handle) ensureAddrs(ifName string, addrs []string) error {
+	for _, a := range addrs {
+		ip, ipnet, err := net.ParseCIDR(a)
+		if err != nil {
+			return fmt.Errorf("%s: %v", ifName, err)
+		}
+		ipnet.IP = ip
+		ok, err := h.IsIfPrefix(ifName, ipnet)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := h.IpAddrAdd(ifName, ipnet, Down); err != nil {
+				return fmt.Errorf("IpAddrAdd(%s, %s): %v", ifName, a, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ensureMaster binds interface `ifName' to `master' (bridge or VRF)
+// unless it is bound already. Do nothing if `master' is "".
+func (h *Handle) ensureMaster(ifName, master string) error {
+	if master == "" {
+		return nil
+	}
+	l, err := h.nlh.LinkByName(ifName)
+	if err != nil {
+		return fmt.Errorf("LinkByName(%s): %v", ifName, err)
+	}
+	m, err := h.nlh.LinkByName(master)
+	if err != nil {
+		return fmt.Errorf("LinkByName(%s): %v", master, err)
+	}
+	if l.Attrs().MasterIndex == m.Attrs().Index {
+		return nil
+	}
+	if err := h.nlh.LinkSetMaster(l, m); err != nil {
+		return fmt.Errorf("LinkSetMaster(%s, %s): %v", ifName, master, err)
+	}
+	return nil
+}
+
+// ensureIf binds `ifName' to `master', assigns `addrs' to it and
+// brings it up
+func (h *Handle) ensureIf(ifName, master string, addrs []string) error {
+	if err := h.ensureMaster(ifName, master); err != nil {
+		return err
+	}
+	if err := h.ensureAddrs(ifName, addrs); err != nil {
+		return err
+	}
+	return h.IfUpByName(ifName)
+}
+
+// route returns Route described in `rs'
+func (h *Handle) route(rs *RouteSpec) (*Route, error) {
+	_, dst, err := net.ParseCIDR(rs.Dst)
+	if err != nil {
+		return nil, err
+	}
+	r := &Route{Dst: dst}
+	if len(rs.Via) > 0 {
+		var nh IPs
+		for _, s := range rs.Via {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid next-hop %s", s)
+			}
+			nh = append(nh, ip)
+		}
+		if len(nh) == 1 {
+			r.Gw = nh[0]
+		} else if *r, err = NewRoute(dst, nh); err != nil {
+			return nil, err
+		}
+	}
+	if rs.Dev != "" {
+		index, err := h.IfIndex(rs.Dev)
+		if err != nil {
+			return nil, err
+		}
+		r.LinkIndex = index
+		if len(rs.Via) == 0 {
+			r.Scope = SCOPE_LINK
+		}
+	}
+	if r.Gw == nil && r.MultiPath == nil && r.LinkIndex == 0 {
+		return nil, fmt.Errorf("either via or dev is required")
+	}
+	return r, nil
+}
+
+// Apply converges the system to Topology `t'. The objects that
+// already exist are left as they are except that VRFs whose table IDs
+// differ are recreated. The interface masters, addresses and routes
+// are added unless present. Apply can be called repeatedly.
+// return: nil if success
+//         non-nil otherwise
+func (t *Topology) Apply() error {
+	hs := make(topoHandles)
+	defer hs.close()
+
+	for _, ns := range t.Namespaces {
+		if ok, _ := NetnsExists(ns); !ok {
+			if err := NetnsAdd(ns); err != nil {
+				return fmt.Errorf("Apply(): %v", err)
+			}
+		}
+	}
+	for _, b := range t.Bridges {
+		if err := t.applyBridge(hs, &b); err != nil {
+			return fmt.Errorf("Apply(): bridge %s: %v", b.Name, err)
+		}
+	}
+	for _, v := range t.Vrfs {
+		if err := t.applyVrf(hs, &v); err != nil {
+			return fmt.Errorf("Apply(): VRF %s: %v", v.Name, err)
+		}
+	}
+	for _, v := range t.Veths {
+		if err := t.applyVeth(hs, &v); err != nil {
+			return fmt.Errorf("Apply(): veth %s: %v", v.Name, err)
+		}
+	}
+	for _, v := range t.Vlans {
+		if err := t.applyVlan(hs, &v); err != nil {
+			return fmt.Errorf("Apply(): VLAN %s: %v", v.Name(), err)
+		}
+	}
+	for _, r := range t.Routes {
+		if err := t.applyRoute(hs, &r); err != nil {
+			return fmt.Errorf("Apply(): route %s: %v", r.Dst, err)
+		}
+	}
+	return nil
+}
+
+func (t *Topology) applyBridge(hs topoHandles, b *BridgeSpec) error {
+	h, err := hs.get(b.Netns)
+	if err != nil {
+		return err
+	}
+	if ok, _ := h.BridgeIfExists(b.Name); !ok {
+		if _, err := h.BridgeAdd(b.Name, nil, Up); err != nil {
+			return err
+		}
+	}
+	return h.ensureIf(b.Name, "", b.Addresses)
+}
+
+func (t *Topology) applyVrf(hs topoHandles, v *VrfSpec) error {
+	h, err := hs.get(v.Netns)
+	if err != nil {
+		return err
+	}
+	if vrf, err := h.VrfGetByName(v.Name); err == nil {
+		if vrf.Tid() == v.Table {
+			return h.ensureIf(v.Name, "", v.Addresses)
+		}
+		if err := h.VrfDelete(v.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := h.VrfAdd(v.Name, v.Table, Up); err != nil {
+		return err
+	}
+	return h.ensureIf(v.Name, "", v.Addresses)
+}
+
+func (t *Topology) applyVeth(hs topoHandles, v *VethSpec) error {
+	h, err := hs.get(v.Netns)
+	if err != nil {
+		return err
+	}
+	peer, err := hs.get(v.Peer.Netns)
+	if err != nil {
+		return err
+	}
+	if ok, _ := h.VethIfExists(v.Name); !ok {
+		if err := v.create(hs); err != nil {
+			return err
+		}
+	}
+	if err := h.ensureIf(v.Name, v.Master, v.Addresses); err != nil {
+		return err
+	}
+	return peer.ensureIf(v.Peer.Name, v.Peer.Master, v.Peer.Addresses)
+}
+
+// create creates the veth pair with its ends in their network
+// namespaces. Nothing is left behind if it fails.
+func (v *VethSpec) create(hs topoHandles) error {
+	h, err := hs.get(v.Netns)
+	if err != nil {
+		return err
+	}
+	peer := &VethOptions{Name: v.Peer.Name}
+	switch {
+	case v.Peer.Netns == v.Netns:
+	case v.Peer.Netns != "":
+		peer.Netns = v.Peer.Netns
+	default:
+		//
+		// namespace of the calling thread
+		//
+		ns, err := netns.Get()
+		if err != nil {
+			return err
+		}
+		defer ns.Close()
+		fd := int(ns)
+		peer.NetnsFd = &fd
+	}
+	_, err = h.VethAddWithOptions(&VethOptions{Name: v.Name}, peer)
+	return err
+}
+
+func (t *Topology) applyVlan(hs topoHandles, v *VlanSpec) error {
+	h, err := hs.get(v.Netns)
+	if err != nil {
+		return err
+	}
+	if ok, _ := h.IfExists(v.Name()); !ok {
+		if _, err := h.VlanAdd(v.Parent, v.Id); err != nil {
+			return err
+		}
+	}
+	return h.ensureIf(v.Name(), v.Master, v.Addresses)
+}
+
+func (t *Topology) applyRoute(hs topoHandles, rs *RouteSpec) error {
+	h, err := hs.get(rs.Netns)
+	if err != nil {
+		return err
+	}
+	r, err := h.route(rs)
+	if err != nil {
+		return err
+	}
+	if rs.Vrf != "" {
+		return h.VrfReplaceRouteByName(rs.Vrf, r)
+	}
+	return h.ReplaceRoute(r)
+}
+
+// Destroy deletes the objects in Topology `t' in the reverse order of
+// Apply(). The objects that do not exist are ignored.
+// return: nil if success
+//         non-nil otherwise (the first error; Destroy goes on)
+func (t *Topology) Destroy() error {
+	var first error
+
+	hs := make(topoHandles)
+	defer hs.close()
+	check := func(what string, err error) {
+		if err != nil && !isGone(err) && first == nil {
+			first = fmt.Errorf("Destroy(): %s: %v", what, err)
+		}
+	}
+	for i := len(t.Routes) - 1; i >= 0; i-- {
+		rs := &t.Routes[i]
+		check("route "+rs.Dst, t.destroyRoute(hs, rs))
+	}
+	for i := len(t.Vlans) - 1; i >= 0; i-- {
+		v := &t.Vlans[i]
+		check("VLAN "+v.Name(), t.destroyLink(hs, v.Netns, v.Name(), "vlan"))
+	}
+	for i := len(t.Veths) - 1; i >= 0; i-- {
+		v := &t.Veths[i]
+		err := t.destroyLink(hs, v.Netns, v.Name, "veth")
+		if isGone(err) {
+			err = t.destroyLink(hs, v.Peer.Netns, v.Peer.Name, "veth")
+		}
+		check("veth "+v.Name, err)
+	}
+	for i := len(t.Vrfs) - 1; i >= 0; i-- {
+		v := &t.Vrfs[i]
+		check("VRF "+v.Name, t.destroyLink(hs, v.Netns, v.Name, "vrf"))
+	}
+	for i := len(t.Bridges) - 1; i >= 0; i-- {
+		b := &t.Bridges[i]
+		check("bridge "+b.Name, t.destroyLink(hs, b.Netns, b.Name, "bridge"))
+	}
+	hs.close()
+	for k := range hs {
+		delete(hs, k)
+	}
+	for i := len(t.Namespaces) - 1; i >= 0; i-- {
+		ns := t.Namespaces[i]
+		if ok, _ := NetnsExists(ns); ok {
+			check("netns "+ns, NetnsDelete(ns))
+		}
+	}
+	return first
+}
+
+// destroyLink deletes link `ifName' in network namespace `nsName'
+// if it is of kind `kind'
+func (t *Topology) destroyLink(hs topoHandles, nsName, ifName,
+	kind string) error {
+	h, err := hs.get(nsName)
+	if err != nil {
+		return err
+	}
+	l, err := h.nlh.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	if l.Type() != kind {
+		return fmt.Errorf("%s is %s, not %s", ifName, l.Type(), kind)
+	}
+	return h.nlh.LinkDel(l)
+}
+
+func (t *Topology) destroyRoute(hs topoHandles, rs *RouteSpec) error {
+	h, err := hs.get(rs.Netns)
+	if err != nil {
+		return err
+	}
+	r, err := h.route(rs)
+	if err != nil {
+		return err
+	}
+	if rs.Vrf != "" {
+		return h.VrfDeleteRouteByName(rs.Vrf, r)
+	}
+	return h.DeleteRoute(r)
+}
@@ -0,0 +1,620 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"net"
+	"syscall"
+)
+
+//
+// linux/if_tunnel.h
+//
+const (
+	greErspanIndex       = 21         // IFLA_GRE_ERSPAN_INDEX
+	greErspanVer         = 22         // IFLA_GRE_ERSPAN_VER
+	greErspanDir         = 23         // IFLA_GRE_ERSPAN_DIR
+	greErspanHwid        = 24         // IFLA_GRE_ERSPAN_HWID
+	ip6TnlFIgnEncapLimit = 0x1        // IP6_TNL_F_IGN_ENCAP_LIMIT
+	ip6FlowlabelMask     = 0x000fffff // IPV6_FLOWLABEL_MASK
+)
+
+// tunnelKinds are the kinds of the tunnel interfaces
+var tunnelKinds = map[string]bool{
+	"tun":       true,
+	"gre":       true,
+	"gretap":    true,
+	"ip6gre":    true,
+	"ip6gretap": true,
+	"erspan":    true,
+	"ip6erspan": true,
+	"ipip":      true,
+	"sit":       true,
+	"ip6tnl":    true,
+	"vti":       true,
+	"vti6":      true,
+	"vxlan":     true,
+	"geneve":    true,
+	"bareudp":   true,
+	"gtp":       true,
+	"wireguard": true,
+	"xfrm":      true,
+}
+
+// greKinds and iptunKinds are the kinds created by TunnelAdd().
+// The value is true if the underlay is IPv6.
+var (
+	greKinds = map[string]bool{
+		"gre":       false,
+		"gretap":    false,
+		"erspan":    false,
+		"ip6gre":    true,
+		"ip6gretap": true,
+		"ip6erspan": true,
+	}
+	iptunKinds = map[string]bool{
+		"ipip":   false,
+		"sit":    false,
+		"ip6tnl": true,
+	}
+)
+
+// ip6tnlModes are the modes of IP6TNL (the inner protocols)
+var ip6tnlModes = map[string]uint8{
+	"any":    0,
+	"ipip6":  unix.IPPROTO_IPIP,
+	"ip6ip6": unix.IPPROTO_IPV6,
+}
+
+// Tunnel is a GRE, GRETAP, IP6GRE, IP6GRETAP, ERSPAN, IPIP, SIT or
+// IP6TNL tunnel interface
+type Tunnel struct {
+	Link netlink.Link
+	kind string
+	h    *Handle
+}
+
+// TunnelOptions holds the attributes of a tunnel interface
+type TunnelOptions struct {
+	Local        net.IP     // local endpoint
+	Remote       net.IP     // remote endpoint. nil for any
+	Dev          string     // underlay device
+	IKey         uint32     // input key. 0 for none (ERSPAN: session ID)
+	OKey         uint32     // output key. 0 for none (ERSPAN: session ID)
+	Ttl          uint8      // TTL (IPv6: hop limit). 0 for inherit
+	Tos          uint8      // TOS (IPv6: traffic class)
+	NoPmtuDisc   bool       // disable path MTU discovery (IPv4 only)
+	EncapLimit   uint8      // encapsulation limit (IPv6 only). 0 for default
+	NoEncapLimit bool       // no encapsulation limit option (IPv6 only)
+	ErspanVer    uint8      // ERSPAN version: 1 or 2. 0 for 1
+	ErspanIndex  uint32     // ERSPAN v1 index
+	ErspanDir    uint8      // ERSPAN v2 direction: 0 ingress, 1 egress
+	ErspanHwid   uint16     // ERSPAN v2 hardware ID
+	Mode         string     // IP6TNL: ip6ip6, ipip6, or any. "" for ip6ip6
+	FlowLabel    uint32     // IP6TNL flow label
+	SixrdPrefix  *net.IPNet // SIT 6rd prefix
+	SixrdRelay   *net.IPNet // SIT 6rd relay prefix (IPv4)
+	Vrf          string     // VRF to bind the tunnel interface to
+}
+
+// isTunnelKind returns true if TunnelAdd() creates `kind'
+func isTunnelKind(kind string) bool {
+	_, gre := greKinds[kind]
+	_, iptun := iptunKinds[kind]
+	return gre || iptun
+}
+
+// isErspan returns true if `kind' is ERSPAN
+func isErspan(kind string) bool {
+	return kind == "erspan" || kind == "ip6erspan"
+}
+
+// tunnelAddrAttr returns `ip' as the bytes of the tunnel endpoint
+// attribute of an IPv4 (or IPv6 if `v6' is true) tunnel
+func tunnelAddrAttr(ip net.IP, v6 bool) ([]byte, error) {
+	if v6 {
+		if ip.To4() != nil {
+			return nil, fmt.Errorf("%s: not IPv6", ip)
+		}
+		return []byte(ip.To16()), nil
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("%s: not IPv4", ip)
+	}
+	return []byte(ip4), nil
+}
+
+// be16Attr returns `v' as a big endian u16 attribute value
+func be16Attr(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// be32Attr returns `v' as a big endian u32 attribute value
+func be32Attr(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// addGreOptions adds the IFLA_GRE_* attributes in `opts' to `data'
+func (h *Handle) addGreOptions(data *nl.RtAttr, kind string,
+	opts *TunnelOptions) error {
+	v6 := greKinds[kind]
+
+	if opts.Dev != "" {
+		index, err := h.IfIndex(opts.Dev)
+		if err != nil {
+			return err
+		}
+		data.AddRtAttr(nl.IFLA_GRE_LINK, nl.Uint32Attr(uint32(index)))
+	}
+	for _, a := range []struct {
+		t  int
+		ip net.IP
+	}{
+		{nl.IFLA_GRE_LOCAL, opts.Local},
+		{nl.IFLA_GRE_REMOTE, opts.Remote},
+	} {
+		if a.ip == nil {
+			continue
+		}
+		b, err := tunnelAddrAttr(a.ip, v6)
+		if err != nil {
+			return err
+		}
+		data.AddRtAttr(a.t, b)
+	}
+
+	var iflags, oflags uint16
+	if opts.IKey != 0 {
+		iflags |= nl.GRE_KEY
+		data.AddRtAttr(nl.IFLA_GRE_IKEY, be32Attr(opts.IKey))
+	}
+	if opts.OKey != 0 {
+		oflags |= nl.GRE_KEY
+		data.AddRtAttr(nl.IFLA_GRE_OKEY, be32Attr(opts.OKey))
+	}
+	if isErspan(kind) {
+		//
+		// ERSPAN type II/III: key (session ID) and sequence number
+		//
+		if opts.IKey == 0 && opts.OKey == 0 {
+			return fmt.Errorf("ERSPAN requires a key (session ID)")
+		}
+		iflags |= nl.GRE_KEY | nl.GRE_SEQ
+		oflags |= nl.GRE_KEY | nl.GRE_SEQ
+		ver := opts.ErspanVer
+		if ver == 0 {
+			ver = 1
+		}
+		data.AddRtAttr(greErspanVer, nl.Uint8Attr(ver))
+		switch ver {
+		case 1:
+			data.AddRtAttr(greErspanIndex, nl.Uint32Attr(opts.ErspanIndex))
+		case 2:
+			data.AddRtAttr(greErspanDir, nl.Uint8Attr(opts.ErspanDir))
+			data.AddRtAttr(greErspanHwid, nl.Uint16Attr(opts.ErspanHwid))
+		default:
+			return fmt.Errorf("unknown ERSPAN version: %d", ver)
+		}
+	}
+	data.AddRtAttr(nl.IFLA_GRE_IFLAGS, be16Attr(iflags))
+	data.AddRtAttr(nl.IFLA_GRE_OFLAGS, be16Attr(oflags))
+	data.AddRtAttr(nl.IFLA_GRE_TTL, nl.Uint8Attr(opts.Ttl))
+	data.AddRtAttr(nl.IFLA_GRE_TOS, nl.Uint8Attr(opts.Tos))
+
+	if v6 {
+		if opts.NoEncapLimit {
+			data.AddRtAttr(nl.IFLA_GRE_FLAGS,
+				nl.Uint32Attr(ip6TnlFIgnEncapLimit))
+		} else if opts.EncapLimit != 0 {
+			data.AddRtAttr(nl.IFLA_GRE_ENCAP_LIMIT,
+				nl.Uint8Attr(opts.EncapLimit))
+		}
+	} else {
+		data.AddRtAttr(nl.IFLA_GRE_PMTUDISC, boolAttr(!opts.NoPmtuDisc))
+	}
+	return nil
+}
+
+// parseGreOptions returns TunnelOptions built from the IFLA_GRE_*
+// attributes in `data'
+func (h *Handle) parseGreOptions(data []syscall.NetlinkRouteAttr) *TunnelOptions {
+	native := nl.NativeEndian()
+	opts := &TunnelOptions{}
+	for _, a := range data {
+		switch a.Attr.Type & nl.NLA_TYPE_MASK {
+		case nl.IFLA_GRE_LINK:
+			if index := int(native.Uint32(a.Value[0:4])); index != 0 {
+				opts.Dev, _ = h.IfName(index)
+			}
+		case nl.IFLA_GRE_LOCAL:
+			opts.Local = net.IP(append([]byte{}, a.Value...))
+		case nl.IFLA_GRE_REMOTE:
+			opts.Remote = net.IP(append([]byte{}, a.Value...))
+		case nl.IFLA_GRE_IKEY:
+			opts.IKey = binary.BigEndian.Uint32(a.Value[0:4])
+		case nl.IFLA_GRE_OKEY:
+			opts.OKey = binary.BigEndian.Uint32(a.Value[0:4])
+		case nl.IFLA_GRE_TTL:
+			opts.Ttl = a.Value[0]
+		case nl.IFLA_GRE_TOS:
+			opts.Tos = a.Value[0]
+		case nl.IFLA_GRE_PMTUDISC:
+			opts.NoPmtuDisc = a.Value[0] == 0
+		case nl.IFLA_GRE_ENCAP_LIMIT:
+			opts.EncapLimit = a.Value[0]
+		case nl.IFLA_GRE_FLAGS:
+			flags := native.Uint32(a.Value[0:4])
+			opts.NoEncapLimit = flags&ip6TnlFIgnEncapLimit != 0
+		case greErspanVer:
+			opts.ErspanVer = a.Value[0]
+		case greErspanIndex:
+			opts.ErspanIndex = native.Uint32(a.Value[0:4])
+		case greErspanDir:
+			opts.ErspanDir = a.Value[0]
+		case greErspanHwid:
+			opts.ErspanHwid = native.Uint16(a.Value[0:2])
+		}
+	}
+	if opts.Remote != nil && opts.Remote.IsUnspecified() {
+		opts.Remote = nil
+	}
+	if opts.Local != nil && opts.Local.IsUnspecified() {
+		opts.Local = nil
+	}
+	return opts
+}
+
+// addIptunOptions adds the IFLA_IPTUN_* attributes in `opts' to `data'
+func (h *Handle) addIptunOptions(data *nl.RtAttr, kind string,
+	opts *TunnelOptions) error {
+	v6 := iptunKinds[kind]
+
+	if opts.Dev != "" {
+		index, err := h.IfIndex(opts.Dev)
+		if err != nil {
+			return err
+		}
+		data.AddRtAttr(nl.IFLA_IPTUN_LINK, nl.Uint32Attr(uint32(index)))
+	}
+	for _, a := range []struct {
+		t  int
+		ip net.IP
+	}{
+		{nl.IFLA_IPTUN_LOCAL, opts.Local},
+		{nl.IFLA_IPTUN_REMOTE, opts.Remote},
+	} {
+		if a.ip == nil {
+			continue
+		}
+		b, err := tunnelAddrAttr(a.ip, v6)
+		if err != nil {
+			return err
+		}
+		data.AddRtAttr(a.t, b)
+	}
+	data.AddRtAttr(nl.IFLA_IPTUN_TTL, nl.Uint8Attr(opts.Ttl))
+	data.AddRtAttr(nl.IFLA_IPTUN_TOS, nl.Uint8Attr(opts.Tos))
+
+	if v6 {
+		mode := opts.Mode
+		if mode == "" {
+			mode = "ip6ip6"
+		}
+		proto, ok := ip6tnlModes[mode]
+		if !ok {
+			return fmt.Errorf("unknown mode: %s", mode)
+		}
+		data.AddRtAttr(nl.IFLA_IPTUN_PROTO, nl.Uint8Attr(proto))
+		var flags uint32
+		if opts.NoEncapLimit {
+			flags |= ip6TnlFIgnEncapLimit
+		} else if opts.EncapLimit != 0 {
+			data.AddRtAttr(nl.IFLA_IPTUN_ENCAP_LIMIT,
+				nl.Uint8Attr(opts.EncapLimit))
+		}
+		data.AddRtAttr(nl.IFLA_IPTUN_FLAGS, nl.Uint32Attr(flags))
+		if opts.FlowLabel&^ip6FlowlabelMask != 0 {
+			return fmt.Errorf("invalid flow label: %#x", opts.FlowLabel)
+		}
+		data.AddRtAttr(nl.IFLA_IPTUN_FLOWINFO, be32Attr(opts.FlowLabel))
+		return nil
+	}
+
+	if opts.Mode != "" || opts.FlowLabel != 0 {
+		return fmt.Errorf("mode and flow label are for ip6tnl")
+	}
+	data.AddRtAttr(nl.IFLA_IPTUN_PMTUDISC, boolAttr(!opts.NoPmtuDisc))
+	if opts.SixrdPrefix != nil || opts.SixrdRelay != nil {
+		if kind != "sit" {
+			return fmt.Errorf("6rd is for sit")
+		}
+	}
+	if p := opts.SixrdPrefix; p != nil {
+		if p.IP.To4() != nil {
+			return fmt.Errorf("6rd prefix %s: not IPv6", p)
+		}
+		ones, _ := p.Mask.Size()
+		data.AddRtAttr(nl.IFLA_IPTUN_6RD_PREFIX, []byte(p.IP.To16()))
+		data.AddRtAttr(nl.IFLA_IPTUN_6RD_PREFIXLEN, nl.Uint16Attr(uint16(ones)))
+	}
+	if p := opts.SixrdRelay; p != nil {
+		ip4 := p.IP.To4()
+		if ip4 == nil {
+			return fmt.Errorf("6rd relay prefix %s: not IPv4", p)
+		}
+		ones, _ := p.Mask.Size()
+		data.AddRtAttr(nl.IFLA_IPTUN_6RD_RELAY_PREFIX, []byte(ip4))
+		data.AddRtAttr(nl.IFLA_IPTUN_6RD_RELAY_PREFIXLEN,
+			nl.Uint16Attr(uint16(ones)))
+	}
+	return nil
+}
+
+// parseIptunOptions returns TunnelOptions built from the IFLA_IPTUN_*
+// attributes in `data'
+func (h *Handle) parseIptunOptions(data []syscall.NetlinkRouteAttr) *TunnelOptions {
+	native := nl.NativeEndian()
+	opts := &TunnelOptions{}
+	var (
+		sixrd, relay       net.IP
+		sixrdLen, relayLen int
+	)
+	for _, a := range data {
+		switch a.Attr.Type & nl.NLA_TYPE_MASK {
+		case nl.IFLA_IPTUN_LINK:
+			if index := int(native.Uint32(a.Value[0:4])); index != 0 {
+				opts.Dev, _ = h.IfName(index)
+			}
+		case nl.IFLA_IPTUN_LOCAL:
+			opts.Local = net.IP(append([]byte{}, a.Value...))
+		case nl.IFLA_IPTUN_REMOTE:
+			opts.Remote = net.IP(append([]byte{}, a.Value...))
+		case nl.IFLA_IPTUN_TTL:
+			opts.Ttl = a.Value[0]
+		case nl.IFLA_IPTUN_TOS:
+			opts.Tos = a.Value[0]
+		case nl.IFLA_IPTUN_PMTUDISC:
+			opts.NoPmtuDisc = a.Value[0] == 0
+		case nl.IFLA_IPTUN_ENCAP_LIMIT:
+			opts.EncapLimit = a.Value[0]
+		case nl.IFLA_IPTUN_FLAGS:
+			if len(a.Value) == 4 {
+				flags := native.Uint32(a.Value[0:4])
+				opts.NoEncapLimit = flags&ip6TnlFIgnEncapLimit != 0
+			}
+		case nl.IFLA_IPTUN_FLOWINFO:
+			opts.FlowLabel = binary.BigEndian.Uint32(a.Value[0:4]) &
+				ip6FlowlabelMask
+		case nl.IFLA_IPTUN_PROTO:
+			for mode, proto := range ip6tnlModes {
+				if proto == a.Value[0] {
+					opts.Mode = mode
+				}
+			}
+		case nl.IFLA_IPTUN_6RD_PREFIX:
+			sixrd = net.IP(append([]byte{}, a.Value...))
+		case nl.IFLA_IPTUN_6RD_PREFIXLEN:
+			sixrdLen = int(native.Uint16(a.Value[0:2]))
+		case nl.IFLA_IPTUN_6RD_RELAY_PREFIX:
+			relay = net.IP(append([]byte{}, a.Value...))
+		case nl.IFLA_IPTUN_6RD_RELAY_PREFIXLEN:
+			relayLen = int(native.Uint16(a.Value[0:2]))
+		}
+	}
+	if sixrd != nil && sixrdLen != 0 {
+		opts.SixrdPrefix = &net.IPNet{IP: sixrd,
+			Mask: net.CIDRMask(sixrdLen, 128)}
+	}
+	if relay != nil && relayLen != 0 {
+		opts.SixrdRelay = &net.IPNet{IP: relay,
+			Mask: net.CIDRMask(relayLen, 32)}
+	}
+	if opts.Remote != nil && opts.Remote.IsUnspecified() {
+		opts.Remote = nil
+	}
+	if opts.Local != nil && opts.Local.IsUnspecified() {
+		opts.Local = nil
+	}
+	return opts
+}
+
+// TunnelAdd adds a tunnel interface whose name is `name'
+// (`ip link add <name> type <kind> local <local> remote <remote> ...')
+// in: name Name of the tunnel interface
+//     kind gre, gretap, ip6gre, ip6gretap, erspan, ip6erspan,
+//          ipip, sit, or ip6tnl
+//     opts Pointer to the tunnel attributes. If opts.Vrf is given,
+//          the tunnel interface is bound to the VRF
+//     up Bring up `name' if true
+// return: 1. Pointer to Tunnel if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TunnelAdd(name, kind string, opts *TunnelOptions,
+	up bool) (*Tunnel, error) {
+	return pkgHandle.TunnelAdd(name, kind, opts, up)
+}
+
+// TunnelAdd adds a tunnel interface whose name is `name' to the
+// network namespace of `h'
+func (h *Handle) TunnelAdd(name, kind string, opts *TunnelOptions,
+	up bool) (*Tunnel, error) {
+	banner := fmt.Sprintf("TunnelAdd(%s, %s): ", name, kind)
+
+	if !isTunnelKind(kind) {
+		return nil, fmt.Errorf("%sunknown kind", banner)
+	}
+	if opts == nil {
+		opts = &TunnelOptions{}
+	}
+	req := newLinkRequest(unix.NLM_F_CREATE|unix.NLM_F_EXCL, 0, name)
+	linkInfo, data := newLinkInfo(kind)
+	var err error
+	if _, ok := greKinds[kind]; ok {
+		err = h.addGreOptions(data, kind, opts)
+	} else {
+		err = h.addIptunOptions(data, kind, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return nil, fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	tun, err := h.TunnelGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Vrf != "" {
+		if err := h.VrfBindIf(opts.Vrf, name); err != nil {
+			h.nlh.LinkDel(tun.Link)
+			return nil, fmt.Errorf("%sVrfBindIf(%s): %v", banner, opts.Vrf, err)
+		}
+	}
+	if up {
+		return tun, tun.IfUp()
+	}
+	return tun, nil
+}
+
+// TunnelDelete deletes a tunnel interface whose name is `name'
+// in: name Name of the tunnel interface
+// return: nil if success
+//         non-nil otherwise
+func TunnelDelete(name string) error {
+	return pkgHandle.TunnelDelete(name)
+}
+
+// TunnelDelete deletes a tunnel interface whose name is `name' from
+// the network namespace of `h'
+func (h *Handle) TunnelDelete(name string) error {
+	tun, err := h.TunnelGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(tun.Link); err != nil {
+		return fmt.Errorf("TunnelDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// TunnelGetByName returns a pointer to Tunnel if tunnel interface
+// whose name is `name' exists
+// in: name Name of the tunnel interface
+// return: 1. Pointer to Tunnel if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TunnelGetByName(name string) (*Tunnel, error) {
+	return pkgHandle.TunnelGetByName(name)
+}
+
+// TunnelGetByName returns a pointer to Tunnel if tunnel interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) TunnelGetByName(name string) (*Tunnel, error) {
+	banner := fmt.Sprintf("TunnelGetByName(%s): ", name)
+
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	kind, err := h.linkKind(l.Attrs().Index)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if !isTunnelKind(kind) {
+		return nil, fmt.Errorf("%snot a tunnel", banner)
+	}
+	return &Tunnel{Link: l, kind: kind, h: h}, nil
+}
+
+// TunnelList returns a slice of Tunnel
+// return: 1. Slice of Tunnel if success
+//         2. nil if success
+//            non-nil otherwise
+func TunnelList() ([]Tunnel, error) {
+	return pkgHandle.TunnelList()
+}
+
+// TunnelList returns a slice of Tunnel in the network namespace of `h'
+func (h *Handle) TunnelList() ([]Tunnel, error) {
+	var tuns []Tunnel
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("TunnelList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		kind, err := h.linkKind(l.Attrs().Index)
+		if err != nil {
+			continue // deleted meanwhile
+		}
+		if isTunnelKind(kind) {
+			tuns = append(tuns, Tunnel{Link: l, kind: kind, h: h})
+		}
+	}
+	return tuns, nil
+}
+
+// Name returns the name of this tunnel interface
+func (tun *Tunnel) Name() string {
+	return tun.Link.Attrs().Name
+}
+
+// Kind returns the kind of this tunnel interface (e.g. "gre")
+func (tun *Tunnel) Kind() string {
+	return tun.kind
+}
+
+// IfUp brings up this tunnel interface
+func (tun *Tunnel) IfUp() error {
+	return handleOf(tun.h).nlh.LinkSetUp(tun.Link)
+}
+
+// IfDown brings down this tunnel interface
+func (tun *Tunnel) IfDown() error {
+	return handleOf(tun.h).nlh.LinkSetDown(tun.Link)
+}
+
+// Options returns the current attributes of this tunnel interface.
+// Vrf is not set.
+// return: 1. Pointer to TunnelOptions if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (tun *Tunnel) Options() (*TunnelOptions, error) {
+	h := handleOf(tun.h)
+	data, err := h.linkInfoData(tun.Link.Attrs().Index, false)
+	if err != nil {
+		return nil, fmt.Errorf("Options(%s): %v", tun.Name(), err)
+	}
+	if _, ok := greKinds[tun.kind]; ok {
+		return h.parseGreOptions(data), nil
+	}
+	return h.parseIptunOptions(data), nil
+}
@@ -0,0 +1,416 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+const (
+	tunDev = "/dev/net/tun"
+)
+
+// Tuntap is a TUN or TAP interface. Files are the file descriptors
+// of the queues opened by TunAdd(), TapAdd(), or Open(). The
+// caller must close them (see Close().) A non-persistent interface
+// is deleted when all of them are closed.
+type Tuntap struct {
+	Link  *netlink.Tuntap
+	Files []*os.File
+	h     *Handle
+}
+
+// TuntapOptions holds the attributes of a TUN/TAP interface
+type TuntapOptions struct {
+	Persist    bool    // keep the interface after the queues are closed
+	Owner      *uint32 // owner UID. nil for none
+	Group      *uint32 // owner GID. nil for none
+	MultiQueue bool    // multi-queue interface
+	Queues     int     // number of queues to open. 0 for 1
+	VnetHdr    bool    // prepend struct virtio_net_hdr (IFF_VNET_HDR)
+	PacketInfo bool    // prepend struct tun_pi (no IFF_NO_PI)
+}
+
+// tuntapFlags returns the IFF_* flags of `opts' other than the mode
+func tuntapFlags(opts *TuntapOptions) uint16 {
+	var flags uint16
+	if !opts.PacketInfo {
+		flags |= unix.IFF_NO_PI
+	}
+	if opts.VnetHdr {
+		flags |= unix.IFF_VNET_HDR
+	}
+	if opts.MultiQueue {
+		flags |= unix.IFF_MULTI_QUEUE
+	}
+	return flags
+}
+
+// tunOpen opens a queue of TUN/TAP interface `name' in the network
+// namespace of `h'. The interface is created if it does not exist.
+// in: name Name of the TUN/TAP interface
+//     flags IFF_TUN or IFF_TAP, and IFF_* flags
+// return: 1. File of the queue if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (h *Handle) tunOpen(name string, flags uint16) (*os.File, error) {
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		return nil, err
+	}
+	ifr.SetUint16(flags)
+
+	var fd int
+	err = h.do(func() error {
+		var err error
+		fd, err = unix.Open(tunDev, unix.O_RDWR|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		if err := unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+			unix.Close(fd)
+			return fmt.Errorf("TUNSETIFF: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	//
+	// non-blocking before os.NewFile() so that the file is pollable
+	//
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), tunDev), nil
+}
+
+// tunIoctl issues ioctl `req' with argument `arg' on queue `f'.
+// f.Fd() is not used since it makes `f' blocking.
+func tunIoctl(f *os.File, req uint, arg int) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ierr error
+	if err := conn.Control(func(fd uintptr) {
+		ierr = unix.IoctlSetInt(int(fd), req, arg)
+	}); err != nil {
+		return err
+	}
+	return ierr
+}
+
+// TunAdd adds a TUN interface whose name is `name'
+// (`ip tuntap add <name> mode tun ...')
+// in: name Name of the TUN interface
+//     opts Pointer to the TUN/TAP attributes. nil for the defaults
+//     up Bring up `name' if true
+// return: 1. Pointer to Tuntap if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TunAdd(name string, opts *TuntapOptions, up bool) (*Tuntap, error) {
+	return pkgHandle.TunAdd(name, opts, up)
+}
+
+// TunAdd adds a TUN interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) TunAdd(name string, opts *TuntapOptions,
+	up bool) (*Tuntap, error) {
+	return h.tuntapAdd(fmt.Sprintf("TunAdd(%s): ", name), name,
+		unix.IFF_TUN, opts, up)
+}
+
+// TapAdd adds a TAP interface whose name is `name'
+// (`ip tuntap add <name> mode tap ...')
+// in: name Name of the TAP interface
+//     opts Pointer to the TUN/TAP attributes. nil for the defaults
+//     up Bring up `name' if true
+// return: 1. Pointer to Tuntap if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TapAdd(name string, opts *TuntapOptions, up bool) (*Tuntap, error) {
+	return pkgHandle.TapAdd(name, opts, up)
+}
+
+// TapAdd adds a TAP interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) TapAdd(name string, opts *TuntapOptions,
+	up bool) (*Tuntap, error) {
+	return h.tuntapAdd(fmt.Sprintf("TapAdd(%s): ", name), name,
+		unix.IFF_TAP, opts, up)
+}
+
+func (h *Handle) tuntapAdd(banner, name string, mode uint16,
+	opts *TuntapOptions, up bool) (*Tuntap, error) {
+	if opts == nil {
+		opts = &TuntapOptions{}
+	}
+	queues := opts.Queues
+	if queues == 0 {
+		queues = 1
+	}
+	if queues > 1 && !opts.MultiQueue {
+		return nil, fmt.Errorf("%smultiple queues require multi-queue", banner)
+	}
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	//
+	// IFF_TUN_EXCL: fail if `name' exists
+	//
+	flags := mode | tuntapFlags(opts)
+	for i := 0; i < queues; i++ {
+		excl := uint16(0)
+		if i == 0 {
+			excl = unix.IFF_TUN_EXCL
+		}
+		f, err := h.tunOpen(name, flags|excl)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s%v", banner, err)
+		}
+		files = append(files, f)
+	}
+	for _, ioc := range []struct {
+		name string
+		req  uint
+		arg  *uint32
+	}{
+		{"TUNSETOWNER", unix.TUNSETOWNER, opts.Owner},
+		{"TUNSETGROUP", unix.TUNSETGROUP, opts.Group},
+	} {
+		if ioc.arg == nil {
+			continue
+		}
+		if err := tunIoctl(files[0], ioc.req, int(*ioc.arg)); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s%s: %v", banner, ioc.name, err)
+		}
+	}
+	if opts.Persist {
+		if err := tunIoctl(files[0], unix.TUNSETPERSIST, 1); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%sTUNSETPERSIST: %v", banner, err)
+		}
+	}
+	tap, err := h.TuntapGetByName(name)
+	if err != nil {
+		if opts.Persist {
+			tunIoctl(files[0], unix.TUNSETPERSIST, 0)
+		}
+		closeAll()
+		return nil, err
+	}
+	tap.Files = files
+	if up {
+		return tap, tap.IfUp()
+	}
+	return tap, nil
+}
+
+// TuntapDelete deletes a TUN/TAP interface whose name is `name'.
+// Queues opened by other processes remain until they are closed.
+// in: name Name of the TUN/TAP interface
+// return: nil if success
+//         non-nil otherwise
+func TuntapDelete(name string) error {
+	return pkgHandle.TuntapDelete(name)
+}
+
+// TuntapDelete deletes a TUN/TAP interface whose name is `name' from
+// the network namespace of `h'
+func (h *Handle) TuntapDelete(name string) error {
+	tap, err := h.TuntapGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(tap.Link); err != nil {
+		return fmt.Errorf("TuntapDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// TuntapGetByName returns a pointer to Tuntap if TUN/TAP interface
+// whose name is `name' exists. No queue is opened.
+// in: name Name of the TUN/TAP interface
+// return: 1. Pointer to Tuntap if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func TuntapGetByName(name string) (*Tuntap, error) {
+	return pkgHandle.TuntapGetByName(name)
+}
+
+// TuntapGetByName returns a pointer to Tuntap if TUN/TAP interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) TuntapGetByName(name string) (*Tuntap, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		switch l := l.(type) {
+		case *netlink.Tuntap:
+			return &Tuntap{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("TuntapGetByName(%s): not TUN/TAP", name)
+		}
+	} else {
+		return nil, fmt.Errorf("TuntapGetByName(%s): %v", name, err)
+	}
+}
+
+// TuntapList returns a slice of Tuntap. No queue is opened.
+// return: 1. Slice of Tuntap if success
+//         2. nil if success
+//            non-nil otherwise
+func TuntapList() ([]Tuntap, error) {
+	return pkgHandle.TuntapList()
+}
+
+// TuntapList returns a slice of Tuntap in the network namespace of `h'
+func (h *Handle) TuntapList() ([]Tuntap, error) {
+	var taps []Tuntap
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("TuntapList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Tuntap); ok {
+			taps = append(taps, Tuntap{Link: l, h: h})
+		}
+	}
+	return taps, nil
+}
+
+// Name returns the name of this TUN/TAP interface
+func (tap *Tuntap) Name() string {
+	return tap.Link.Attrs().Name
+}
+
+// IsTap returns true if this interface is TAP, false if TUN
+func (tap *Tuntap) IsTap() bool {
+	return tap.Link.Mode == netlink.TUNTAP_MODE_TAP
+}
+
+// Persist returns true if this interface is persistent
+func (tap *Tuntap) Persist() bool {
+	return !tap.Link.NonPersist
+}
+
+// MultiQueue returns true if this interface is multi-queue
+func (tap *Tuntap) MultiQueue() bool {
+	return tap.Link.Flags&netlink.TUNTAP_MULTI_QUEUE != 0
+}
+
+// u32Data returns the u32 IFLA_TUN_* attribute `t' of this interface.
+// The kernel omits IFLA_TUN_OWNER and IFLA_TUN_GROUP if they are not
+// set, which netlink.Tuntap cannot tell from 0 (root).
+// return: 1. Value of `t'
+//         2. false if `t' is absent
+//         3. nil if success
+//            non-nil otherwise
+func (tap *Tuntap) u32Data(t uint16) (uint32, bool, error) {
+	data, err := handleOf(tap.h).linkInfoData(tap.Link.Attrs().Index, false)
+	if err != nil {
+		return 0, false, err
+	}
+	if a := attrByType(data, t); a != nil {
+		return nl.NativeEndian().Uint32(a.Value), true, nil
+	}
+	return 0, false, nil
+}
+
+// Owner returns the owner UID of this interface
+// return: 1. Owner UID
+//         2. false if no owner
+//         3. nil if success
+//            non-nil otherwise
+func (tap *Tuntap) Owner() (uint32, bool, error) {
+	uid, ok, err := tap.u32Data(nl.IFLA_TUN_OWNER)
+	if err != nil {
+		return 0, false, fmt.Errorf("Owner(%s): %v", tap.Name(), err)
+	}
+	return uid, ok, nil
+}
+
+// Group returns the owner GID of this interface
+// return: 1. Owner GID
+//         2. false if no group
+//         3. nil if success
+//            non-nil otherwise
+func (tap *Tuntap) Group() (uint32, bool, error) {
+	gid, ok, err := tap.u32Data(nl.IFLA_TUN_GROUP)
+	if err != nil {
+		return 0, false, fmt.Errorf("Group(%s): %v", tap.Name(), err)
+	}
+	return gid, ok, nil
+}
+
+// IfUp brings up this TUN/TAP interface
+func (tap *Tuntap) IfUp() error {
+	return handleOf(tap.h).nlh.LinkSetUp(tap.Link)
+}
+
+// IfDown brings down this TUN/TAP interface
+func (tap *Tuntap) IfDown() error {
+	return handleOf(tap.h).nlh.LinkSetDown(tap.Link)
+}
+
+// Open opens a queue of this TUN/TAP interface and appends it to
+// tap.Files. Only one queue can be open unless multi-queue.
+// return: 1. File of the queue if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (tap *Tuntap) Open() (*os.File, error) {
+	flags := tap.Link.Flags &
+		(netlink.TUNTAP_NO_PI | netlink.TUNTAP_VNET_HDR |
+			netlink.TUNTAP_MULTI_QUEUE)
+	f, err := handleOf(tap.h).tunOpen(tap.Name(),
+		uint16(tap.Link.Mode)|uint16(flags))
+	if err != nil {
+		return nil, fmt.Errorf("Open(%s): %v", tap.Name(), err)
+	}
+	tap.Files = append(tap.Files, f)
+	return f, nil
+}
+
+// Close closes the queues in tap.Files. A non-persistent interface is
+// deleted if no other process opens its queues.
+// return: nil if success
+//         non-nil otherwise
+func (tap *Tuntap) Close() error {
+	var err error
+
+	for _, f := range tap.Files {
+		if e := f.Close(); e != nil && err == nil {
+			err = fmt.Errorf("Close(%s): %v", tap.Name(), e)
+		}
+	}
+	tap.Files = nil
+	return err
+}
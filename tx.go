@@ -0,0 +1,332 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"net"
+	"strings"
+)
+
+// Tx is a transaction: a series of changes made through it.
+// Each change is recorded with its inverse. If a change fails, or
+// Rollback() is called, the recorded changes are undone in reverse
+// order. Commit() forgets them.
+//
+//	tx := TxBegin()
+//	defer tx.Rollback() // no-op after Commit()
+//	if _, err := tx.BridgeAdd("br1", nil, Up); err != nil {
+//		return err // rolled back already
+//	}
+//	...
+//	tx.Commit()
+type Tx struct {
+	h    *Handle
+	undo []txUndo
+	done bool
+}
+
+// txUndo is the inverse of a change
+type txUndo struct {
+	desc string
+	f    func() error
+}
+
+// TxBegin starts a transaction
+// return: Pointer to Tx
+func TxBegin() *Tx {
+	return pkgHandle.TxBegin()
+}
+
+// TxBegin starts a transaction in the network namespace of `h'
+func (h *Handle) TxBegin() *Tx {
+	return &Tx{h: h}
+}
+
+// Commit ends this transaction keeping the changes
+func (tx *Tx) Commit() {
+	tx.undo = nil
+	tx.done = true
+}
+
+// Rollback ends this transaction undoing the changes in reverse order.
+// It keeps undoing even if some of them fail. Does nothing if this
+// transaction has ended.
+// return: nil if success
+//         non-nil otherwise
+func (tx *Tx) Rollback() error {
+	var msg []string
+
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i].f(); err != nil && !isGone(err) {
+			msg = append(msg, fmt.Sprintf("undo %s: %v", tx.undo[i].desc, err))
+		}
+	}
+	tx.undo = nil
+	tx.done = true
+	if len(msg) > 0 {
+		return fmt.Errorf("Rollback(): %s", strings.Join(msg, ", "))
+	}
+	return nil
+}
+
+// Do runs `do' in this transaction. `undo' is the inverse of `do'.
+// If `do' fails, this transaction is rolled back.
+// in: desc Description of the change
+//     do Function that makes the change
+//     undo Function that reverts the change
+// return: nil if success
+//         non-nil otherwise
+func (tx *Tx) Do(desc string, do, undo func() error) error {
+	if tx.done {
+		return fmt.Errorf("%s: transaction has ended", desc)
+	}
+	if err := do(); err != nil {
+		return tx.fail(fmt.Errorf("%s: %v", desc, err))
+	}
+	tx.record(desc, undo)
+	return nil
+}
+
+func (tx *Tx) record(desc string, undo func() error) {
+	tx.undo = append(tx.undo, txUndo{desc: desc, f: undo})
+}
+
+// fail rolls back this transaction and returns `err' with
+// the rollback error if any
+func (tx *Tx) fail(err error) error {
+	if rerr := tx.Rollback(); rerr != nil {
+		return fmt.Errorf("%v; %v", err, rerr)
+	}
+	return err
+}
+
+// addObj runs `add' that creates an object. `exists' tells whether
+// the object exists. The object is recorded with `undo' (and deleted
+// on rollback) if `add' created it, even if `add' failed afterwards
+// (e.g. while bringing it up.)
+func (tx *Tx) addObj(desc string, exists func() bool,
+	add, undo func() error) error {
+	if tx.done {
+		return fmt.Errorf("%s: transaction has ended", desc)
+	}
+	existed := exists()
+
+	err := add()
+	if !existed && exists() {
+		tx.record(desc, undo)
+	}
+	if err != nil {
+		return tx.fail(fmt.Errorf("%s: %v", desc, err))
+	}
+	return nil
+}
+
+// addLink runs `add' that creates link `name'. See addObj().
+func (tx *Tx) addLink(desc, name string, add func() error) error {
+	h := tx.h
+	return tx.addObj(desc,
+		func() bool {
+			_, err := h.nlh.LinkByName(name)
+			return err == nil
+		},
+		add,
+		func() error { return h.LinkDel(name) })
+}
+
+// LinkAdd adds link `l' in this transaction
+// in: l Link to be added
+// return: nil if success
+//         non-nil otherwise
+func (tx *Tx) LinkAdd(l netlink.Link) error {
+	name := l.Attrs().Name
+	return tx.addLink(fmt.Sprintf("LinkAdd(%s)", name), name,
+		func() error { return tx.h.nlh.LinkAdd(l) })
+}
+
+// BridgeAdd adds a bridge in this transaction. See BridgeAdd().
+func (tx *Tx) BridgeAdd(name string, opts *BridgeOptions,
+	up bool) (*Bridge, error) {
+	var br *Bridge
+	err := tx.addLink(fmt.Sprintf("BridgeAdd(%s)", name), name,
+		func() error {
+			var err error
+			br, err = tx.h.BridgeAdd(name, opts, up)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+// VrfAdd adds a VRF in this transaction. See VrfAdd().
+func (tx *Tx) VrfAdd(name string, tid uint32, up bool) (*Vrf, error) {
+	var vrf *Vrf
+	err := tx.addLink(fmt.Sprintf("VrfAdd(%s)", name), name,
+		func() error {
+			var err error
+			vrf, err = tx.h.VrfAdd(name, tid, up)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return vrf, nil
+}
+
+// VethAdd adds a veth pair in this transaction. See VethAdd().
+// The pair is deleted if it cannot be brought up.
+func (tx *Tx) VethAdd(name, peer string, up bool) (*Veth, error) {
+	var veth *Veth
+	err := tx.addLink(fmt.Sprintf("VethAdd(%s, %s)", name, peer), name,
+		func() error {
+			var err error
+			veth, err = tx.h.VethAdd(name, peer, up)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return veth, nil
+}
+
+// VlanAdd adds a VLAN interface in this transaction. See VlanAdd().
+func (tx *Tx) VlanAdd(ifName string, vlanId uint16) (*Vlan, error) {
+	var vlan *Vlan
+	name := fmt.Sprintf("%s.%d", ifName, vlanId)
+	err := tx.addLink(fmt.Sprintf("VlanAdd(%s, %d)", ifName, vlanId), name,
+		func() error {
+			var err error
+			vlan, err = tx.h.VlanAdd(ifName, vlanId)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return vlan, nil
+}
+
+// BindIf binds interface `ifName' to `master' (bridge, VRF, ...)
+// in this transaction. On rollback, `ifName' is bound back to its
+// previous master (or unbound.)
+// in: master Name of the master device
+//     ifName Name of the interface to be bound
+// return: nil if success
+//         non-nil otherwise
+func (tx *Tx) BindIf(master, ifName string) error {
+	h := tx.h
+	prev := 0
+	return tx.Do(fmt.Sprintf("BindIf(%s, %s)", master, ifName),
+		func() error {
+			l, err := h.nlh.LinkByName(ifName)
+			if err != nil {
+				return err
+			}
+			m, err := h.nlh.LinkByName(master)
+			if err != nil {
+				return err
+			}
+			prev = l.Attrs().MasterIndex
+			return h.nlh.LinkSetMaster(l, m)
+		},
+		func() error {
+			l, err := h.nlh.LinkByName(ifName)
+			if err != nil {
+				return err
+			}
+			if prev == 0 {
+				return h.nlh.LinkSetNoMaster(l)
+			}
+			return h.nlh.LinkSetMasterByIndex(l, prev)
+		})
+}
+
+// IpAddrAdd adds an IP prefix to interface `name' in this
+// transaction. See IpAddrAdd(). The prefix is deleted on rollback
+// even if `name' cannot be brought up.
+func (tx *Tx) IpAddrAdd(name string, addr *net.IPNet, up bool) error {
+	h := tx.h
+	return tx.addObj(fmt.Sprintf("IpAddrAdd(%s, %s)", name, addr),
+		func() bool {
+			ok, _ := h.IsIfPrefix(name, addr)
+			return ok
+		},
+		func() error { return h.IpAddrAdd(name, addr, up) },
+		func() error { return h.IpAddrDelete(name, addr) })
+}
+
+// AddRoute adds route `r' in this transaction. See AddRoute().
+func (tx *Tx) AddRoute(r *Route) error {
+	h := tx.h
+	return tx.Do(fmt.Sprintf("AddRoute(%s)", r),
+		func() error { return h.AddRoute(r) },
+		func() error {
+			rt := *r
+			return h.DeleteRoute(&rt)
+		})
+}
+
+// VrfAddRouteByName adds route `r' to VRF `name' in this
+// transaction. See VrfAddRouteByName().
+func (tx *Tx) VrfAddRouteByName(name string, r *Route) error {
+	h := tx.h
+	return tx.Do(fmt.Sprintf("VrfAddRouteByName(%s, %s)", name, r),
+		func() error { return h.VrfAddRouteByName(name, r) },
+		func() error {
+			rt := *r
+			return h.nlh.RouteDel(&rt)
+		})
+}
+
+// IfSetNS moves interface `ifName' to network namespace `nsName'
+// in this transaction. On rollback, `ifName' is moved back.
+// in: ifName Name of the interface to be moved
+//     nsName Name of the network namespace
+// return: nil if success
+//         non-nil otherwise
+func (tx *Tx) IfSetNS(ifName, nsName string) error {
+	h := tx.h
+	return tx.Do(fmt.Sprintf("IfSetNS(%s, %s)", ifName, nsName),
+		func() error { return h.IfSetNS(ifName, nsName) },
+		func() error {
+			nh, err := NewHandleByName(nsName)
+			if err != nil {
+				return err
+			}
+			defer nh.Close()
+			l, err := nh.nlh.LinkByName(ifName)
+			if err != nil {
+				return err
+			}
+			fd := h.Fd()
+			if fd < 0 {
+				//
+				// namespace of the calling thread
+				//
+				ns, err := netns.Get()
+				if err != nil {
+					return err
+				}
+				defer ns.Close()
+				fd = int(ns)
+			}
+			return nh.nlh.LinkSetNsFd(l, fd)
+		})
+}
@@ -19,12 +19,27 @@ package iproute
 import (
 	"fmt"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 	"net"
 )
 
 type Veth struct {
 	Link netlink.Link
 	Peer netlink.Link
+	h    *Handle
+}
+
+// vethPeerIndex returns ifindex of the peer of veth `l'.
+// The ethtool ioctl used by netlink.VethPeerIndex() acts on the
+// namespace of the calling thread. Run it in the namespace of `h'.
+func (h *Handle) vethPeerIndex(l *netlink.Veth) (int, error) {
+	var idx int
+	err := h.do(func() error {
+		var err error
+		idx, err = netlink.VethPeerIndex(l)
+		return err
+	})
+	return idx, err
 }
 
 // VethGetLinkByName returns a pointer to netlink.Veth whose name is `name'
@@ -34,7 +49,13 @@ type Veth struct {
 //         2. nil if there is a veth interface whose name is `name'
 //            non-nil otherwise
 func VethGetLinkByName(name string) (*netlink.Veth, error) {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.VethGetLinkByName(name)
+}
+
+// VethGetLinkByName returns a pointer to netlink.Veth whose name is `name'
+// in the network namespace of `h'
+func (h *Handle) VethGetLinkByName(name string) (*netlink.Veth, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		switch l := l.(type) {
 		case *netlink.Veth:
 			return l, nil
@@ -54,11 +75,18 @@ func VethGetLinkByName(name string) (*netlink.Veth, error) {
 //         2. nil if there is the peer of veth interface whose name is `name'
 //            non-nil otherwise
 func VethGetPeerLinkByName(name string) (*netlink.Veth, error) {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.VethGetPeerLinkByName(name)
+}
+
+// VethGetPeerLinkByName returns a pointer to netlink.Veth that is
+// the peer of veth interface whose name is `name' in the network
+// namespace of `h'
+func (h *Handle) VethGetPeerLinkByName(name string) (*netlink.Veth, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		switch l := l.(type) {
 		case *netlink.Veth:
-			if idx, err := netlink.VethPeerIndex(l); err == nil {
-				if l, err := netlink.LinkByIndex(idx); err == nil {
+			if idx, err := h.vethPeerIndex(l); err == nil {
+				if l, err := h.nlh.LinkByIndex(idx); err == nil {
 					return l.(*netlink.Veth), nil
 				} else {
 					return nil, fmt.Errorf("LinkByIndex(%s): %v", name, err)
@@ -83,14 +111,20 @@ func VethGetPeerLinkByName(name string) (*netlink.Veth, error) {
 //         2. nil if there is a veth interface whose name is `name'
 //            non-nil otherwise
 func VethGetByName(name string) (*Veth, error) {
-	var veth Veth
+	return pkgHandle.VethGetByName(name)
+}
 
-	if l, err := VethGetLinkByName(name); err == nil {
+// VethGetByName returns a pointer to Veth whose name is `name'
+// in the network namespace of `h'
+func (h *Handle) VethGetByName(name string) (*Veth, error) {
+	veth := Veth{h: h}
+
+	if l, err := h.VethGetLinkByName(name); err == nil {
 		veth.Link = l
 	} else {
 		return nil, fmt.Errorf("VethGetLinkByName(%s) %v", name, err)
 	}
-	if l, err := VethGetPeerLinkByName(name); err == nil {
+	if l, err := h.VethGetPeerLinkByName(name); err == nil {
 		veth.Peer = l
 		return &veth, nil
 	} else if IsNotFound(err) {
@@ -112,10 +146,14 @@ func VethGetByName(name string) (*Veth, error) {
 //        2. nil if success
 //           non-nil otherwise
 func VethAdd(name, peer string, up bool) (*Veth, error) {
-	var (
-		veth Veth
-		msg  string
-	)
+	return pkgHandle.VethAdd(name, peer, up)
+}
+
+// VethAdd adds a veth pair to the network namespace of `h'
+func (h *Handle) VethAdd(name, peer string, up bool) (*Veth, error) {
+	var msg string
+
+	veth := Veth{h: h}
 	l := &netlink.Veth{
 		LinkAttrs: netlink.LinkAttrs{
 			Name:        name,
@@ -126,35 +164,217 @@ func VethAdd(name, peer string, up bool) (*Veth, error) {
 		},
 		PeerName: peer,
 	}
-	err := netlink.LinkAdd(l)
+	err := h.nlh.LinkAdd(l)
 	if err != nil {
 		return nil, err
 	}
-	if l, err := VethGetLinkByName(name); err == nil {
+	if l, err := h.VethGetLinkByName(name); err == nil {
 		veth.Link = l
 	} else {
 		return nil, fmt.Errorf("VethGetLinkByName(%s): %v", name, err)
 	}
-	if l, err := VethGetPeerLinkByName(name); err == nil {
+	if l, err := h.VethGetPeerLinkByName(name); err == nil {
 		veth.Peer = l
 	} else {
 		return nil, fmt.Errorf("VethGetPeerLinkByName(%s): %v", name, err)
 	}
 	if up {
-		if err := netlink.LinkSetUp(veth.Link); err != nil {
+		if err := h.nlh.LinkSetUp(veth.Link); err != nil {
 			msg = fmt.Sprintf("LinkSetUp(%s): %v", veth.Name(), err)
 		}
-		if err := netlink.LinkSetUp(veth.Peer); err != nil {
+		if err := h.nlh.LinkSetUp(veth.Peer); err != nil {
 			if msg != "" {
 				msg += ", "
 			}
-			msg = fmt.Sprintf("LinkSetUp(%s): %v", veth.PeerName(), err)
+			msg += fmt.Sprintf("LinkSetUp(%s): %v", veth.PeerName(), err)
 		}
 	}
 	if msg == "" {
 		return &veth, nil
 	}
-	return &veth, fmt.Errorf(msg)
+	return &veth, fmt.Errorf("%s", msg)
+}
+
+// VethOptions holds the attributes of an end of a veth pair.
+// The zero values are the defaults of VethAdd().
+type VethOptions struct {
+	Name     string
+	MTU      int              // 0 for DefaultMTU
+	MAC      net.HardwareAddr // nil for random
+	TxQlen   int              // 0 for DefaultTxQlen
+	TxQueues int              // 0 for DefaultTxQueues
+	RxQueues int              // 0 for DefaultRxQueues
+	Alias    string           // "" for none
+	Netns    string           // name of the network namespace (peer only)
+	NetnsPid int              // process ID of the namespace (peer only)
+	NetnsFd  *int             // fd of the namespace. nil for none (peer only)
+	Master   string           // bridge or VRF in the namespace of the end
+	Addrs    []*net.IPNet     // IP prefixes to be added
+	Up       bool             // bring up the end if true
+}
+
+// defaults returns the MTU, txqlen, and the numbers of the transmit
+// and receive queues of `e' with the defaults filled in
+func (e *VethOptions) defaults() (mtu, txqlen, txqs, rxqs int) {
+	mtu, txqlen, txqs, rxqs = e.MTU, e.TxQlen, e.TxQueues, e.RxQueues
+	if mtu == 0 {
+		mtu = DefaultMTU
+	}
+	if txqlen == 0 {
+		txqlen = DefaultTxQlen
+	}
+	if txqs == 0 {
+		txqs = DefaultTxQueues
+	}
+	if rxqs == 0 {
+		rxqs = DefaultRxQueues
+	}
+	return
+}
+
+// inNetns returns true if `e' is placed in a network namespace
+func (e *VethOptions) inNetns() bool {
+	return e.Netns != "" || e.NetnsPid != 0 || e.NetnsFd != nil
+}
+
+// handle returns a Handle bound to the network namespace of `e'.
+// Returns `h' if `e' is not placed in a network namespace.
+// The caller must close the returned handle unless it is `h'.
+func (e *VethOptions) handle(h *Handle) (*Handle, error) {
+	switch {
+	case e.Netns != "":
+		return NewHandleByName(e.Netns)
+	case e.NetnsPid != 0:
+		return NewHandleByPid(e.NetnsPid)
+	case e.NetnsFd != nil:
+		return NewHandleByFd(*e.NetnsFd)
+	}
+	return h, nil
+}
+
+// setup sets the alias, the master, the IP prefixes, and the state of
+// end `e' in the network namespace of `h'
+func (e *VethOptions) setup(h *Handle) error {
+	l, err := h.nlh.LinkByName(e.Name)
+	if err != nil {
+		return err
+	}
+	if e.Alias != "" {
+		if err := h.nlh.LinkSetAlias(l, e.Alias); err != nil {
+			return fmt.Errorf("LinkSetAlias(%s): %v", e.Name, err)
+		}
+	}
+	if e.Master != "" {
+		m, err := h.nlh.LinkByName(e.Master)
+		if err != nil {
+			return fmt.Errorf("master %s: %v", e.Master, err)
+		}
+		if err := h.nlh.LinkSetMaster(l, m); err != nil {
+			return fmt.Errorf("LinkSetMaster(%s, %s): %v", e.Name, e.Master, err)
+		}
+	}
+	for _, addr := range e.Addrs {
+		if err := h.nlh.AddrAdd(l, &netlink.Addr{IPNet: addr}); err != nil {
+			return fmt.Errorf("AddrAdd(%s, %s): %v", e.Name, addr, err)
+		}
+	}
+	if e.Up {
+		if err := h.nlh.LinkSetUp(l); err != nil {
+			return fmt.Errorf("LinkSetUp(%s): %v", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// VethAddWithOptions adds a veth pair whose ends are `self' and
+// `peer'. The peer can be placed in another network namespace.
+// The pair is deleted if any of the attributes cannot be set.
+// in: self Pointer to the attributes of this end. Its network
+//          namespace is the namespace of the Handle (Netns* must
+//          not be set)
+//     peer Pointer to the attributes of the peer
+// return 1. Pointer to Veth if success. `Veth.Peer' is nil if the
+//           peer is placed in another network namespace
+//           nil otherwise
+//        2. nil if success
+//           non-nil otherwise
+func VethAddWithOptions(self, peer *VethOptions) (*Veth, error) {
+	return pkgHandle.VethAddWithOptions(self, peer)
+}
+
+// VethAddWithOptions adds a veth pair to the network namespace of `h'
+func (h *Handle) VethAddWithOptions(self, peer *VethOptions) (*Veth, error) {
+	banner := fmt.Sprintf("VethAddWithOptions(%s, %s): ", self.Name, peer.Name)
+
+	if self.inNetns() {
+		return nil, fmt.Errorf("%snamespace of %s is that of the handle",
+			banner, self.Name)
+	}
+	mtu, txqlen, txqs, rxqs := self.defaults()
+	l := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:         self.Name,
+			HardwareAddr: self.MAC,
+			TxQLen:       txqlen,
+			MTU:          mtu,
+			NumTxQueues:  txqs,
+			NumRxQueues:  rxqs,
+		},
+		PeerName:         peer.Name,
+		PeerHardwareAddr: peer.MAC,
+	}
+	mtu, txqlen, txqs, rxqs = peer.defaults()
+	l.PeerMTU = uint32(mtu)
+	l.PeerTxQLen = txqlen
+	l.PeerNumTxQueues = uint32(txqs)
+	l.PeerNumRxQueues = uint32(rxqs)
+	switch {
+	case peer.Netns != "":
+		ns, err := netns.GetFromPath(netnsPath(peer.Netns))
+		if err != nil {
+			return nil, fmt.Errorf("%snetns %s: %v", banner, peer.Netns, err)
+		}
+		defer ns.Close()
+		l.PeerNamespace = netlink.NsFd(ns)
+	case peer.NetnsPid != 0:
+		l.PeerNamespace = netlink.NsPid(peer.NetnsPid)
+	case peer.NetnsFd != nil:
+		l.PeerNamespace = netlink.NsFd(*peer.NetnsFd)
+	}
+	if err := h.nlh.LinkAdd(l); err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+
+	ph, err := peer.handle(h)
+	if err == nil {
+		if ph != h {
+			defer ph.Close()
+		}
+		err = self.setup(h)
+	}
+	if err == nil {
+		err = peer.setup(ph)
+	}
+	if err != nil {
+		h.LinkDel(self.Name)
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if !peer.inNetns() {
+		veth, err := h.VethGetByName(self.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s%v", banner, err)
+		}
+		return veth, nil
+	}
+	//
+	// ifindex of the peer is that in another namespace.
+	// Do not look it up in the namespace of `h'.
+	//
+	link, err := h.VethGetLinkByName(self.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	return &Veth{Link: link, h: h}, nil
 }
 
 // VethDelete deletes the specified veth pair
@@ -162,7 +382,13 @@ func VethAdd(name, peer string, up bool) (*Veth, error) {
 // return: nil if success
 //         non-nil otherwise
 func VethDelete(name string) error {
-	return LinkDel(name)
+	return pkgHandle.LinkDel(name)
+}
+
+// VethDelete deletes the specified veth pair from the network
+// namespace of `h'
+func (h *Handle) VethDelete(name string) error {
+	return h.LinkDel(name)
 }
 
 // VethIfExists returns true if veth `name' exists.
@@ -173,7 +399,13 @@ func VethDelete(name string) error {
 //         2. nil if success
 //            non-nil otherwise
 func VethIfExists(name string) (bool, error) {
-	return ifExists(name, &netlink.Veth{})
+	return pkgHandle.ifExists(name, &netlink.Veth{})
+}
+
+// VethIfExists returns true if veth `name' exists in the network
+// namespace of `h'
+func (h *Handle) VethIfExists(name string) (bool, error) {
+	return h.ifExists(name, &netlink.Veth{})
 }
 
 // VethPeerIndex returns positive ifindex if veth `name' exists.
@@ -184,7 +416,13 @@ func VethIfExists(name string) (bool, error) {
 //         2. nil if success
 //            non-nil otherwise
 func VethPeerIndex(name string) (int, error) {
-	veth, err := VethGetByName(name)
+	return pkgHandle.VethPeerIndex(name)
+}
+
+// VethPeerIndex returns positive ifindex if veth `name' exists in the
+// network namespace of `h'. It returns -1 otherwise.
+func (h *Handle) VethPeerIndex(name string) (int, error) {
+	veth, err := h.VethGetByName(name)
 	if err != nil {
 		return -1, err
 	}
@@ -199,7 +437,13 @@ func VethPeerIndex(name string) (int, error) {
 //         2. nil if success
 //            non-nil otherwise
 func VethPeerName(name string) (string, error) {
-	veth, err := VethGetByName(name)
+	return pkgHandle.VethPeerName(name)
+}
+
+// VethPeerName returns the peer name of veth `name' if exists in the
+// network namespace of `h'. It returns empty string otherwise.
+func (h *Handle) VethPeerName(name string) (string, error) {
+	veth, err := h.VethGetByName(name)
 	if err != nil {
 		return "", err
 	}
@@ -211,7 +455,7 @@ func VethPeerName(name string) (string, error) {
 // return nil if success
 //        non-nil otherwise
 func (v *Veth) SetNS(nsName string, up bool) error {
-	return IfSetNS(v.Name(), nsName)
+	return handleOf(v.h).IfSetNS(v.Name(), nsName)
 }
 
 // SetNSbyPid bind veth `v' to network namespace whose process ID is `pid'
@@ -219,7 +463,7 @@ func (v *Veth) SetNS(nsName string, up bool) error {
 // return nil if success
 //        non-nil otherwise
 func (v *Veth) SetNSbyPid(pid int) error {
-	return IfSetNSbyPid(v.Name(), pid)
+	return handleOf(v.h).IfSetNSbyPid(v.Name(), pid)
 }
 
 // UnsetNS unbinds veth `v' from network namespace whose
@@ -241,6 +485,7 @@ func (v *Veth) UnsetNS(nsName string) error {
 //         non-nil otherwise
 func (v *Veth) IpAddrAdd(intf bool, addr *net.IPNet, up bool) error {
 	var l netlink.Link
+	h := handleOf(v.h)
 
 	if intf == Self {
 		l = v.Link
@@ -250,11 +495,11 @@ func (v *Veth) IpAddrAdd(intf bool, addr *net.IPNet, up bool) error {
 		fs := "IpAddrAdd(%s): peer belongs to a different namespace"
 		return fmt.Errorf(fs, v.Name())
 	}
-	if err := netlink.AddrAdd(l, &netlink.Addr{IPNet: addr}); err != nil {
+	if err := h.nlh.AddrAdd(l, &netlink.Addr{IPNet: addr}); err != nil {
 		return err
 	}
 	if up {
-		return netlink.LinkSetUp(l)
+		return h.nlh.LinkSetUp(l)
 	}
 	return nil
 }
@@ -270,6 +515,7 @@ func (v *Veth) IpAddrAdd(intf bool, addr *net.IPNet, up bool) error {
 //         non-nil otherwise
 func (v *Veth) IpAddrReplace(intf bool, addr *net.IPNet, up bool) error {
 	var l netlink.Link
+	h := handleOf(v.h)
 
 	if intf == Self {
 		l = v.Link
@@ -279,11 +525,11 @@ func (v *Veth) IpAddrReplace(intf bool, addr *net.IPNet, up bool) error {
 		fs := "IpAddrReplace(%s): peer belongs to a different namespace"
 		return fmt.Errorf(fs, v.Name())
 	}
-	if err := netlink.AddrReplace(l, &netlink.Addr{IPNet: addr}); err != nil {
+	if err := h.nlh.AddrReplace(l, &netlink.Addr{IPNet: addr}); err != nil {
 		return err
 	}
 	if up {
-		return netlink.LinkSetUp(l)
+		return h.nlh.LinkSetUp(l)
 	}
 	return nil
 }
@@ -305,7 +551,7 @@ func (v *Veth) IpAddrDelete(intf bool, addr *net.IPNet) error {
 		fs := "IpAddrDelete(%s): peer belongs to a different namespace"
 		return fmt.Errorf(fs, v.Name())
 	}
-	return netlink.AddrDel(l, &netlink.Addr{IPNet: addr})
+	return handleOf(v.h).nlh.AddrDel(l, &netlink.Addr{IPNet: addr})
 }
 
 // Index returns ifindex of this veth interface
@@ -323,7 +569,7 @@ func (v *Veth) Name() string {
 //         2. nil if success
 //            non-nil otherwise
 func (v *Veth) PeerIndex() (int, error) {
-	return netlink.VethPeerIndex(v.Link.(*netlink.Veth))
+	return handleOf(v.h).vethPeerIndex(v.Link.(*netlink.Veth))
 }
 
 // Name() returns the name of the peer of this veth interface
@@ -378,9 +624,6 @@ func (v *Veth) PeerNtxQs() int {
 
 // NrxQs returns theh number of receive queues of this veth interface
 func (v *Veth) NrxQs() int {
-	if v.Peer == nil {
-		return -1
-	}
 	return v.Link.Attrs().NumRxQueues
 }
 
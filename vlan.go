@@ -23,6 +23,7 @@ import (
 
 type Vlan struct {
 	Link *netlink.Vlan
+	h    *Handle
 }
 
 // VlanAdd adds a VLAN interface to the master interface
@@ -33,20 +34,26 @@ type Vlan struct {
 //         2. nil if success
 //            non-nil otherwise
 func VlanAdd(ifName string, vlanId uint16) (*Vlan, error) {
-	if l, err := netlink.LinkByName(ifName); err == nil {
+	return pkgHandle.VlanAdd(ifName, vlanId)
+}
+
+// VlanAdd adds a VLAN interface to the master interface in the
+// network namespace of `h'
+func (h *Handle) VlanAdd(ifName string, vlanId uint16) (*Vlan, error) {
+	if l, err := h.nlh.LinkByName(ifName); err == nil {
 		ifName := fmt.Sprintf("%s.%d", ifName, vlanId)
-		if err := netlink.LinkAdd(&netlink.Vlan{
-			netlink.LinkAttrs{
+		if err := h.nlh.LinkAdd(&netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{
 				Name:        ifName,
 				ParentIndex: l.Attrs().Index,
 			},
-			int(vlanId)}); err != nil {
+			VlanId: int(vlanId)}); err != nil {
 			return nil, fmt.Errorf("LinkAdd(%s): %v", ifName, err)
 		}
-		if l, err := netlink.LinkByName(ifName); err == nil {
+		if l, err := h.nlh.LinkByName(ifName); err == nil {
 			switch l := l.(type) {
 			case *netlink.Vlan:
-				return &Vlan{Link: l}, nil
+				return &Vlan{Link: l, h: h}, nil
 			default:
 				return nil, fmt.Errorf("VlanAdd(%s): not a VLAN", l.Attrs().Name)
 			}
@@ -63,7 +70,13 @@ func VlanAdd(ifName string, vlanId uint16) (*Vlan, error) {
 // return: nil if success
 //         non-nil otherwise
 func VlanDelete(name string) error {
-	return LinkDel(name)
+	return pkgHandle.LinkDel(name)
+}
+
+// VlanDelete deletes the specified VLAN interface from the network
+// namespace of `h'
+func (h *Handle) VlanDelete(name string) error {
+	return h.LinkDel(name)
 }
 
 func (vlan *Vlan) Name() string {
@@ -73,3 +86,146 @@ func (vlan *Vlan) Name() string {
 func (vlan *Vlan) VlanId() int {
 	return vlan.Link.VlanId
 }
+
+type Ipvlan struct {
+	Link *netlink.IPVlan
+	h    *Handle
+}
+
+var (
+	ipvlanModes = map[string]netlink.IPVlanMode{
+		"l2":  netlink.IPVLAN_MODE_L2,
+		"l3":  netlink.IPVLAN_MODE_L3,
+		"l3s": netlink.IPVLAN_MODE_L3S,
+	}
+	ipvlanFlags = map[string]netlink.IPVlanFlag{
+		"bridge":  netlink.IPVLAN_FLAG_BRIDGE,
+		"private": netlink.IPVLAN_FLAG_PRIVATE,
+		"vepa":    netlink.IPVLAN_FLAG_VEPA,
+	}
+)
+
+// IpvlanAdd adds an IPVLAN interface to the master interface
+// in: ifName Name of the master interface
+//     name Name of the IPVLAN interface
+//     mode l2, l3, or l3s. "" for l3
+//     flag bridge, private, or vepa. "" for bridge
+// return: 1. Pointer to Ipvlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func IpvlanAdd(ifName, name, mode, flag string) (*Ipvlan, error) {
+	return pkgHandle.IpvlanAdd(ifName, name, mode, flag)
+}
+
+// IpvlanAdd adds an IPVLAN interface to the master interface in the
+// network namespace of `h'
+func (h *Handle) IpvlanAdd(ifName, name, mode, flag string) (*Ipvlan, error) {
+	banner := fmt.Sprintf("IpvlanAdd(%s, %s): ", ifName, name)
+
+	m, f := netlink.IPVLAN_MODE_L3, netlink.IPVLAN_FLAG_BRIDGE
+	if mode != "" {
+		var ok bool
+		if m, ok = ipvlanModes[mode]; !ok {
+			return nil, fmt.Errorf("%sunknown mode: %s", banner, mode)
+		}
+	}
+	if flag != "" {
+		var ok bool
+		if f, ok = ipvlanFlags[flag]; !ok {
+			return nil, fmt.Errorf("%sunknown flag: %s", banner, flag)
+		}
+	}
+	l, err := h.nlh.LinkByName(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("%sLinkByName(%s): %v", banner, ifName, err)
+	}
+	if err := h.nlh.LinkAdd(&netlink.IPVlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        name,
+			ParentIndex: l.Attrs().Index,
+		},
+		Mode: m,
+		Flag: f}); err != nil {
+		return nil, fmt.Errorf("%sLinkAdd(): %v", banner, err)
+	}
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		switch l := l.(type) {
+		case *netlink.IPVlan:
+			return &Ipvlan{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("%snot an IPVLAN", banner)
+		}
+	} else {
+		return nil, fmt.Errorf("%sLinkByName(%s): %v", banner, name, err)
+	}
+}
+
+// IpvlanDelete deletes the specified IPVLAN interface
+// in: name Name of the IPVLAN interface to be deleted
+// return: nil if success
+//         non-nil otherwise
+func IpvlanDelete(name string) error {
+	return pkgHandle.IpvlanDelete(name)
+}
+
+// IpvlanDelete deletes the specified IPVLAN interface from the network
+// namespace of `h'
+func (h *Handle) IpvlanDelete(name string) error {
+	return h.LinkDel(name)
+}
+
+// IpvlanList returns the IPVLAN interfaces on the master interface
+// in: ifName Name of the master interface
+// return: 1. Slice of Ipvlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func IpvlanList(ifName string) ([]Ipvlan, error) {
+	return pkgHandle.IpvlanList(ifName)
+}
+
+// IpvlanList returns the IPVLAN interfaces on the master interface
+// in the network namespace of `h'
+func (h *Handle) IpvlanList(ifName string) ([]Ipvlan, error) {
+	var ipvlans []Ipvlan
+
+	parent, err := h.IfIndex(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("IpvlanList(%s): %v", ifName, err)
+	}
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("IpvlanList(%s): LinkList(): %v", ifName, err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.IPVlan); ok && l.ParentIndex == parent {
+			ipvlans = append(ipvlans, Ipvlan{Link: l, h: h})
+		}
+	}
+	return ipvlans, nil
+}
+
+func (ipvlan *Ipvlan) Name() string {
+	return ipvlan.Link.Attrs().Name
+}
+
+// Mode returns the mode of this interface: l2, l3, or l3s
+func (ipvlan *Ipvlan) Mode() string {
+	for s, m := range ipvlanModes {
+		if m == ipvlan.Link.Mode {
+			return s
+		}
+	}
+	return fmt.Sprintf("unknown(%d)", ipvlan.Link.Mode)
+}
+
+// Flag returns the flag of this interface: bridge, private, or vepa
+func (ipvlan *Ipvlan) Flag() string {
+	for s, f := range ipvlanFlags {
+		if f == ipvlan.Link.Flag {
+			return s
+		}
+	}
+	return fmt.Sprintf("unknown(%d)", ipvlan.Link.Flag)
+}
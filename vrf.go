@@ -24,6 +24,7 @@ import (
 
 type Vrf struct {
 	Link *netlink.Vrf
+	h    *Handle
 }
 
 // VrfGetLinkByIndex returns a pointer to Vrf whose ifindex is `idx'
@@ -33,10 +34,16 @@ type Vrf struct {
 //         2. nil if success
 //            non-nil otherwise
 func VrfGetByIndex(idx int) (*Vrf, error) {
-	if l, err := netlink.LinkByIndex(idx); err == nil {
+	return pkgHandle.VrfGetByIndex(idx)
+}
+
+// VrfGetByIndex returns a pointer to Vrf whose ifindex is `idx'
+// in the network namespace of `h'
+func (h *Handle) VrfGetByIndex(idx int) (*Vrf, error) {
+	if l, err := h.nlh.LinkByIndex(idx); err == nil {
 		switch l := l.(type) {
 		case *netlink.Vrf:
-			return &Vrf{Link: l}, nil
+			return &Vrf{Link: l, h: h}, nil
 		default:
 			return nil, fmt.Errorf("VrfGetByIndex(%d): not a VRF", idx)
 		}
@@ -52,10 +59,16 @@ func VrfGetByIndex(idx int) (*Vrf, error) {
 //         2. nil if there is a VRF whose name is `name'
 //            non-nil otherwise
 func VrfGetByName(name string) (*Vrf, error) {
-	if l, err := netlink.LinkByName(name); err == nil {
+	return pkgHandle.VrfGetByName(name)
+}
+
+// VrfGetByName returns a pointer to Vrf whose name is `name'
+// in the network namespace of `h'
+func (h *Handle) VrfGetByName(name string) (*Vrf, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
 		switch l := l.(type) {
 		case *netlink.Vrf:
-			return &Vrf{Link: l}, nil
+			return &Vrf{Link: l, h: h}, nil
 		default:
 			return nil, fmt.Errorf("VrfGetByName(%s): not a VRF", name)
 		}
@@ -70,14 +83,20 @@ func VrfGetByName(name string) (*Vrf, error) {
 // return: nil if success
 //         non-nil otherwise
 func VrfAdd(name string, tid uint32, up bool) (*Vrf, error) {
-	err := netlink.LinkAdd(&netlink.Vrf{
+	return pkgHandle.VrfAdd(name, tid, up)
+}
+
+// VrfAdd adds VRF whose name is `name' and whose table id is `tid'
+// to the network namespace of `h'
+func (h *Handle) VrfAdd(name string, tid uint32, up bool) (*Vrf, error) {
+	err := h.nlh.LinkAdd(&netlink.Vrf{
 		LinkAttrs: netlink.LinkAttrs{Name: name},
 		Table:     uint32(tid),
 	})
 	if err != nil {
 		return nil, err
 	}
-	if vrf, err := VrfGetByName(name); err == nil {
+	if vrf, err := h.VrfGetByName(name); err == nil {
 		if up {
 			vrf.IfUp()
 		}
@@ -92,11 +111,23 @@ func VrfAdd(name string, tid uint32, up bool) (*Vrf, error) {
 // return: nil if success
 //         non-nil otherwise
 func VrfDelete(name string) error {
-	return LinkDel(name)
+	return pkgHandle.LinkDel(name)
+}
+
+// VrfDelete deletes VRF whose name is `name' from the network
+// namespace of `h'
+func (h *Handle) VrfDelete(name string) error {
+	return h.LinkDel(name)
 }
 
 func VrfIfExists(name string) (bool, error) {
-	return ifExists(name, &netlink.Vrf{})
+	return pkgHandle.ifExists(name, &netlink.Vrf{})
+}
+
+// VrfIfExists returns true if VRF `name' exists in the network
+// namespace of `h'
+func (h *Handle) VrfIfExists(name string) (bool, error) {
+	return h.ifExists(name, &netlink.Vrf{})
 }
 
 // VrfBindIf binds an interface to a VRF
@@ -105,7 +136,12 @@ func VrfIfExists(name string) (bool, error) {
 // return: nil if success
 //         non-nil otherwise
 func VrfBindIf(vrfName, ifName string) error {
-	if vrf, err := VrfGetByName(vrfName); err == nil {
+	return pkgHandle.VrfBindIf(vrfName, ifName)
+}
+
+// VrfBindIf binds an interface to a VRF in the network namespace of `h'
+func (h *Handle) VrfBindIf(vrfName, ifName string) error {
+	if vrf, err := h.VrfGetByName(vrfName); err == nil {
 		return vrf.BindIf(ifName)
 	} else {
 		return fmt.Errorf("VrfGetByName(%s): %v", vrfName, err)
@@ -124,12 +160,20 @@ func VrfBindIf(vrfName, ifName string) error {
 //         2. nil if success
 //            non-nil otherwise
 func VrfGetRoutesByTid(tid int, family int, tableType int) (Routes, error) {
+	return pkgHandle.VrfGetRoutesByTid(tid, family, tableType)
+}
+
+// VrfGetRoutesByTid returns a slice of netlink.Route whose
+// table id is `tid', family is `family', and table type is `tableType'
+// in the network namespace of `h'
+func (h *Handle) VrfGetRoutesByTid(tid int, family int,
+	tableType int) (Routes, error) {
 	routeFilter := &netlink.Route{
 		Table: tid,
 		Type:  tableType,
 	}
 	filterMask := RT_FILTER_TABLE | RT_FILTER_TYPE
-	return netlink.RouteListFiltered(family, routeFilter, filterMask)
+	return h.nlh.RouteListFiltered(family, routeFilter, filterMask)
 }
 
 // VrfGetRoutesByName returns a slice of netlink.Route belonging to the VRF
@@ -144,10 +188,17 @@ func VrfGetRoutesByTid(tid int, family int, tableType int) (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func VrfGetRoutesByName(name string, family int, tblType int) (Routes, error) {
-	if vrf, err := VrfGetByName(name); err == nil {
-		return VrfGetRoutesByTid(int(vrf.Tid()), family, tblType)
+	return pkgHandle.VrfGetRoutesByName(name, family, tblType)
+}
+
+// VrfGetRoutesByName returns a slice of netlink.Route belonging to the VRF
+// whose nanme is `name' in the network namespace of `h'
+func (h *Handle) VrfGetRoutesByName(name string, family int,
+	tblType int) (Routes, error) {
+	if vrf, err := h.VrfGetByName(name); err == nil {
+		return h.VrfGetRoutesByTid(int(vrf.Tid()), family, tblType)
 	} else {
-		errMsg := fmt.Sprintf("VrfGetRoutesByName(%s): ", vrf.Name())
+		errMsg := fmt.Sprintf("VrfGetRoutesByName(%s): ", name)
 		return nil, fmt.Errorf(errMsg+"%v", err)
 	}
 }
@@ -160,8 +211,15 @@ func VrfGetRoutesByName(name string, family int, tblType int) (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func VrfGetIPv4routesByName(name string) (Routes, error) {
-	if vrf, err := VrfGetByName(name); err == nil {
-		return VrfGetRoutesByTid(int(vrf.Tid()), nl.FAMILY_V4, RTN_UNICAST)
+	return pkgHandle.VrfGetIPv4routesByName(name)
+}
+
+// VrfGetIPv4routesByName returns a slice of IPv4 netlink.Route
+// belonging to the VRF whose nanme is `name' in the network
+// namespace of `h'
+func (h *Handle) VrfGetIPv4routesByName(name string) (Routes, error) {
+	if vrf, err := h.VrfGetByName(name); err == nil {
+		return h.VrfGetRoutesByTid(int(vrf.Tid()), nl.FAMILY_V4, RTN_UNICAST)
 	} else {
 		return Routes{}, err
 	}
@@ -175,7 +233,14 @@ func VrfGetIPv4routesByName(name string) (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func VrfGetIPv4localRoutes(vrf string) (Routes, error) {
-	return VrfGetRoutesByName(vrf, nl.FAMILY_V4, RTN_LOCAL)
+	return pkgHandle.VrfGetRoutesByName(vrf, nl.FAMILY_V4, RTN_LOCAL)
+}
+
+// VrfGetIPv4localRoutes returns a slice of IPv4 netlink.Route of
+// local routes belonging to the VRF whose nanme is `name' in the
+// network namespace of `h'
+func (h *Handle) VrfGetIPv4localRoutes(vrf string) (Routes, error) {
+	return h.VrfGetRoutesByName(vrf, nl.FAMILY_V4, RTN_LOCAL)
 }
 
 // VrfGetIPv6routesByName returns a slice of IPv6 netlink.Route
@@ -186,8 +251,15 @@ func VrfGetIPv4localRoutes(vrf string) (Routes, error) {
 //         2. nil if success
 //            non-nil otherwise
 func VrfGetIPv6routesByName(name string) (Routes, error) {
-	if vrf, err := VrfGetByName(name); err == nil {
-		return VrfGetRoutesByTid(int(vrf.Tid()), nl.FAMILY_V6, RTN_UNICAST)
+	return pkgHandle.VrfGetIPv6routesByName(name)
+}
+
+// VrfGetIPv6routesByName returns a slice of IPv6 netlink.Route
+// belonging to the VRF whose nanme is `name' in the network
+// namespace of `h'
+func (h *Handle) VrfGetIPv6routesByName(name string) (Routes, error) {
+	if vrf, err := h.VrfGetByName(name); err == nil {
+		return h.VrfGetRoutesByTid(int(vrf.Tid()), nl.FAMILY_V6, RTN_UNICAST)
 	} else {
 		return Routes{}, err
 	}
@@ -199,10 +271,16 @@ func VrfGetIPv6routesByName(name string) (Routes, error) {
 // return: nil if success
 //         non-nil otherwise
 func VrfAddRouteByName(name string, r *Route) error {
+	return pkgHandle.VrfAddRouteByName(name, r)
+}
+
+// VrfAddRouteByName adds a route to a VRF in the network
+// namespace of `h'
+func (h *Handle) VrfAddRouteByName(name string, r *Route) error {
 	errMsg := fmt.Sprintf("VrfAddRouteByName(%s, %v): ", name, r)
-	if vrf, err := VrfGetByName(name); err == nil {
+	if vrf, err := h.VrfGetByName(name); err == nil {
 		r.Table = int(vrf.Tid())
-		return netlink.RouteAdd(r)
+		return h.nlh.RouteAdd(r)
 	} else {
 		return fmt.Errorf(errMsg+"VrfGetByName(): %v", err)
 	}
@@ -214,10 +292,16 @@ func VrfAddRouteByName(name string, r *Route) error {
 // return: nil if success
 //         non-nil otherwise
 func VrfDeleteRouteByName(name string, r *Route) error {
+	return pkgHandle.VrfDeleteRouteByName(name, r)
+}
+
+// VrfDeleteRouteByName deletes a route in a VRF in the network
+// namespace of `h'
+func (h *Handle) VrfDeleteRouteByName(name string, r *Route) error {
 	errMsg := fmt.Sprintf("VrfDeleteRouteByName(%s, %v): ", name, r)
-	if vrf, err := VrfGetByName(name); err == nil {
+	if vrf, err := h.VrfGetByName(name); err == nil {
 		r.Table = int(vrf.Tid())
-		return netlink.RouteDel(r)
+		return h.nlh.RouteDel(r)
 	} else {
 		return fmt.Errorf(errMsg+"VrfGetByName(): %v", err)
 	}
@@ -230,10 +314,16 @@ func VrfDeleteRouteByName(name string, r *Route) error {
 // return: nil if success
 //         non-nil otherwise
 func VrfReplaceRouteByName(name string, r *Route) error {
+	return pkgHandle.VrfReplaceRouteByName(name, r)
+}
+
+// VrfReplaceRouteByName replaces the existing route in a VRF in the
+// network namespace of `h'
+func (h *Handle) VrfReplaceRouteByName(name string, r *Route) error {
 	errMsg := fmt.Sprintf("VrfReplaceRouteByName(%s, %v): ", name, r)
-	if vrf, err := VrfGetByName(name); err == nil {
+	if vrf, err := h.VrfGetByName(name); err == nil {
 		r.Table = int(vrf.Tid())
-		return netlink.RouteReplace(r)
+		return h.nlh.RouteReplace(r)
 	} else {
 		return fmt.Errorf(errMsg+"VrfGetByName(): %v", err)
 	}
@@ -264,11 +354,11 @@ func (vrf *Vrf) Tid() uint32 {
 }
 
 func (vrf *Vrf) IfUp() error {
-	return netlink.LinkSetUp(vrf.Link)
+	return handleOf(vrf.h).nlh.LinkSetUp(vrf.Link)
 }
 
 func (vrf *Vrf) IfDown() error {
-	return netlink.LinkSetDown(vrf.Link)
+	return handleOf(vrf.h).nlh.LinkSetDown(vrf.Link)
 }
 
 // VrfBindIf binds an interface to a VRF
@@ -276,8 +366,9 @@ func (vrf *Vrf) IfDown() error {
 // return: nil if success
 //         non-nil otherwise
 func (vrf *Vrf) BindIf(ifName string) error {
-	if l, err := netlink.LinkByName(ifName); err == nil {
-		return netlink.LinkSetMasterByIndex(l, vrf.Index())
+	h := handleOf(vrf.h)
+	if l, err := h.nlh.LinkByName(ifName); err == nil {
+		return h.nlh.LinkSetMasterByIndex(l, vrf.Index())
 	} else {
 		return fmt.Errorf("LinkByName(%s): %v", ifName, err)
 	}
@@ -0,0 +1,371 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	CgroupV2Dir = "/var/run/cgroup2" // used unless cgroup2 is mounted
+)
+
+// bpfInsn is struct bpf_insn in linux/bpf.h
+type bpfInsn struct {
+	code uint8
+	regs uint8 // dst_reg:4, src_reg:4
+	off  int16
+	imm  int32
+}
+
+// bpfProgLoadAttr is the BPF_PROG_LOAD part of union bpf_attr
+type bpfProgLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	progName           [unix.BPF_OBJ_NAME_LEN]byte
+	progIfindex        uint32
+	expectedAttachType uint32
+}
+
+// bpfProgAttachAttr is the BPF_PROG_ATTACH part of union bpf_attr
+type bpfProgAttachAttr struct {
+	targetFd     uint32
+	attachBpfFd  uint32
+	attachType   uint32
+	attachFlags  uint32
+	replaceBpfFd uint32
+}
+
+// bpfProgQueryAttr is the BPF_PROG_QUERY part of union bpf_attr
+type bpfProgQueryAttr struct {
+	targetFd    uint32
+	attachType  uint32
+	queryFlags  uint32
+	attachFlags uint32
+	progIds     uint64
+	progCnt     uint32
+}
+
+// Control binds the socket `c' to this VRF (SO_BINDTODEVICE).
+// It can be used as net.Dialer.Control or net.ListenConfig.Control.
+func (vrf *Vrf) Control(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptString(int(fd),
+			unix.SOL_SOCKET, unix.SO_BINDTODEVICE, vrf.Name())
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("SO_BINDTODEVICE(%s): %v", vrf.Name(), serr)
+	}
+	return nil
+}
+
+// Dialer returns a net.Dialer whose sockets are bound to this VRF.
+// The sockets are created in the network namespace of the calling
+// thread. Use NetnsDo() to dial in the other namespaces.
+func (vrf *Vrf) Dialer() *net.Dialer {
+	return &net.Dialer{Control: vrf.Control}
+}
+
+// ListenConfig returns a net.ListenConfig whose sockets are bound to
+// this VRF. The sockets are created in the network namespace of the
+// calling thread. Use NetnsDo() to listen in the other namespaces.
+func (vrf *Vrf) ListenConfig() *net.ListenConfig {
+	return &net.ListenConfig{Control: vrf.Control}
+}
+
+// cgroup2Root returns the mount point of cgroup2. cgroup2 is mounted
+// on CgroupV2Dir unless it is mounted.
+func cgroup2Root() (string, error) {
+	fp, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	s := bufio.NewScanner(fp)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) >= 3 && f[2] == "cgroup2" {
+			return f[1], nil
+		}
+	}
+	if err := os.MkdirAll(CgroupV2Dir, 0755); err != nil {
+		return "", err
+	}
+	if err := unix.Mount("none", CgroupV2Dir, "cgroup2", 0, ""); err != nil {
+		return "", fmt.Errorf("mount -t cgroup2 none %s: %v", CgroupV2Dir, err)
+	}
+	return CgroupV2Dir, nil
+}
+
+// bpfLoadVrfProg loads a BPF_PROG_TYPE_CGROUP_SOCK program that binds
+// every socket created to the interface whose ifindex is `ifindex'.
+// This is the program `ip vrf exec' uses.
+// in: ifindex Ifindex of VRF
+// return: 1. File descriptor of the program if success
+//            -1 otherwise
+//         2. nil if success
+//            non-nil otherwise
+func bpfLoadVrfProg(ifindex int) (int, error) {
+	const (
+		r0 = 0
+		r1 = 1
+		r2 = 2
+		r3 = 3
+		r6 = 6
+	)
+	mov64Imm := uint8(unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K)
+	insns := []bpfInsn{
+		// r6 = r1 (struct bpf_sock *)
+		{code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X, regs: r1<<4 | r6},
+		// r3 = ifindex
+		{code: mov64Imm, regs: r3, imm: int32(ifindex)},
+		// r2 = offsetof(struct bpf_sock, bound_dev_if)
+		{code: mov64Imm, regs: r2, imm: 0},
+		// sk->bound_dev_if = r3
+		{code: unix.BPF_STX | unix.BPF_W | unix.BPF_MEM, regs: r3<<4 | r1},
+		// r0 = 1 (verdict)
+		{code: mov64Imm, regs: r0, imm: 1},
+		{code: unix.BPF_JMP | unix.BPF_EXIT},
+	}
+	license := []byte("GPL\x00")
+	attr := bpfProgLoadAttr{
+		progType:           unix.BPF_PROG_TYPE_CGROUP_SOCK,
+		insnCnt:            uint32(len(insns)),
+		insns:              uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:            uint64(uintptr(unsafe.Pointer(&license[0]))),
+		expectedAttachType: unix.BPF_CGROUP_INET_SOCK_CREATE,
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if errno != 0 {
+		return -1, fmt.Errorf("BPF_PROG_LOAD: %v", errno)
+	}
+	return int(fd), nil
+}
+
+// bpfProgAttached returns true if a BPF_CGROUP_INET_SOCK_CREATE
+// program is attached to cgroup `cgfd'
+func bpfProgAttached(cgfd int) (bool, error) {
+	attr := bpfProgQueryAttr{
+		targetFd:   uint32(cgfd),
+		attachType: unix.BPF_CGROUP_INET_SOCK_CREATE,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_QUERY,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	if errno != 0 {
+		return false, fmt.Errorf("BPF_PROG_QUERY: %v", errno)
+	}
+	return attr.progCnt > 0, nil
+}
+
+// nsIno returns the inode number of the network namespace of `h'
+func (h *Handle) nsIno() (uint64, error) {
+	var st unix.Stat_t
+
+	err := h.do(func() error {
+		return unix.Stat("/proc/thread-self/ns/net", &st)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("netns inode: %v", err)
+	}
+	return st.Ino, nil
+}
+
+// cgroup returns a file descriptor of the cgroup for this VRF.
+// The sockets created by the processes in the cgroup are bound to
+// this VRF. The cgroup is <cgroup2>/vrf/<netns inode>/<name>.<ifindex>
+// so that the VRFs of the same name in different network namespaces,
+// or a VRF recreated with another ifindex, never share a cgroup.
+// The caller must close the returned file descriptor.
+// return: 1. File descriptor of the cgroup directory if success
+//            -1 otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (vrf *Vrf) cgroup() (int, error) {
+	root, err := cgroup2Root()
+	if err != nil {
+		return -1, err
+	}
+	ino, err := handleOf(vrf.h).nsIno()
+	if err != nil {
+		return -1, err
+	}
+	dir := filepath.Join(root, "vrf", fmt.Sprintf("%d", ino),
+		fmt.Sprintf("%s.%d", vrf.Name(), vrf.Index()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return -1, err
+	}
+	cgfd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("Open(%s): %v", dir, err)
+	}
+	//
+	// the program attached before binds to the same ifindex
+	//
+	ok, err := bpfProgAttached(cgfd)
+	if err != nil {
+		unix.Close(cgfd)
+		return -1, fmt.Errorf("%s: %v", dir, err)
+	}
+	if ok {
+		return cgfd, nil
+	}
+	progfd, err := bpfLoadVrfProg(vrf.Index())
+	if err != nil {
+		unix.Close(cgfd)
+		return -1, err
+	}
+	defer unix.Close(progfd)
+
+	attr := bpfProgAttachAttr{
+		targetFd:    uint32(cgfd),
+		attachBpfFd: uint32(progfd),
+		attachType:  unix.BPF_CGROUP_INET_SOCK_CREATE,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_ATTACH,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	if errno != 0 {
+		unix.Close(cgfd)
+		return -1, fmt.Errorf("BPF_PROG_ATTACH(%s): %v", dir, errno)
+	}
+	return cgfd, nil
+}
+
+// VrfCgroupCleanup removes the cgroups Vrf.Start() created that
+// no process belongs to. The cgroups are left behind when the
+// commands exit; call it after they exit or the VRFs are deleted.
+// The cgroups in use are kept.
+// return: nil if success
+//         non-nil otherwise
+func VrfCgroupCleanup() error {
+	root, err := cgroup2Root()
+	if err != nil {
+		return fmt.Errorf("VrfCgroupCleanup(): %v", err)
+	}
+	base := filepath.Join(root, "vrf")
+	nsDirs, err := ioutil.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("VrfCgroupCleanup(): %v", err)
+	}
+	for _, nsDir := range nsDirs {
+		if !nsDir.IsDir() {
+			continue
+		}
+		dir := filepath.Join(base, nsDir.Name())
+		cgs, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("VrfCgroupCleanup(): %v", err)
+		}
+		for _, cg := range cgs {
+			if !cg.IsDir() {
+				continue
+			}
+			err := unix.Rmdir(filepath.Join(dir, cg.Name()))
+			if err != nil && err != unix.EBUSY && err != unix.ENOTEMPTY {
+				return fmt.Errorf("VrfCgroupCleanup(): %s: %v",
+					filepath.Join(dir, cg.Name()), err)
+			}
+		}
+		err = unix.Rmdir(dir)
+		if err != nil && err != unix.EBUSY && err != unix.ENOTEMPTY {
+			return fmt.Errorf("VrfCgroupCleanup(): %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// Start starts `cmd' in this VRF in the same way as `ip vrf exec' does.
+// All the sockets the command creates are bound to this VRF.
+// The command runs in the network namespace of this VRF.
+// The cgroup of this VRF remains after `cmd' exits.
+// See VrfCgroupCleanup().
+// in: cmd Command to be started
+// return: nil if success
+//         non-nil otherwise
+func (vrf *Vrf) Start(cmd *exec.Cmd) error {
+	banner := fmt.Sprintf("Start(%s, %s): ", vrf.Name(), cmd.Path)
+	cgfd, err := vrf.cgroup()
+	if err != nil {
+		return fmt.Errorf(banner+"%v", err)
+	}
+	defer unix.Close(cgfd)
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = cgfd
+	//
+	// the child inherits the network namespace of this thread
+	//
+	return handleOf(vrf.h).do(cmd.Start)
+}
+
+// Run starts `cmd' in this VRF and waits for it to complete.
+// in: cmd Command to be run
+// return: nil if success
+//         non-nil otherwise
+func (vrf *Vrf) Run(cmd *exec.Cmd) error {
+	if err := vrf.Start(cmd); err != nil {
+		return err
+	}
+	return cmd.Wait()
+}
+
+// Output runs `cmd' in this VRF and returns its standard output.
+// in: cmd Command to be run
+// return: 1. Standard output of `cmd'
+//         2. nil if success
+//            non-nil otherwise
+func (vrf *Vrf) Output(cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+
+	if cmd.Stdout != nil {
+		return nil, fmt.Errorf("Output(%s): Stdout already set", vrf.Name())
+	}
+	cmd.Stdout = &out
+	err := vrf.Run(cmd)
+	return out.Bytes(), err
+}
@@ -0,0 +1,453 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"net"
+)
+
+const (
+	VxlanPort = 4789 // IANA assigned VXLAN UDP port
+)
+
+//
+// linux/if_link.h
+//
+const (
+	vxlanTtlInherit      = 28 // IFLA_VXLAN_TTL_INHERIT
+	vxlanVniFilter       = 30 // IFLA_VXLAN_VNIFILTER
+	vniFilterEntry       = 1  // VXLAN_VNIFILTER_ENTRY
+	vniFilterEntryStart  = 1  // VXLAN_VNIFILTER_ENTRY_START
+	vniFilterEntryEnd    = 2  // VXLAN_VNIFILTER_ENTRY_END
+	vniFilterEntryGroup  = 3  // VXLAN_VNIFILTER_ENTRY_GROUP
+	vniFilterEntryGroup6 = 4  // VXLAN_VNIFILTER_ENTRY_GROUP6
+	sizeofTunnelMsg      = 8  // sizeof(struct tunnel_msg)
+)
+
+type Vxlan struct {
+	Link *netlink.Vxlan
+	h    *Handle
+}
+
+// VxlanOptions holds the attributes of a VXLAN interface
+type VxlanOptions struct {
+	Vni        uint32 // VXLAN network identifier. Must be 0 if External
+	Local      net.IP // source address of the encapsulated packets
+	Remote     net.IP // unicast remote VTEP. Exclusive with Group
+	Group      net.IP // multicast group. Dev is required
+	Port       uint16 // destination UDP port. 0 for VxlanPort
+	Dev        string // underlay device
+	Learning   *bool  // learn remote MACs. nil: true unless External
+	Ttl        uint8  // TTL of the encapsulated packets. 0 for auto
+	TtlInherit bool   // inherit TTL from the inner packets
+	Tos        uint8  // TOS of the encapsulated packets
+	UdpCsum    bool   // compute UDP checksum (IPv4)
+	External   bool   // external control plane (collect metadata)
+	VniFilter  bool   // per-VNI filtering (External only)
+}
+
+// VxlanVni is an entry of the VNI filter of an external VXLAN
+// interface
+type VxlanVni struct {
+	Vni    uint32
+	VniEnd uint32 // last VNI of the range. 0 if single VNI
+	Group  net.IP // multicast group or remote VTEP. nil if none
+}
+
+// ipAttr returns `ip' as the bytes of an IPv4 or IPv6 attribute
+// return: 1. address bytes
+//         2. true if IPv4
+func ipAttr(ip net.IP) ([]byte, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return []byte(ip4), true
+	}
+	return []byte(ip.To16()), false
+}
+
+// addVxlanOptions adds the IFLA_VXLAN_* attributes in `opts' to
+// `data'
+func (h *Handle) addVxlanOptions(data *nl.RtAttr, opts *VxlanOptions) error {
+	if opts.External {
+		if opts.Vni != 0 {
+			return fmt.Errorf("VNI cannot be specified with external")
+		}
+		// IFLA_VXLAN_COLLECT_METADATA
+		data.AddRtAttr(nl.IFLA_VXLAN_FLOWBASED, boolAttr(true))
+		if opts.VniFilter {
+			data.AddRtAttr(vxlanVniFilter, boolAttr(true))
+		}
+	} else {
+		if opts.VniFilter {
+			return fmt.Errorf("VNI filter requires external")
+		}
+		data.AddRtAttr(nl.IFLA_VXLAN_ID, nl.Uint32Attr(opts.Vni))
+	}
+	if opts.Remote != nil && opts.Group != nil {
+		return fmt.Errorf("remote and group are exclusive")
+	}
+	if opts.Group != nil && opts.Dev == "" {
+		return fmt.Errorf("group requires dev")
+	}
+	if opts.Dev != "" {
+		index, err := h.IfIndex(opts.Dev)
+		if err != nil {
+			return err
+		}
+		data.AddRtAttr(nl.IFLA_VXLAN_LINK, nl.Uint32Attr(uint32(index)))
+	}
+	if opts.Local != nil {
+		if b, v4 := ipAttr(opts.Local); v4 {
+			data.AddRtAttr(nl.IFLA_VXLAN_LOCAL, b)
+		} else {
+			data.AddRtAttr(nl.IFLA_VXLAN_LOCAL6, b)
+		}
+	}
+	for _, dst := range []net.IP{opts.Remote, opts.Group} {
+		if dst == nil {
+			continue
+		}
+		if b, v4 := ipAttr(dst); v4 {
+			data.AddRtAttr(nl.IFLA_VXLAN_GROUP, b)
+		} else {
+			data.AddRtAttr(nl.IFLA_VXLAN_GROUP6, b)
+		}
+	}
+	port := opts.Port
+	if port == 0 {
+		port = VxlanPort
+	}
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, port)
+	data.AddRtAttr(nl.IFLA_VXLAN_PORT, b)
+	learning := !opts.External
+	if opts.Learning != nil {
+		learning = *opts.Learning
+	}
+	data.AddRtAttr(nl.IFLA_VXLAN_LEARNING, boolAttr(learning))
+	if opts.TtlInherit {
+		if opts.Ttl != 0 {
+			return fmt.Errorf("TTL and TTL inherit are exclusive")
+		}
+		data.AddRtAttr(vxlanTtlInherit, []byte{}) // NLA_FLAG
+	} else {
+		data.AddRtAttr(nl.IFLA_VXLAN_TTL, nl.Uint8Attr(opts.Ttl))
+	}
+	data.AddRtAttr(nl.IFLA_VXLAN_TOS, nl.Uint8Attr(opts.Tos))
+	data.AddRtAttr(nl.IFLA_VXLAN_UDP_CSUM, boolAttr(opts.UdpCsum))
+	return nil
+}
+
+// VxlanAdd adds a VXLAN interface whose name is `name'
+// (`ip link add <name> type vxlan id <vni> ...')
+// in: name Name of the VXLAN interface
+//     opts Pointer to the VXLAN attributes
+//     up Bring up `name' if true
+// return: 1. Pointer to Vxlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func VxlanAdd(name string, opts *VxlanOptions, up bool) (*Vxlan, error) {
+	return pkgHandle.VxlanAdd(name, opts, up)
+}
+
+// VxlanAdd adds a VXLAN interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) VxlanAdd(name string, opts *VxlanOptions,
+	up bool) (*Vxlan, error) {
+	banner := fmt.Sprintf("VxlanAdd(%s): ", name)
+
+	if opts == nil {
+		return nil, fmt.Errorf("%sno options", banner)
+	}
+	req := newLinkRequest(unix.NLM_F_CREATE|unix.NLM_F_EXCL, 0, name)
+	linkInfo, data := newLinkInfo("vxlan")
+	if err := h.addVxlanOptions(data, opts); err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return nil, fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	vx, err := h.VxlanGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if up {
+		return vx, vx.IfUp()
+	}
+	return vx, nil
+}
+
+// VxlanDelete deletes a VXLAN interface whose name is `name'
+// in: name Name of the VXLAN interface
+// return: nil if success
+//         non-nil otherwise
+func VxlanDelete(name string) error {
+	return pkgHandle.VxlanDelete(name)
+}
+
+// VxlanDelete deletes a VXLAN interface whose name is `name' from the
+// network namespace of `h'
+func (h *Handle) VxlanDelete(name string) error {
+	vx, err := h.VxlanGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(vx.Link); err != nil {
+		return fmt.Errorf("VxlanDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// VxlanGetByName returns a pointer to Vxlan if VXLAN interface
+// whose name is `name' exists
+// in: name Name of the VXLAN interface
+// return: 1. Pointer to Vxlan if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func VxlanGetByName(name string) (*Vxlan, error) {
+	return pkgHandle.VxlanGetByName(name)
+}
+
+// VxlanGetByName returns a pointer to Vxlan if VXLAN interface
+// whose name is `name' exists in the network namespace of `h'
+func (h *Handle) VxlanGetByName(name string) (*Vxlan, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		switch l := l.(type) {
+		case *netlink.Vxlan:
+			return &Vxlan{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("VxlanGetByName(%s): not VXLAN", name)
+		}
+	} else {
+		return nil, fmt.Errorf("VxlanGetByName(%s): %v", name, err)
+	}
+}
+
+// VxlanList returns a slice of Vxlan
+// return: 1. Slice of Vxlan if success
+//         2. nil if success
+//            non-nil otherwise
+func VxlanList() ([]Vxlan, error) {
+	return pkgHandle.VxlanList()
+}
+
+// VxlanList returns a slice of Vxlan in the network namespace of `h'
+func (h *Handle) VxlanList() ([]Vxlan, error) {
+	var vxs []Vxlan
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("VxlanList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Vxlan); ok {
+			vxs = append(vxs, Vxlan{Link: l, h: h})
+		}
+	}
+	return vxs, nil
+}
+
+// VxlanIfExists returns true if VXLAN interface `name' exists
+// return: 1. true if VXLAN interface `name' exists
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func VxlanIfExists(name string) (bool, error) {
+	return pkgHandle.ifExists(name, &netlink.Vxlan{})
+}
+
+// VxlanIfExists returns true if VXLAN interface `name' exists in the
+// network namespace of `h'
+func (h *Handle) VxlanIfExists(name string) (bool, error) {
+	return h.ifExists(name, &netlink.Vxlan{})
+}
+
+// Name returns the name of this VXLAN interface
+func (vx *Vxlan) Name() string {
+	return vx.Link.Attrs().Name
+}
+
+// Vni returns the VNI of this VXLAN interface. 0 if external
+func (vx *Vxlan) Vni() uint32 {
+	return uint32(vx.Link.VxlanId)
+}
+
+// IfUp brings up this VXLAN interface
+func (vx *Vxlan) IfUp() error {
+	return handleOf(vx.h).nlh.LinkSetUp(vx.Link)
+}
+
+// IfDown brings down this VXLAN interface
+func (vx *Vxlan) IfDown() error {
+	return handleOf(vx.h).nlh.LinkSetDown(vx.Link)
+}
+
+// VniFiltering returns true if VNI filtering is enabled on this
+// VXLAN interface
+// return: 1. true if VNI filtering is enabled
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (vx *Vxlan) VniFiltering() (bool, error) {
+	data, err := handleOf(vx.h).linkInfoData(vx.Link.Attrs().Index, false)
+	if err != nil {
+		return false, fmt.Errorf("VniFiltering(%s): %v", vx.Name(), err)
+	}
+	if a := attrByType(data, vxlanVniFilter); a != nil {
+		return a.Value[0] != 0, nil
+	}
+	return false, nil
+}
+
+// TtlInherit returns true if this VXLAN interface inherits TTL from
+// the inner packets
+// return: 1. true if TTL is inherited
+//            false otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (vx *Vxlan) TtlInherit() (bool, error) {
+	data, err := handleOf(vx.h).linkInfoData(vx.Link.Attrs().Index, false)
+	if err != nil {
+		return false, fmt.Errorf("TtlInherit(%s): %v", vx.Name(), err)
+	}
+	if a := attrByType(data, vxlanTtlInherit); a != nil {
+		return a.Value[0] != 0, nil
+	}
+	return false, nil
+}
+
+// tunnelMsg returns struct tunnel_msg for interface `ifindex'
+func tunnelMsg(ifindex int) []byte {
+	b := make([]byte, sizeofTunnelMsg)
+	b[0] = unix.AF_BRIDGE
+	nl.NativeEndian().PutUint32(b[4:8], uint32(ifindex))
+	return b
+}
+
+// VniAdd adds VNIs `vni'-`vniEnd' to the VNI filter of this VXLAN
+// interface (`bridge vni add dev <name> vni <vni>-<vniEnd> group <group>')
+// in: vni VNI
+//     vniEnd Last VNI of the range. 0 for `vni' only
+//     group Multicast group or remote VTEP. nil for none
+// return: nil if success
+//         non-nil otherwise
+func (vx *Vxlan) VniAdd(vni, vniEnd uint32, group net.IP) error {
+	err := vx.vniModify(unix.RTM_NEWTUNNEL, vni, vniEnd, group)
+	if err != nil {
+		return fmt.Errorf("VniAdd(%s, %d): %v", vx.Name(), vni, err)
+	}
+	return nil
+}
+
+// VniDelete deletes VNIs `vni'-`vniEnd' from the VNI filter of this
+// VXLAN interface
+// in: vni VNI
+//     vniEnd Last VNI of the range. 0 for `vni' only
+// return: nil if success
+//         non-nil otherwise
+func (vx *Vxlan) VniDelete(vni, vniEnd uint32) error {
+	err := vx.vniModify(unix.RTM_DELTUNNEL, vni, vniEnd, nil)
+	if err != nil {
+		return fmt.Errorf("VniDelete(%s, %d): %v", vx.Name(), vni, err)
+	}
+	return nil
+}
+
+func (vx *Vxlan) vniModify(cmd int, vni, vniEnd uint32, group net.IP) error {
+	req := nl.NewNetlinkRequest(cmd, unix.NLM_F_ACK)
+	req.AddData(rawData(tunnelMsg(vx.Link.Attrs().Index)))
+	entry := nl.NewRtAttr(vniFilterEntry|unix.NLA_F_NESTED, nil)
+	entry.AddRtAttr(vniFilterEntryStart, nl.Uint32Attr(vni))
+	if vniEnd != 0 {
+		entry.AddRtAttr(vniFilterEntryEnd, nl.Uint32Attr(vniEnd))
+	}
+	if group != nil {
+		if b, v4 := ipAttr(group); v4 {
+			entry.AddRtAttr(vniFilterEntryGroup, b)
+		} else {
+			entry.AddRtAttr(vniFilterEntryGroup6, b)
+		}
+	}
+	req.AddData(entry)
+	_, err := handleOf(vx.h).execute(req, unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+// VniList returns the VNI filter of this VXLAN interface
+// (`bridge vni show dev <name>')
+// return: 1. Slice of VxlanVni if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (vx *Vxlan) VniList() ([]VxlanVni, error) {
+	banner := fmt.Sprintf("VniList(%s): ", vx.Name())
+	native := nl.NativeEndian()
+	var vnis []VxlanVni
+
+	req := nl.NewNetlinkRequest(unix.RTM_GETTUNNEL, unix.NLM_F_DUMP)
+	req.AddData(rawData(tunnelMsg(vx.Link.Attrs().Index)))
+	msgs, err := handleOf(vx.h).execute(req, unix.NETLINK_ROUTE,
+		unix.RTM_NEWTUNNEL)
+	if err != nil {
+		return nil, fmt.Errorf("%sRTM_GETTUNNEL: %v", banner, err)
+	}
+	for _, m := range msgs {
+		if len(m) < sizeofTunnelMsg ||
+			int(native.Uint32(m[4:8])) != vx.Link.Attrs().Index {
+			continue
+		}
+		attrs, err := nl.ParseRouteAttr(m[sizeofTunnelMsg:])
+		if err != nil {
+			return nil, fmt.Errorf("%s%v", banner, err)
+		}
+		for _, a := range attrs {
+			if a.Attr.Type&nl.NLA_TYPE_MASK != vniFilterEntry {
+				continue
+			}
+			ea, err := nl.ParseRouteAttr(a.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s%v", banner, err)
+			}
+			var v VxlanVni
+			for _, e := range ea {
+				switch e.Attr.Type & nl.NLA_TYPE_MASK {
+				case vniFilterEntryStart:
+					v.Vni = native.Uint32(e.Value[0:4])
+				case vniFilterEntryEnd:
+					v.VniEnd = native.Uint32(e.Value[0:4])
+				case vniFilterEntryGroup, vniFilterEntryGroup6:
+					v.Group = net.IP(append([]byte{}, e.Value...))
+				}
+			}
+			if v.Group != nil && v.Group.IsUnspecified() {
+				v.Group = nil
+			}
+			if v.VniEnd == v.Vni {
+				v.VniEnd = 0
+			}
+			vnis = append(vnis, v)
+		}
+	}
+	return vnis, nil
+}
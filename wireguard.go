@@ -0,0 +1,629 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"net"
+	"time"
+)
+
+const (
+	WgKeyLen = 32 // length of a WireGuard key
+)
+
+//
+// linux/wireguard.h
+//
+const (
+	wgGenlName    = "wireguard"
+	wgGenlVersion = 1
+
+	wgCmdGetDevice = 0 // WG_CMD_GET_DEVICE
+	wgCmdSetDevice = 1 // WG_CMD_SET_DEVICE
+
+	wgDeviceAIfindex    = 1 // WGDEVICE_A_IFINDEX
+	wgDeviceAPrivateKey = 3 // WGDEVICE_A_PRIVATE_KEY
+	wgDeviceAPublicKey  = 4 // WGDEVICE_A_PUBLIC_KEY
+	wgDeviceAListenPort = 6 // WGDEVICE_A_LISTEN_PORT
+	wgDeviceAFwmark     = 7 // WGDEVICE_A_FWMARK
+	wgDeviceAPeers      = 8 // WGDEVICE_A_PEERS
+
+	wgPeerFRemoveMe          = 0x1 // WGPEER_F_REMOVE_ME
+	wgPeerFReplaceAllowedIPs = 0x2 // WGPEER_F_REPLACE_ALLOWEDIPS
+
+	wgPeerAPublicKey         = 1  // WGPEER_A_PUBLIC_KEY
+	wgPeerAPresharedKey      = 2  // WGPEER_A_PRESHARED_KEY
+	wgPeerAFlags             = 3  // WGPEER_A_FLAGS
+	wgPeerAEndpoint          = 4  // WGPEER_A_ENDPOINT
+	wgPeerAKeepalive         = 5  // WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL
+	wgPeerALastHandshakeTime = 6  // WGPEER_A_LAST_HANDSHAKE_TIME
+	wgPeerARxBytes           = 7  // WGPEER_A_RX_BYTES
+	wgPeerATxBytes           = 8  // WGPEER_A_TX_BYTES
+	wgPeerAAllowedIPs        = 9  // WGPEER_A_ALLOWEDIPS
+	wgPeerAProtocolVersion   = 10 // WGPEER_A_PROTOCOL_VERSION
+
+	wgAllowedIPAFamily   = 1 // WGALLOWEDIP_A_FAMILY
+	wgAllowedIPAIPAddr   = 2 // WGALLOWEDIP_A_IPADDR
+	wgAllowedIPACidrMask = 3 // WGALLOWEDIP_A_CIDR_MASK
+)
+
+// WgKey is a WireGuard private, public, or preshared key
+type WgKey [WgKeyLen]byte
+
+type Wireguard struct {
+	Link *netlink.Wireguard
+	h    *Handle
+}
+
+// WireguardOptions holds the attributes of a WireGuard interface
+type WireguardOptions struct {
+	PrivateKey *WgKey // private key. nil for none
+	ListenPort uint16 // UDP port. 0 for random
+	Fwmark     uint32 // fwmark of the encapsulated packets. 0 for none
+	Vrf        string // VRF to bind the WireGuard interface to
+}
+
+// WgPeer is a peer of a WireGuard interface
+type WgPeer struct {
+	PublicKey    WgKey
+	PresharedKey *WgKey       // nil for none (or unchanged)
+	Endpoint     *net.UDPAddr // nil for none (or unchanged)
+	AllowedIPs   []net.IPNet
+	Keepalive    uint16 // persistent keepalive interval (sec). 0 for off
+	//
+	// statistics (read only)
+	//
+	LastHandshake   time.Time // zero if no handshake yet
+	RxBytes         uint64
+	TxBytes         uint64
+	ProtocolVersion uint32
+}
+
+// WgDevice is the configuration and the state of a WireGuard
+// interface
+type WgDevice struct {
+	PublicKey  WgKey // zero if no private key
+	ListenPort uint16
+	Fwmark     uint32
+	Peers      []WgPeer
+}
+
+// ParseWgKey returns the WireGuard key encoded in base64 string `s'
+// in: s Key in base64 (`wg genkey' format)
+// return: 1. Key if success
+//         2. nil if success
+//            non-nil otherwise
+func ParseWgKey(s string) (WgKey, error) {
+	var k WgKey
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return k, fmt.Errorf("ParseWgKey(): %v", err)
+	}
+	if len(b) != WgKeyLen {
+		return k, fmt.Errorf("ParseWgKey(): invalid key length: %d", len(b))
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// WgGenerateKey returns a new random WireGuard private key (or
+// preshared key) (`wg genkey')
+// return: 1. Key if success
+//         2. nil if success
+//            non-nil otherwise
+func WgGenerateKey() (WgKey, error) {
+	var k WgKey
+
+	if _, err := rand.Read(k[:]); err != nil {
+		return k, fmt.Errorf("WgGenerateKey(): %v", err)
+	}
+	//
+	// clamp as a Curve25519 private key
+	//
+	k[0] &= 248
+	k[31] = (k[31] & 127) | 64
+	return k, nil
+}
+
+// String returns this key in base64
+func (k WgKey) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// IsZero returns true if this key is all zero (i.e. not set)
+func (k WgKey) IsZero() bool {
+	return k == WgKey{}
+}
+
+// WireguardAdd adds a WireGuard interface whose name is `name'
+// (`ip link add <name> type wireguard; wg set <name> ...')
+// in: name Name of the WireGuard interface
+//     opts Pointer to the WireGuard attributes. nil for none.
+//          If opts.Vrf is given, the interface is bound to the VRF
+//     up Bring up `name' if true
+// return: 1. Pointer to Wireguard if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func WireguardAdd(name string, opts *WireguardOptions,
+	up bool) (*Wireguard, error) {
+	return pkgHandle.WireguardAdd(name, opts, up)
+}
+
+// WireguardAdd adds a WireGuard interface whose name is `name' to the
+// network namespace of `h'
+func (h *Handle) WireguardAdd(name string, opts *WireguardOptions,
+	up bool) (*Wireguard, error) {
+	banner := fmt.Sprintf("WireguardAdd(%s): ", name)
+
+	if opts == nil {
+		opts = &WireguardOptions{}
+	}
+	req := newLinkRequest(unix.NLM_F_CREATE|unix.NLM_F_EXCL, 0, name)
+	linkInfo, _ := newLinkInfo("wireguard")
+	req.AddData(linkInfo)
+	if _, err := h.execute(req, unix.NETLINK_ROUTE, 0); err != nil {
+		return nil, fmt.Errorf("%sRTM_NEWLINK: %v", banner, err)
+	}
+	wg, err := h.WireguardGetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	err = wg.setDevice(func(req *nl.NetlinkRequest) {
+		if opts.PrivateKey != nil {
+			req.AddData(nl.NewRtAttr(wgDeviceAPrivateKey, opts.PrivateKey[:]))
+		}
+		req.AddData(nl.NewRtAttr(wgDeviceAListenPort,
+			nl.Uint16Attr(opts.ListenPort)))
+		req.AddData(nl.NewRtAttr(wgDeviceAFwmark, nl.Uint32Attr(opts.Fwmark)))
+	})
+	if err == nil && opts.Vrf != "" {
+		err = h.VrfBindIf(opts.Vrf, name)
+	}
+	if err != nil {
+		h.nlh.LinkDel(wg.Link)
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	if up {
+		return wg, wg.IfUp()
+	}
+	return wg, nil
+}
+
+// WireguardDelete deletes a WireGuard interface whose name is `name'
+// in: name Name of the WireGuard interface
+// return: nil if success
+//         non-nil otherwise
+func WireguardDelete(name string) error {
+	return pkgHandle.WireguardDelete(name)
+}
+
+// WireguardDelete deletes a WireGuard interface whose name is `name'
+// from the network namespace of `h'
+func (h *Handle) WireguardDelete(name string) error {
+	wg, err := h.WireguardGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(wg.Link); err != nil {
+		return fmt.Errorf("WireguardDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// WireguardGetByName returns a pointer to Wireguard if WireGuard
+// interface whose name is `name' exists
+// in: name Name of the WireGuard interface
+// return: 1. Pointer to Wireguard if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func WireguardGetByName(name string) (*Wireguard, error) {
+	return pkgHandle.WireguardGetByName(name)
+}
+
+// WireguardGetByName returns a pointer to Wireguard if WireGuard
+// interface whose name is `name' exists in the network namespace of `h'
+func (h *Handle) WireguardGetByName(name string) (*Wireguard, error) {
+	if l, err := h.nlh.LinkByName(name); err == nil {
+		switch l := l.(type) {
+		case *netlink.Wireguard:
+			return &Wireguard{Link: l, h: h}, nil
+		default:
+			return nil, fmt.Errorf("WireguardGetByName(%s): not WireGuard",
+				name)
+		}
+	} else {
+		return nil, fmt.Errorf("WireguardGetByName(%s): %v", name, err)
+	}
+}
+
+// WireguardList returns a slice of Wireguard
+// return: 1. Slice of Wireguard if success
+//         2. nil if success
+//            non-nil otherwise
+func WireguardList() ([]Wireguard, error) {
+	return pkgHandle.WireguardList()
+}
+
+// WireguardList returns a slice of Wireguard in the network namespace
+// of `h'
+func (h *Handle) WireguardList() ([]Wireguard, error) {
+	var wgs []Wireguard
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("WireguardList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Wireguard); ok {
+			wgs = append(wgs, Wireguard{Link: l, h: h})
+		}
+	}
+	return wgs, nil
+}
+
+// Name returns the name of this WireGuard interface
+func (wg *Wireguard) Name() string {
+	return wg.Link.Attrs().Name
+}
+
+// IfUp brings up this WireGuard interface
+func (wg *Wireguard) IfUp() error {
+	return handleOf(wg.h).nlh.LinkSetUp(wg.Link)
+}
+
+// IfDown brings down this WireGuard interface
+func (wg *Wireguard) IfDown() error {
+	return handleOf(wg.h).nlh.LinkSetDown(wg.Link)
+}
+
+// setDevice sends WG_CMD_SET_DEVICE for this WireGuard interface.
+// `add' adds the attributes to the request.
+func (wg *Wireguard) setDevice(add func(req *nl.NetlinkRequest)) error {
+	h := handleOf(wg.h)
+	req, err := h.newGenlRequest(wgGenlName, wgCmdSetDevice, wgGenlVersion, 0)
+	if err != nil {
+		return err
+	}
+	req.AddData(nl.NewRtAttr(wgDeviceAIfindex,
+		nl.Uint32Attr(uint32(wg.Link.Attrs().Index))))
+	add(req)
+	if _, err := h.execute(req, unix.NETLINK_GENERIC, 0); err != nil {
+		return fmt.Errorf("WG_CMD_SET_DEVICE: %v", err)
+	}
+	return nil
+}
+
+// SetPrivateKey sets the private key of this WireGuard interface
+// (`wg set <name> private-key <file>')
+// in: key Private key
+// return: nil if success
+//         non-nil otherwise
+func (wg *Wireguard) SetPrivateKey(key WgKey) error {
+	err := wg.setDevice(func(req *nl.NetlinkRequest) {
+		req.AddData(nl.NewRtAttr(wgDeviceAPrivateKey, key[:]))
+	})
+	if err != nil {
+		return fmt.Errorf("SetPrivateKey(%s): %v", wg.Name(), err)
+	}
+	return nil
+}
+
+// SetListenPort sets the UDP port of this WireGuard interface
+// (`wg set <name> listen-port <port>')
+// in: port UDP port. 0 for random
+// return: nil if success
+//         non-nil otherwise
+func (wg *Wireguard) SetListenPort(port uint16) error {
+	err := wg.setDevice(func(req *nl.NetlinkRequest) {
+		req.AddData(nl.NewRtAttr(wgDeviceAListenPort, nl.Uint16Attr(port)))
+	})
+	if err != nil {
+		return fmt.Errorf("SetListenPort(%s): %v", wg.Name(), err)
+	}
+	return nil
+}
+
+// SetFwmark sets the fwmark of the encapsulated packets of this
+// WireGuard interface (`wg set <name> fwmark <mark>')
+// in: mark Fwmark. 0 for none
+// return: nil if success
+//         non-nil otherwise
+func (wg *Wireguard) SetFwmark(mark uint32) error {
+	err := wg.setDevice(func(req *nl.NetlinkRequest) {
+		req.AddData(nl.NewRtAttr(wgDeviceAFwmark, nl.Uint32Attr(mark)))
+	})
+	if err != nil {
+		return fmt.Errorf("SetFwmark(%s): %v", wg.Name(), err)
+	}
+	return nil
+}
+
+// sockaddrAttr returns `addr' as struct sockaddr_in or sockaddr_in6
+func sockaddrAttr(addr *net.UDPAddr) []byte {
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		b := make([]byte, unix.SizeofSockaddrInet4)
+		nl.NativeEndian().PutUint16(b[0:2], unix.AF_INET)
+		binary.BigEndian.PutUint16(b[2:4], uint16(addr.Port))
+		copy(b[4:8], ip4)
+		return b
+	}
+	b := make([]byte, unix.SizeofSockaddrInet6)
+	nl.NativeEndian().PutUint16(b[0:2], unix.AF_INET6)
+	binary.BigEndian.PutUint16(b[2:4], uint16(addr.Port))
+	copy(b[8:24], addr.IP.To16())
+	return b
+}
+
+// parseSockaddr returns struct sockaddr_in or sockaddr_in6 `b' as
+// *net.UDPAddr. nil if `b' is neither.
+func parseSockaddr(b []byte) *net.UDPAddr {
+	if len(b) < 2 {
+		return nil
+	}
+	port := 0
+	if len(b) >= 4 {
+		port = int(binary.BigEndian.Uint16(b[2:4]))
+	}
+	switch nl.NativeEndian().Uint16(b[0:2]) {
+	case unix.AF_INET:
+		if len(b) >= 8 {
+			return &net.UDPAddr{IP: net.IP(append([]byte{}, b[4:8]...)),
+				Port: port}
+		}
+	case unix.AF_INET6:
+		if len(b) >= 24 {
+			return &net.UDPAddr{IP: net.IP(append([]byte{}, b[8:24]...)),
+				Port: port}
+		}
+	}
+	return nil
+}
+
+// attr returns this peer as an entry of WGDEVICE_A_PEERS
+func (peer *WgPeer) attr(flags uint32) *nl.RtAttr {
+	a := nestedAttr(0)
+	a.AddRtAttr(wgPeerAPublicKey, peer.PublicKey[:])
+	a.AddRtAttr(wgPeerAFlags, nl.Uint32Attr(flags))
+	if flags&wgPeerFRemoveMe != 0 {
+		return a
+	}
+	if peer.PresharedKey != nil {
+		a.AddRtAttr(wgPeerAPresharedKey, peer.PresharedKey[:])
+	}
+	if peer.Endpoint != nil {
+		a.AddRtAttr(wgPeerAEndpoint, sockaddrAttr(peer.Endpoint))
+	}
+	a.AddRtAttr(wgPeerAKeepalive, nl.Uint16Attr(peer.Keepalive))
+	ips := nestedAttr(wgPeerAAllowedIPs)
+	for _, p := range peer.AllowedIPs {
+		ones, _ := p.Mask.Size()
+		ip := nestedAttr(0)
+		if ip4 := p.IP.To4(); ip4 != nil {
+			ip.AddRtAttr(wgAllowedIPAFamily, nl.Uint16Attr(unix.AF_INET))
+			ip.AddRtAttr(wgAllowedIPAIPAddr, []byte(ip4))
+		} else {
+			ip.AddRtAttr(wgAllowedIPAFamily, nl.Uint16Attr(unix.AF_INET6))
+			ip.AddRtAttr(wgAllowedIPAIPAddr, []byte(p.IP.To16()))
+		}
+		ip.AddRtAttr(wgAllowedIPACidrMask, nl.Uint8Attr(uint8(ones)))
+		ips.AddChild(ip)
+	}
+	a.AddChild(ips)
+	return a
+}
+
+// AddPeer adds peer `peer' to this WireGuard interface, or updates
+// it if it exists. The allowed IPs of the peer are replaced with
+// peer.AllowedIPs. The statistics in `peer' are ignored.
+// (`wg set <name> peer <key> endpoint <ep> allowed-ips <ips> ...')
+// in: peer Pointer to the peer
+// return: nil if success
+//         non-nil otherwise
+func (wg *Wireguard) AddPeer(peer *WgPeer) error {
+	err := wg.setDevice(func(req *nl.NetlinkRequest) {
+		peers := nestedAttr(wgDeviceAPeers)
+		peers.AddChild(peer.attr(wgPeerFReplaceAllowedIPs))
+		req.AddData(peers)
+	})
+	if err != nil {
+		return fmt.Errorf("AddPeer(%s, %s): %v", wg.Name(), peer.PublicKey, err)
+	}
+	return nil
+}
+
+// DeletePeer deletes the peer whose public key is `key' from this
+// WireGuard interface (`wg set <name> peer <key> remove')
+// in: key Public key of the peer
+// return: nil if success
+//         non-nil otherwise
+func (wg *Wireguard) DeletePeer(key WgKey) error {
+	err := wg.setDevice(func(req *nl.NetlinkRequest) {
+		peers := nestedAttr(wgDeviceAPeers)
+		peers.AddChild((&WgPeer{PublicKey: key}).attr(wgPeerFRemoveMe))
+		req.AddData(peers)
+	})
+	if err != nil {
+		return fmt.Errorf("DeletePeer(%s, %s): %v", wg.Name(), key, err)
+	}
+	return nil
+}
+
+// Device returns the configuration, the peers and their statistics
+// of this WireGuard interface (`wg show <name>')
+// return: 1. Pointer to WgDevice if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func (wg *Wireguard) Device() (*WgDevice, error) {
+	banner := fmt.Sprintf("Device(%s): ", wg.Name())
+	h := handleOf(wg.h)
+
+	req, err := h.newGenlRequest(wgGenlName, wgCmdGetDevice, wgGenlVersion,
+		unix.NLM_F_DUMP)
+	if err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	req.AddData(nl.NewRtAttr(wgDeviceAIfindex,
+		nl.Uint32Attr(uint32(wg.Link.Attrs().Index))))
+	msgs, err := h.execute(req, unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%sWG_CMD_GET_DEVICE: %v", banner, err)
+	}
+	//
+	// A large device is split into multiple messages. A peer may
+	// continue in the next message with the rest of its allowed IPs.
+	//
+	dev := &WgDevice{}
+	index := make(map[WgKey]int)
+	for _, m := range msgs {
+		attrs, err := genlAttrs(m)
+		if err != nil {
+			return nil, fmt.Errorf("%s%v", banner, err)
+		}
+		for _, a := range attrs {
+			switch a.Attr.Type & nl.NLA_TYPE_MASK {
+			case wgDeviceAPublicKey:
+				copy(dev.PublicKey[:], a.Value)
+			case wgDeviceAListenPort:
+				dev.ListenPort = nl.NativeEndian().Uint16(a.Value[0:2])
+			case wgDeviceAFwmark:
+				dev.Fwmark = nl.NativeEndian().Uint32(a.Value[0:4])
+			case wgDeviceAPeers:
+				peers, err := nl.ParseRouteAttr(a.Value)
+				if err != nil {
+					return nil, fmt.Errorf("%s%v", banner, err)
+				}
+				for _, p := range peers {
+					peer, err := parseWgPeer(p.Value)
+					if err != nil {
+						return nil, fmt.Errorf("%s%v", banner, err)
+					}
+					if i, ok := index[peer.PublicKey]; ok {
+						dev.Peers[i].AllowedIPs = append(dev.Peers[i].AllowedIPs,
+							peer.AllowedIPs...)
+						continue
+					}
+					index[peer.PublicKey] = len(dev.Peers)
+					dev.Peers = append(dev.Peers, *peer)
+				}
+			}
+		}
+	}
+	return dev, nil
+}
+
+// Peers returns the peers of this WireGuard interface
+// return: 1. Slice of WgPeer if success
+//         2. nil if success
+//            non-nil otherwise
+func (wg *Wireguard) Peers() ([]WgPeer, error) {
+	dev, err := wg.Device()
+	if err != nil {
+		return nil, err
+	}
+	return dev.Peers, nil
+}
+
+// parseWgPeer returns the peer built from the WGPEER_A_* attributes
+// in `b'
+func parseWgPeer(b []byte) (*WgPeer, error) {
+	native := nl.NativeEndian()
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, err
+	}
+	peer := &WgPeer{}
+	for _, a := range attrs {
+		switch a.Attr.Type & nl.NLA_TYPE_MASK {
+		case wgPeerAPublicKey:
+			copy(peer.PublicKey[:], a.Value)
+		case wgPeerAPresharedKey:
+			var k WgKey
+			copy(k[:], a.Value)
+			if !k.IsZero() {
+				peer.PresharedKey = &k
+			}
+		case wgPeerAEndpoint:
+			peer.Endpoint = parseSockaddr(a.Value)
+		case wgPeerAKeepalive:
+			peer.Keepalive = native.Uint16(a.Value[0:2])
+		case wgPeerALastHandshakeTime:
+			if len(a.Value) < 16 {
+				break
+			}
+			sec := int64(native.Uint64(a.Value[0:8]))
+			nsec := int64(native.Uint64(a.Value[8:16]))
+			if sec != 0 || nsec != 0 {
+				peer.LastHandshake = time.Unix(sec, nsec)
+			}
+		case wgPeerARxBytes:
+			peer.RxBytes = native.Uint64(a.Value[0:8])
+		case wgPeerATxBytes:
+			peer.TxBytes = native.Uint64(a.Value[0:8])
+		case wgPeerAProtocolVersion:
+			peer.ProtocolVersion = native.Uint32(a.Value[0:4])
+		case wgPeerAAllowedIPs:
+			ips, err := nl.ParseRouteAttr(a.Value)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				p, err := parseWgAllowedIP(ip.Value)
+				if err != nil {
+					return nil, err
+				}
+				peer.AllowedIPs = append(peer.AllowedIPs, *p)
+			}
+		}
+	}
+	return peer, nil
+}
+
+// parseWgAllowedIP returns the prefix built from the WGALLOWEDIP_A_*
+// attributes in `b'
+func parseWgAllowedIP(b []byte) (*net.IPNet, error) {
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ip   net.IP
+		ones int
+	)
+	for _, a := range attrs {
+		switch a.Attr.Type & nl.NLA_TYPE_MASK {
+		case wgAllowedIPAIPAddr:
+			ip = net.IP(append([]byte{}, a.Value...))
+		case wgAllowedIPACidrMask:
+			ones = int(a.Value[0])
+		}
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("allowed IP without address")
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, len(ip)*8)}, nil
+}
@@ -0,0 +1,405 @@
+/*
+Copyright 2019 Yoichi Hariguchi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package iproute
+
+import (
+	"fmt"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	XFRM_PROTO_ESP             = netlink.XFRM_PROTO_ESP
+	XFRM_PROTO_AH              = netlink.XFRM_PROTO_AH
+	XFRM_PROTO_COMP            = netlink.XFRM_PROTO_COMP
+	XFRM_PROTO_IPSEC_ANY       = netlink.XFRM_PROTO_IPSEC_ANY
+	XFRM_MODE_TRANSPORT        = netlink.XFRM_MODE_TRANSPORT
+	XFRM_MODE_TUNNEL           = netlink.XFRM_MODE_TUNNEL
+	XFRM_MODE_BEET             = netlink.XFRM_MODE_BEET
+	XFRM_DIR_IN                = netlink.XFRM_DIR_IN
+	XFRM_DIR_OUT               = netlink.XFRM_DIR_OUT
+	XFRM_DIR_FWD               = netlink.XFRM_DIR_FWD
+	XFRM_POLICY_ALLOW          = netlink.XFRM_POLICY_ALLOW
+	XFRM_POLICY_BLOCK          = netlink.XFRM_POLICY_BLOCK
+	XFRM_ENCAP_ESPINUDP_NONIKE = netlink.XFRM_ENCAP_ESPINUDP_NONIKE
+	XFRM_ENCAP_ESPINUDP        = netlink.XFRM_ENCAP_ESPINUDP
+)
+
+type XfrmProto = netlink.Proto
+type XfrmState = netlink.XfrmState
+type XfrmStateAlgo = netlink.XfrmStateAlgo
+type XfrmStateEncap = netlink.XfrmStateEncap
+type XfrmPolicy = netlink.XfrmPolicy
+type XfrmPolicyTmpl = netlink.XfrmPolicyTmpl
+type XfrmMark = netlink.XfrmMark
+
+// Xfrmi is an XFRM interface. Packets routed to it are transformed
+// by the states and the policies whose if_id is its if_id.
+type Xfrmi struct {
+	Link *netlink.Xfrmi
+	h    *Handle
+}
+
+// XfrmiAdd adds an XFRM interface whose name is `name'
+// (`ip link add <name> type xfrm dev <dev> if_id <ifId>')
+// in: name Name of the XFRM interface
+//     dev Name of the underlying device. "" for none
+//     ifId Interface ID of the states and policies. Must not be 0
+//     up Bring up `name' if true
+// return: 1. Pointer to Xfrmi if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func XfrmiAdd(name, dev string, ifId uint32, up bool) (*Xfrmi, error) {
+	return pkgHandle.XfrmiAdd(name, dev, ifId, up)
+}
+
+// XfrmiAdd adds an XFRM interface whose name is `name' to the network
+// namespace of `h'
+func (h *Handle) XfrmiAdd(name, dev string, ifId uint32,
+	up bool) (*Xfrmi, error) {
+	banner := fmt.Sprintf("XfrmiAdd(%s, %s, %d): ", name, dev, ifId)
+
+	if ifId == 0 {
+		return nil, fmt.Errorf("%sif_id must not be 0", banner)
+	}
+	x := &netlink.Xfrmi{
+		LinkAttrs: netlink.LinkAttrs{Name: name},
+		Ifid:      ifId,
+	}
+	if dev != "" {
+		index, err := h.IfIndex(dev)
+		if err != nil {
+			return nil, fmt.Errorf("%s%v", banner, err)
+		}
+		x.ParentIndex = index
+	}
+	if err := h.linkAddUp(x, up); err != nil {
+		return nil, fmt.Errorf("%s%v", banner, err)
+	}
+	return h.XfrmiGetByName(name)
+}
+
+// XfrmiDelete deletes an XFRM interface whose name is `name'
+// in: name Name of the XFRM interface
+// return: nil if success
+//         non-nil otherwise
+func XfrmiDelete(name string) error {
+	return pkgHandle.XfrmiDelete(name)
+}
+
+// XfrmiDelete deletes an XFRM interface whose name is `name' from the
+// network namespace of `h'
+func (h *Handle) XfrmiDelete(name string) error {
+	x, err := h.XfrmiGetByName(name)
+	if err != nil {
+		return err
+	}
+	if err := h.nlh.LinkDel(x.Link); err != nil {
+		return fmt.Errorf("XfrmiDelete(%s): LinkDel(): %v", name, err)
+	}
+	return nil
+}
+
+// XfrmiGetByName returns a pointer to Xfrmi if XFRM interface whose
+// name is `name' exists
+// in: name Name of the XFRM interface
+// return: 1. Pointer to Xfrmi if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func XfrmiGetByName(name string) (*Xfrmi, error) {
+	return pkgHandle.XfrmiGetByName(name)
+}
+
+// XfrmiGetByName returns a pointer to Xfrmi if XFRM interface whose
+// name is `name' exists in the network namespace of `h'
+func (h *Handle) XfrmiGetByName(name string) (*Xfrmi, error) {
+	l, err := h.nlh.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("XfrmiGetByName(%s): %v", name, err)
+	}
+	if l, ok := l.(*netlink.Xfrmi); ok {
+		return &Xfrmi{Link: l, h: h}, nil
+	}
+	return nil, fmt.Errorf("XfrmiGetByName(%s): not XFRM", name)
+}
+
+// XfrmiList returns a slice of Xfrmi
+// return: 1. Slice of Xfrmi if success
+//         2. nil if success
+//            non-nil otherwise
+func XfrmiList() ([]Xfrmi, error) {
+	return pkgHandle.XfrmiList()
+}
+
+// XfrmiList returns a slice of Xfrmi in the network namespace of `h'
+func (h *Handle) XfrmiList() ([]Xfrmi, error) {
+	var xs []Xfrmi
+
+	ll, err := h.nlh.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("XfrmiList(): LinkList(): %v", err)
+	}
+	for _, l := range ll {
+		if l, ok := l.(*netlink.Xfrmi); ok {
+			xs = append(xs, Xfrmi{Link: l, h: h})
+		}
+	}
+	return xs, nil
+}
+
+// Name returns the name of this XFRM interface
+func (x *Xfrmi) Name() string {
+	return x.Link.Attrs().Name
+}
+
+// Index returns the ifindex of this XFRM interface
+func (x *Xfrmi) Index() int {
+	return x.Link.Attrs().Index
+}
+
+// IfId returns the interface ID of this XFRM interface
+func (x *Xfrmi) IfId() uint32 {
+	return x.Link.Ifid
+}
+
+// IfUp brings up this XFRM interface
+func (x *Xfrmi) IfUp() error {
+	return handleOf(x.h).nlh.LinkSetUp(x.Link)
+}
+
+// IfDown brings down this XFRM interface
+func (x *Xfrmi) IfDown() error {
+	return handleOf(x.h).nlh.LinkSetDown(x.Link)
+}
+
+// States returns the XFRM states whose if_id is the if_id of this
+// XFRM interface
+// return: 1. Slice of XfrmState if success
+//         2. nil if success
+//            non-nil otherwise
+func (x *Xfrmi) States() ([]XfrmState, error) {
+	var states []XfrmState
+
+	all, err := handleOf(x.h).XfrmStateList(FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("States(%s): %v", x.Name(), err)
+	}
+	for _, s := range all {
+		if uint32(s.Ifid) == x.IfId() {
+			states = append(states, s)
+		}
+	}
+	return states, nil
+}
+
+// Policies returns the XFRM policies whose if_id is the if_id of this
+// XFRM interface
+// return: 1. Slice of XfrmPolicy if success
+//         2. nil if success
+//            non-nil otherwise
+func (x *Xfrmi) Policies() ([]XfrmPolicy, error) {
+	var policies []XfrmPolicy
+
+	all, err := handleOf(x.h).XfrmPolicyList(FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("Policies(%s): %v", x.Name(), err)
+	}
+	for _, p := range all {
+		if uint32(p.Ifid) == x.IfId() {
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// XfrmStateAdd adds XFRM state (SA) `s' (`ip xfrm state add ...')
+// in: s Pointer to the state: Src, Dst, Proto, Spi, Mode, the
+//       algorithms and keys (Auth, Crypt, or Aead), Encap, Ifid, ...
+// return: nil if success
+//         non-nil otherwise
+func XfrmStateAdd(s *XfrmState) error {
+	return pkgHandle.XfrmStateAdd(s)
+}
+
+// XfrmStateAdd adds XFRM state `s' to the network namespace of `h'
+func (h *Handle) XfrmStateAdd(s *XfrmState) error {
+	return h.nlh.XfrmStateAdd(s)
+}
+
+// XfrmStateUpdate updates XFRM state `s' (`ip xfrm state update ...')
+// in: s Pointer to the state
+// return: nil if success
+//         non-nil otherwise
+func XfrmStateUpdate(s *XfrmState) error {
+	return pkgHandle.XfrmStateUpdate(s)
+}
+
+// XfrmStateUpdate updates XFRM state `s' in the network namespace
+// of `h'
+func (h *Handle) XfrmStateUpdate(s *XfrmState) error {
+	return h.nlh.XfrmStateUpdate(s)
+}
+
+// XfrmStateDelete deletes XFRM state `s' identified by Dst, Proto,
+// Spi, and Mark (`ip xfrm state delete ...')
+// in: s Pointer to the state
+// return: nil if success
+//         non-nil otherwise
+func XfrmStateDelete(s *XfrmState) error {
+	return pkgHandle.XfrmStateDelete(s)
+}
+
+// XfrmStateDelete deletes XFRM state `s' from the network namespace
+// of `h'
+func (h *Handle) XfrmStateDelete(s *XfrmState) error {
+	return h.nlh.XfrmStateDel(s)
+}
+
+// XfrmStateGet returns XFRM state identified by Dst, Proto, Spi, and
+// Mark of `s' (`ip xfrm state get ...')
+// in: s Pointer to the state
+// return: 1. Pointer to the state if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func XfrmStateGet(s *XfrmState) (*XfrmState, error) {
+	return pkgHandle.XfrmStateGet(s)
+}
+
+// XfrmStateGet returns XFRM state identified by `s' in the network
+// namespace of `h'
+func (h *Handle) XfrmStateGet(s *XfrmState) (*XfrmState, error) {
+	return h.nlh.XfrmStateGet(s)
+}
+
+// XfrmStateList returns XFRM states (`ip xfrm state list')
+// in: family FAMILY_ALL, FAMILY_V4, or FAMILY_V6
+// return: 1. Slice of XfrmState if success
+//         2. nil if success
+//            non-nil otherwise
+func XfrmStateList(family int) ([]XfrmState, error) {
+	return pkgHandle.XfrmStateList(family)
+}
+
+// XfrmStateList returns XFRM states in the network namespace of `h'
+func (h *Handle) XfrmStateList(family int) ([]XfrmState, error) {
+	return h.nlh.XfrmStateList(family)
+}
+
+// XfrmStateFlush deletes XFRM states (`ip xfrm state flush')
+// in: proto Protocol of the states to be deleted (e.g. XFRM_PROTO_ESP.)
+//           XFRM_PROTO_IPSEC_ANY for all
+// return: nil if success
+//         non-nil otherwise
+func XfrmStateFlush(proto XfrmProto) error {
+	return pkgHandle.XfrmStateFlush(proto)
+}
+
+// XfrmStateFlush deletes XFRM states in the network namespace of `h'
+func (h *Handle) XfrmStateFlush(proto XfrmProto) error {
+	return h.nlh.XfrmStateFlush(proto)
+}
+
+// XfrmPolicyAdd adds XFRM policy (SP) `p' (`ip xfrm policy add ...')
+// in: p Pointer to the policy: selector (Src, Dst, Proto, ports),
+//       Dir, Action, Tmpls, Ifid, Mark, ...
+// return: nil if success
+//         non-nil otherwise
+func XfrmPolicyAdd(p *XfrmPolicy) error {
+	return pkgHandle.XfrmPolicyAdd(p)
+}
+
+// XfrmPolicyAdd adds XFRM policy `p' to the network namespace of `h'
+func (h *Handle) XfrmPolicyAdd(p *XfrmPolicy) error {
+	return h.nlh.XfrmPolicyAdd(p)
+}
+
+// XfrmPolicyUpdate updates XFRM policy `p'
+// (`ip xfrm policy update ...')
+// in: p Pointer to the policy
+// return: nil if success
+//         non-nil otherwise
+func XfrmPolicyUpdate(p *XfrmPolicy) error {
+	return pkgHandle.XfrmPolicyUpdate(p)
+}
+
+// XfrmPolicyUpdate updates XFRM policy `p' in the network namespace
+// of `h'
+func (h *Handle) XfrmPolicyUpdate(p *XfrmPolicy) error {
+	return h.nlh.XfrmPolicyUpdate(p)
+}
+
+// XfrmPolicyDelete deletes XFRM policy `p' identified by the
+// selector, Dir, Ifid, and Mark (or Index if non-zero)
+// (`ip xfrm policy delete ...')
+// in: p Pointer to the policy
+// return: nil if success
+//         non-nil otherwise
+func XfrmPolicyDelete(p *XfrmPolicy) error {
+	return pkgHandle.XfrmPolicyDelete(p)
+}
+
+// XfrmPolicyDelete deletes XFRM policy `p' from the network namespace
+// of `h'
+func (h *Handle) XfrmPolicyDelete(p *XfrmPolicy) error {
+	return h.nlh.XfrmPolicyDel(p)
+}
+
+// XfrmPolicyGet returns XFRM policy identified by `p'
+// (`ip xfrm policy get ...')
+// in: p Pointer to the policy
+// return: 1. Pointer to the policy if success
+//            nil otherwise
+//         2. nil if success
+//            non-nil otherwise
+func XfrmPolicyGet(p *XfrmPolicy) (*XfrmPolicy, error) {
+	return pkgHandle.XfrmPolicyGet(p)
+}
+
+// XfrmPolicyGet returns XFRM policy identified by `p' in the network
+// namespace of `h'
+func (h *Handle) XfrmPolicyGet(p *XfrmPolicy) (*XfrmPolicy, error) {
+	return h.nlh.XfrmPolicyGet(p)
+}
+
+// XfrmPolicyList returns XFRM policies (`ip xfrm policy list')
+// in: family FAMILY_ALL, FAMILY_V4, or FAMILY_V6
+// return: 1. Slice of XfrmPolicy if success
+//         2. nil if success
+//            non-nil otherwise
+func XfrmPolicyList(family int) ([]XfrmPolicy, error) {
+	return pkgHandle.XfrmPolicyList(family)
+}
+
+// XfrmPolicyList returns XFRM policies in the network namespace of `h'
+func (h *Handle) XfrmPolicyList(family int) ([]XfrmPolicy, error) {
+	return h.nlh.XfrmPolicyList(family)
+}
+
+// XfrmPolicyFlush deletes all XFRM policies (`ip xfrm policy flush')
+// return: nil if success
+//         non-nil otherwise
+func XfrmPolicyFlush() error {
+	return pkgHandle.XfrmPolicyFlush()
+}
+
+// XfrmPolicyFlush deletes all XFRM policies in the network namespace
+// of `h'
+func (h *Handle) XfrmPolicyFlush() error {
+	return h.nlh.XfrmPolicyFlush()
+}